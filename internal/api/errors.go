@@ -0,0 +1,102 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/ratelimit"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"April32025/internal/config"
+)
+
+// RequestError is an error that knows which HTTP status it should surface as.
+// Errors that aren't a requestError are treated as backend failures.
+type RequestError struct {
+	Status  int
+	Code    string
+	Message string
+	Err     error
+
+	RetryAfter int // seconds the client should wait before retrying, 0 for no hint
+}
+
+func (e *RequestError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// Helper function for errors caused by the caller's input
+func BadRequest(code string, format string, args ...interface{}) error {
+	return &RequestError{Status: http.StatusBadRequest, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Helper function for requests the caller isn't allowed to make
+func Forbidden(code string, format string, args ...interface{}) error {
+	return &RequestError{Status: http.StatusForbidden, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Helper function for writes that lost a race with another writer
+func Conflict(code string, format string, args ...interface{}) error {
+	return &RequestError{Status: http.StatusConflict, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Helper function for errors caused by DynamoDB, rule building or execution.
+// Throttled DynamoDB calls surface as a retryable 503, see throttled.
+func BackendError(message string, err error) error {
+	if isThrottlingError(err) {
+		return throttled(message, err)
+	}
+	fmt.Printf("Backend failure: %s: %v\n", message, err)
+	return &RequestError{Status: http.StatusInternalServerError, Code: "backend_error", Message: message, Err: err}
+}
+
+// When the SDK's retries (see config/throttling.go) run out on a throttled
+// table, the request fails with a 503 "throttled" error carrying a Retry-After
+// of THROTTLE_RETRY_AFTER_SECONDS (default 2), so clients back off instead of
+// treating it as an outage.
+const defaultThrottleRetryAfterSeconds = 2
+
+func throttleRetryAfter() int {
+	seconds, err := strconv.Atoi(config.Env("THROTTLE_RETRY_AFTER_SECONDS", strconv.Itoa(defaultThrottleRetryAfterSeconds)))
+	if err != nil || seconds <= 0 {
+		seconds = defaultThrottleRetryAfterSeconds
+	}
+	return seconds
+}
+
+// Helper function to recognize a call that failed because the table, the
+// account or the client's own retry budget ran out of capacity
+func isThrottlingError(err error) bool {
+	var throughput *types.ProvisionedThroughputExceededException
+	if errors.As(err, &throughput) {
+		return true
+	}
+	var quota ratelimit.QuotaExceededError
+	if errors.As(err, &quota) {
+		return true
+	}
+	return retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err) == aws.TrueTernary
+}
+
+// Helper function for backend calls that were throttled
+func throttled(message string, err error) error {
+	fmt.Printf("Throttled: %s: %v\n", message, err)
+	return &RequestError{
+		Status:     http.StatusServiceUnavailable,
+		Code:       "throttled",
+		Message:    message + "; the catalog is busy, retry shortly",
+		Err:        err,
+		RetryAfter: throttleRetryAfter(),
+	}
+}
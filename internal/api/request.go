@@ -0,0 +1,128 @@
+// Package api holds the request and error types shared by every stage: the
+// incoming request as clients send it, the invocation's identity and the
+// structured errors the handler turns into HTTP statuses.
+package api
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+)
+
+type IncomingRequest struct {
+	Themes         map[string]bool `json:"themes"`
+	Importance     map[string]int  `json:"importance"`
+	Context        string          `json:"context"`
+	Group          []GroupMember   `json:"group"`
+	MergeStrategy  string          `json:"mergeStrategy"`
+	Limit          int             `json:"limit"`
+	Cursor         string          `json:"cursor"`
+	Format         string          `json:"format"` // json (default), csv, m3u, xspf, rss, atom, proto or jsonapi
+	SortBy         string          `json:"sortBy"`
+	Seed           int64           `json:"seed"`    // makes sortBy "random" and explore reproducible
+	Explore        bool            `json:"explore"` // swap a slot for a random song, see scoring/exploration.go
+	Scorer         string          `json:"scorer"`  // "rules" (default), "similarity" or "simulation", see scoring/similarity.go
+	Genre          string          `json:"genre"`   // catalog to recommend from, see CATALOG_TABLES
+	Tier           string          `json:"tier"`    // free (default) or premium; direct invocations only
+	Locale         string          `json:"locale"`  // BCP 47 tag for themeLabels, e.g. "es-MX"
+	Compact        bool            `json:"compact"` // omit empty themes and fields from JSON output
+	Fields         []string        `json:"fields"`  // sparse fieldset for each recommendation, e.g. ["Title","Artist"]
+	Debug          bool            `json:"debug"`   // honored only when DEBUG_RESPONSES_ENABLED=true
+	IdempotencyKey string          `json:"idempotencyKey"`
+	Action         string          `json:"action"`        // "recommend" (default), "validateRules", "previewMatches", "stats" or a snapshot action
+	MaxCycle       int             `json:"maxCycle"`      // overrides GRULE_MAX_CYCLE for this request
+	RuleOverrides  []string        `json:"ruleOverrides"` // extra GRL run after the catalog's rules, curators only
+
+	ScoringOverrides map[string]interface{} `json:"scoringOverrides"` // scoring settings for this request, curators only; see scoring/scoring.go
+
+	ExperimentVariant string `json:"experimentVariant"` // QA override for direct invocations, see scoring/experiments.go
+
+	// Hard filters applied before scoring
+	Decades         []int    `json:"decades"`         // e.g. [1990, 2000]; empty for any year
+	ExcludedArtists []string `json:"excludedArtists"` // matched case-insensitively
+	ExcludeExplicit bool     `json:"excludeExplicit"`
+	RequiredThemes  []string `json:"requiredThemes"` // theme keys every song must have; they count as selected
+
+	Intensity       *IntensityRange `json:"intensity"`       // e.g. {"min": 1, "max": 2} for sad and slow, see scoring/intensity.go
+	FavoriteArtists []string        `json:"favoriteArtists"` // boosts their songs and related artists', see scoring/affinity.go
+
+	// Recency boost, see scoring/scoring.go; at most one may be set
+	PreferNew      bool `json:"preferNew"`
+	PreferClassics bool `json:"preferClassics"`
+
+	SongIds []string `json:"songIds"` // score only these songs, e.g. to re-rank a previous result
+	UserID  string   `json:"userId"`  // listener whose history is recorded; direct invocations only
+
+	// Snapshot maintenance, see handler/snapshot.go
+	Snapshot string `json:"snapshot"` // key of the snapshot importSnapshot restores
+	Prune    bool   `json:"prune"`    // importSnapshot also deletes items missing from the snapshot
+}
+
+// Invocation describes how the function was called, for the stages that
+// behave differently over HTTP
+type Invocation struct {
+	HTTP    bool
+	SelfURL string            // scheme://host/path the request was sent to, "" for direct invocations
+	Query   map[string]string // query parameters the request was sent with, HTTP only
+	Tier    string            // listener's plan from the authorizer, HTTP only
+	Role    string            // caller's role from the authorizer, e.g. "curator", HTTP only
+	UserID  string            // listener the authorizer signed in, HTTP only
+
+	ExperimentVariant string // QA override from the X-Experiment-Variant header, see scoring/experiments.go
+}
+
+// Authorizer roles that unlock curation and testing features over HTTP
+const (
+	RoleCurator = "curator"
+	RoleQA      = "qa"
+)
+
+// GroupMember is one person's selections in a group/party request
+type GroupMember struct {
+	Themes     map[string]bool `json:"themes"`
+	Importance map[string]int  `json:"importance"`
+	Weight     float64         `json:"weight"` // relative say in the "weighted" strategy, defaults to 1
+}
+
+// Helper function to get the rating a member gave a theme, 0 when not selected
+func (m GroupMember) ThemeRating(theme string) int {
+	if level, ok := m.Importance[theme]; ok && level > 0 {
+		return max(MinImportance, min(level, MaxImportance))
+	}
+	if m.Themes[theme] {
+		return DefaultImportance
+	}
+	return 0
+}
+
+// IntensityRange is the intensity a request wants, inclusive
+type IntensityRange struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+// Helper function to get the Lambda request ID, empty when run outside Lambda
+func RequestID(ctx context.Context) string {
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		return lc.AwsRequestID
+	}
+	return ""
+}
+
+// Importance ratings run from 1 (nice-to-have) to 5 (essential). A theme
+// rated at defaultImportance scores the same as a plain on/off selection.
+const (
+	MinImportance     = 1
+	MaxImportance     = 5
+	DefaultImportance = 3
+)
+
+// Helper function to pick the listener to record history for. Like the tier,
+// over HTTP it only comes from the authorizer so clients can't write into
+// someone else's history.
+func RequestUserID(incoming IncomingRequest, inv Invocation) string {
+	if inv.HTTP {
+		return inv.UserID
+	}
+	return incoming.UserID
+}
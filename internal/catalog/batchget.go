@@ -0,0 +1,97 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"April32025/internal/api"
+	"April32025/internal/config"
+)
+
+// Requests that name their songs in "songIds", e.g. to re-rank a previous
+// result set, only score those songs. They are fetched with the store's
+// GetByIDs (BatchGetItem for DynamoDB), bypassing the catalog caches, instead of reading the whole catalog. As
+// with the theme index, the generated rules then cover just those songs.
+const (
+	maxSongIds             = 500
+	batchGetChunkSize      = 100 // BatchGetItem's limit per call
+	defaultBatchGetRetries = 3
+)
+
+// Function to check the requested song IDs
+func ValidateSongIds(songIds []string) error {
+	if len(songIds) > maxSongIds {
+		return api.BadRequest("too_many_song_ids", "at most %d songIds are allowed", maxSongIds)
+	}
+	for _, songId := range songIds {
+		if songId == "" {
+			return api.BadRequest("invalid_song_id", "songIds must not be empty")
+		}
+	}
+	return nil
+}
+
+// Function to fetch the listed songs from a catalog; IDs that aren't in the
+// catalog are skipped
+func loadSongs(ctx context.Context, reader catalogReader, c config.Catalog, songIds []string) ([]CountryMusicDocument, error) {
+	seen := make(map[string]bool)
+	var keys []map[string]types.AttributeValue
+	for _, songId := range songIds {
+		if !seen[songId] {
+			seen[songId] = true
+			keys = append(keys, map[string]types.AttributeValue{"RuleID": &types.AttributeValueMemberS{Value: songId}})
+		}
+	}
+
+	var items []map[string]types.AttributeValue
+	for start := 0; start < len(keys); start += batchGetChunkSize {
+		chunk, err := batchGetItems(ctx, reader, c, keys[start:min(start+batchGetChunkSize, len(keys))])
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, chunk...)
+	}
+	fmt.Printf("Loaded %d of %d requested %s songs\n", len(items), len(keys), c.Genre)
+	return extractJSONFromDocuments(items), nil
+}
+
+// Function to get one BatchGetItem's worth of keys, retrying the keys
+// DynamoDB leaves unprocessed when throttled
+func batchGetItems(ctx context.Context, reader catalogReader, c config.Catalog, keys []map[string]types.AttributeValue) ([]map[string]types.AttributeValue, error) {
+	names := map[string]string{}
+	projection := catalogProjection(names)
+
+	retries := batchGetRetryLimit(reader)
+	var items []map[string]types.AttributeValue
+	for attempt := 0; len(keys) > 0; attempt++ {
+		if attempt > retries {
+			return nil, fmt.Errorf("%d keys still unprocessed after %d retries", len(keys), retries)
+		}
+		if attempt > 0 {
+			select {
+			case <-time.After(time.Duration(50<<attempt) * time.Millisecond):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		resp, err := reader.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+			RequestItems: map[string]types.KeysAndAttributes{
+				c.Table: {
+					Keys:                     keys,
+					ProjectionExpression:     projection,
+					ExpressionAttributeNames: names,
+				},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, resp.Responses[c.Table]...)
+		keys = resp.UnprocessedKeys[c.Table].Keys
+	}
+	return items, nil
+}
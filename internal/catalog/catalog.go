@@ -0,0 +1,80 @@
+// Package catalog loads and caches the song catalogs: DynamoDB tables, S3
+// JSON documents and the theme index, together with the catalog writes,
+// quarantine and the generations warm containers use to notice changes.
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"April32025/internal/api"
+	"April32025/internal/config"
+)
+
+// Function to resolve the catalog a request asked for, defaulting to country
+func ResolveCatalog(genre string) (config.Catalog, error) {
+	catalogs := config.ConfiguredCatalogs()
+	if genre == "" {
+		genre = config.DefaultGenre
+	}
+	if c, ok := catalogs[strings.ToLower(genre)]; ok {
+		return c, nil
+	}
+	return config.Catalog{}, api.BadRequest("unknown_genre", "genre must be one of %s", strings.Join(slices.Sorted(maps.Keys(catalogs)), ", "))
+}
+
+// Function to read every song in a catalog
+func LoadCatalog(ctx context.Context, reader catalogReader, c config.Catalog) ([]CountryMusicDocument, error) {
+	names := map[string]string{}
+	input := &dynamodb.ScanInput{
+		TableName:                aws.String(c.Table),
+		ProjectionExpression:     catalogProjection(names),
+		ExpressionAttributeNames: names,
+	}
+	// Theme membership items share the table, see themeindex.go
+	if config.Storage().ThemeIndex != "" {
+		input.FilterExpression = aws.String("attribute_not_exists(#theme)")
+		names["#theme"] = themeIndexThemeAttribute
+	}
+	var items []map[string]types.AttributeValue
+	paginator := dynamodb.NewScanPaginator(reader, input)
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, resp.Items...)
+	}
+	return extractJSONFromDocuments(items), nil
+}
+
+// The attributes extractJSONFromDocuments reads, from the dynamodbav tags on
+// CountryMusicDocument. Catalog reads project only these, so extra attributes
+// added to songs for other tools cost no read capacity here.
+var catalogAttributes = dynamoAttributeNames(CountryMusicDocument{})
+
+// Helper function to build the projection for catalog reads, adding a name
+// placeholder for every attribute since several (year, tier) are DynamoDB
+// reserved words
+func catalogProjection(names map[string]string, extra ...string) *string {
+	placeholders := make([]string, 0, len(catalogAttributes)+len(extra))
+	for i, attribute := range append(append([]string{}, catalogAttributes...), extra...) {
+		placeholder := fmt.Sprintf("#p%d", i)
+		names[placeholder] = attribute
+		placeholders = append(placeholders, placeholder)
+	}
+	return aws.String(strings.Join(placeholders, ", "))
+}
+
+// Helper function to fill in a genre-specific rules prefix, e.g.
+// RULES_PREFIX=rules/{genre}/
+func GenrePath(path string, genre string) string {
+	return strings.ReplaceAll(path, "{genre}", genre)
+}
@@ -0,0 +1,164 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"April32025/internal/config"
+)
+
+// Loaded catalogs are kept across warm invocations for CATALOG_CACHE_SECONDS
+// (0 turns the cache off), so most requests skip DynamoDB entirely. Entries
+// are keyed by genre, plus the selected themes when the theme index is in
+// use; CATALOG_CACHE_MAX_ENTRIES caps how many are kept, dropping the oldest
+// first. Stream updates evict a genre's entries, see handler/streams.go.
+const (
+	defaultCatalogCacheSeconds    = 60
+	defaultCatalogCacheMaxEntries = 32
+)
+
+type catalogCacheEntry struct {
+	genre     string
+	documents []CountryMusicDocument
+	loadedAt  time.Time
+}
+
+var catalogCache = struct {
+	sync.Mutex
+	entries map[string]*catalogCacheEntry
+}{
+	entries: make(map[string]*catalogCacheEntry),
+}
+
+func catalogCacheTTL() time.Duration {
+	seconds, err := strconv.Atoi(config.Env("CATALOG_CACHE_SECONDS", strconv.Itoa(defaultCatalogCacheSeconds)))
+	if err != nil || seconds < 0 {
+		seconds = defaultCatalogCacheSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func catalogCacheMaxEntries() int {
+	entries, err := strconv.Atoi(config.Env("CATALOG_CACHE_MAX_ENTRIES", strconv.Itoa(defaultCatalogCacheMaxEntries)))
+	if err != nil || entries <= 0 {
+		return defaultCatalogCacheMaxEntries
+	}
+	return entries
+}
+
+// Helper function to key a cached load by what it read
+func catalogCacheKey(c config.Catalog, selected map[string]bool) string {
+	if config.Storage().ThemeIndex == "" || len(selected) == 0 {
+		return c.Genre
+	}
+	return c.Genre + "|" + strings.Join(selectedThemeKeys(selected), ",")
+}
+
+// Function to load the songs for a request, from the cache when a fresh
+// enough copy is there. Callers get their own slice, but the documents'
+// maps are shared and must not be modified.
+func LoadCachedCatalog(ctx context.Context, store CatalogStore, c config.Catalog, selected map[string]bool) ([]CountryMusicDocument, error) {
+	ttl := catalogCacheTTL()
+	key := catalogCacheKey(c, selected)
+
+	if ttl > 0 {
+		catalogCache.Lock()
+		entry, ok := catalogCache.entries[key]
+		catalogCache.Unlock()
+		if ok && time.Since(entry.loadedAt) < ttl {
+			fmt.Printf("Catalog cache hit for %s, loaded %v ago\n", key, time.Since(entry.loadedAt).Round(time.Second))
+			return append([]CountryMusicDocument{}, entry.documents...), nil
+		}
+	}
+
+	// Then the cache shared between instances, see sharedcache.go
+	var documents []CountryMusicDocument
+	generation, shared := sharedCacheGeneration(ctx, c.Genre)
+	sharedKey := "catalog:" + generation + ":" + key
+	if !shared || !SharedCacheGet(ctx, sharedKey, &documents) {
+		var err error
+		if documents, err = loadCatalogForSelections(ctx, store, c, selected); err != nil {
+			return nil, err
+		}
+		if shared {
+			SharedCacheSet(ctx, sharedKey, documents)
+		}
+	} else {
+		fmt.Printf("Shared catalog cache hit for %s\n", key)
+	}
+	if ttl == 0 {
+		return documents, nil
+	}
+
+	catalogCache.Lock()
+	catalogCache.entries[key] = &catalogCacheEntry{genre: c.Genre, documents: documents, loadedAt: time.Now()}
+	trimCatalogCache(catalogCacheMaxEntries())
+	catalogCache.Unlock()
+	return append([]CountryMusicDocument{}, documents...), nil
+}
+
+// Helper function to drop the oldest entries beyond the limit; the caller
+// holds the lock
+func trimCatalogCache(maxEntries int) {
+	for len(catalogCache.entries) > maxEntries {
+		oldestKey := ""
+		for key, entry := range catalogCache.entries {
+			if oldestKey == "" || entry.loadedAt.Before(catalogCache.entries[oldestKey].loadedAt) {
+				oldestKey = key
+			}
+		}
+		delete(catalogCache.entries, oldestKey)
+	}
+}
+
+// Function to apply a stream batch to the cached copy of a whole catalog,
+// returning the patched songs. Theme query entries are dropped, since an edit
+// can move a song in or out of them. Reports false when there was no whole
+// catalog cached to patch.
+func PatchCatalogCache(c config.Catalog, change catalogChange) ([]CountryMusicDocument, bool) {
+	catalogCache.Lock()
+	defer catalogCache.Unlock()
+	for key, entry := range catalogCache.entries {
+		if entry.genre == c.Genre && key != c.Genre {
+			delete(catalogCache.entries, key)
+		}
+	}
+	entry, ok := catalogCache.entries[c.Genre]
+	if !ok {
+		return nil, false
+	}
+
+	replaced := make(map[string]bool)
+	for _, songId := range change.Removed {
+		replaced[songId] = true
+	}
+	for _, document := range change.Upserts {
+		replaced[document.RuleID] = true
+	}
+	var documents []CountryMusicDocument
+	for _, document := range entry.documents {
+		if !replaced[document.RuleID] {
+			documents = append(documents, document)
+		}
+	}
+	documents = append(documents, change.Upserts...)
+
+	// Keep the load time, so the TTL still bounds anything a stream missed
+	catalogCache.entries[c.Genre] = &catalogCacheEntry{genre: c.Genre, documents: documents, loadedAt: entry.loadedAt}
+	return append([]CountryMusicDocument{}, documents...), true
+}
+
+// Function to drop every cached load of a catalog
+func EvictCatalogCache(c config.Catalog) {
+	catalogCache.Lock()
+	defer catalogCache.Unlock()
+	for key, entry := range catalogCache.entries {
+		if entry.genre == c.Genre {
+			delete(catalogCache.entries, key)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package catalog
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type CountryMusicDocument struct {
+	RuleID     string         `dynamodbav:"RuleID"`
+	Artist     string         `dynamodbav:"artist"`
+	Title      string         `dynamodbav:"title"`
+	LyricQuote string         `dynamodbav:"lyricQuote"`
+	VideoLink  string         `dynamodbav:"videoLink"`
+	Year       int            `dynamodbav:"year"`
+	Themes     DocumentThemes `dynamodbav:"themes"`
+
+	// How much of the song each theme is, 0-1, for themes stored as numbers
+	// ("heartbreak": 3, "grit": 1) rather than descriptions; see themeweights.go
+	ThemeWeights map[string]float64 `json:"-"`
+
+	// 0-100, higher is more popular; drives the rule's salience and the
+	// popularity boost, see scoring/scoring.go
+	Popularity int `dynamodbav:"popularity"`
+
+	// Beats per minute, 0 when not known
+	Tempo int `dynamodbav:"tempo"`
+
+	// Energy from 1 (sad and slow) to 5 (rowdy), 0 when not rated; see scoring/intensity.go
+	Intensity int `dynamodbav:"intensity"`
+
+	// Streaming service links; filled with search URLs in responses when the catalog has none
+	SpotifyLink      string `dynamodbav:"spotifyLink"`
+	AppleMusicLink   string `dynamodbav:"appleMusicLink"`
+	YouTubeMusicLink string `dynamodbav:"youTubeMusicLink"`
+
+	// Optional theme combinations: the song is only recommended when every
+	// required theme and none of the excluded ones are selected
+	RequiredThemes []string `json:"-" dynamodbav:"requiredThemes"`
+	ExcludedThemes []string `json:"-" dynamodbav:"excludedThemes"`
+
+	// Plan needed to be recommended this song, e.g. "premium"; empty for all
+	Tier string `json:"-" dynamodbav:"tier"`
+
+	// Explicit lyrics, filtered out by the eligibility rules on request
+	Explicit bool `json:"-" dynamodbav:"explicit"`
+
+	// Active window for promotional and seasonal songs, see promos.go
+	ActiveFrom string `json:"-" dynamodbav:"activeFrom"`
+	ExpiresAt  int64  `json:"-" dynamodbav:"expiresAt"`
+
+	// Artist whose song this is a cover of, empty for originals; see scoring/duplicates.go
+	OriginalArtist string `json:"-" dynamodbav:"originalArtist"`
+
+	// Seasons the song is boosted during, e.g. ["christmas"]; see scoring/seasons.go
+	Tags []string `json:"-" dynamodbav:"tags"`
+
+	// Curation details for the song's rule, returned as Recommendation.Rule
+	RuleDescription string `json:"-" dynamodbav:"ruleDescription"`
+	Curator         string `json:"-" dynamodbav:"curator"`
+	RuleCreatedAt   string `json:"-" dynamodbav:"createdAt"`
+
+	// Optional hand-edited rule(s) in Grule's JSON format, used instead of the
+	// generated template. Internal to rule building, never returned to clients.
+	RuleJSON string `json:"-" dynamodbav:"ruleJSON"`
+
+	// Bumped by every conditional write, see songwrites.go; 0 for songs never
+	// written through those helpers
+	Version int `json:"-" dynamodbav:"version"`
+}
+
+// Song intensity scale, see CountryMusicDocument.Intensity
+const (
+	MinIntensity = 1
+	MaxIntensity = 5
+)
+
+// Request theme keys mapped to their theme names. Rules refer to themes by
+// these names; Selected and Importance are keyed by them.
+var ThemeFieldNames = map[string]string{
+	"adventure":          "Adventure",
+	"america":            "America",
+	"carsTrucksTractors": "CarsTrucksTractors",
+	"goodtimes":          "Goodtimes",
+	"grit":               "Grit",
+	"home":               "Home",
+	"love":               "Love",
+	"heartbreak":         "HeartBreak",
+	"lessons":            "Lessons",
+	"rebellion":          "Rebellion",
+}
+
+// Theme names by their lowercase form, so rules generated from catalog theme
+// keys ("Heartbreak") find the theme ("HeartBreak") without reflection
+var themeNamesByLower = func() map[string]string {
+	names := make(map[string]string, len(ThemeFieldNames))
+	for _, name := range ThemeFieldNames {
+		names[strings.ToLower(name)] = name
+	}
+	return names
+}()
+
+// Helper function to resolve any casing of a theme to its theme name
+func CanonicalTheme(theme string) (string, bool) {
+	name, ok := themeNamesByLower[strings.ToLower(theme)]
+	return name, ok
+}
+
+// Function to decode catalog items, by the dynamodbav tags on
+// CountryMusicDocument (see dynamoitem.go). Items that fail to decode or
+// validate are left out and reported, see quarantine.go.
+func extractJSONFromDocuments(items []map[string]types.AttributeValue) []CountryMusicDocument {
+	var recommendations []CountryMusicDocument
+
+	for _, item := range items {
+		var recommendation CountryMusicDocument
+		if err := unmarshalItem(item, &recommendation); err != nil {
+			rejectItem(item, err.Error())
+			continue
+		}
+		applyThemeWeights(&recommendation, item["themes"])
+		if problem := documentProblem(recommendation); problem != "" {
+			rejectItem(item, problem)
+			continue
+		}
+		recommendations = append(recommendations, recommendation)
+	}
+
+	return recommendations
+}
+
+// Helper function to extract a string value from DynamoDB attributes
+func GetStringValue(attr types.AttributeValue) string {
+	if sAttr, ok := attr.(*types.AttributeValueMemberS); ok {
+		return sAttr.Value
+	}
+	return ""
+}
+
+// Helper function to extract a list of strings, stored either as a string
+// set or as a list of strings
+func GetStringListValue(attr types.AttributeValue) []string {
+	switch v := attr.(type) {
+	case *types.AttributeValueMemberSS:
+		return v.Value
+	case *types.AttributeValueMemberL:
+		values := []string{}
+		for _, item := range v.Value {
+			if s := GetStringValue(item); s != "" {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// Helper function to extract a number value (as its string form) from DynamoDB attributes
+func GetNumberValue(attr types.AttributeValue) string {
+	if nAttr, ok := attr.(*types.AttributeValueMemberN); ok {
+		return nAttr.Value
+	}
+	return ""
+}
+
+// Helper function to extract a map of themes
+func extractThemes(attr types.AttributeValue) map[string]string {
+	themes := make(map[string]string)
+	if mAttr, ok := attr.(*types.AttributeValueMemberM); ok {
+		for key, value := range mAttr.Value {
+			themes[key] = GetStringValue(value)
+		}
+	}
+	return themes
+}
+
+// Helper function to copy documents into RuleID order
+func SortedByRuleID(documents []CountryMusicDocument) []CountryMusicDocument {
+	sorted := append([]CountryMusicDocument{}, documents...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].RuleID < sorted[j].RuleID
+	})
+	return sorted
+}
+
+// Helper function to copy a string list into sorted order; string sets come
+// back from DynamoDB in no particular order
+func SortedStrings(values []string) []string {
+	sorted := append([]string{}, values...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// Helper function to derive the rule name for a song. GRL identifiers only
+// allow letters, digits and underscores, so anything else in the RuleID
+// becomes an underscore.
+func RuleNameFor(songId string) string {
+	var name strings.Builder
+	name.WriteString("Check")
+	for _, r := range songId {
+		if r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			name.WriteRune(r)
+		} else {
+			name.WriteRune('_')
+		}
+	}
+	return name.String()
+}
@@ -0,0 +1,56 @@
+package catalog
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Catalog items are decoded by struct tag with attributevalue.UnmarshalMap,
+// so a new song attribute only needs a field on CountryMusicDocument:
+//
+//	Tempo int `dynamodbav:"tempo"`
+//
+// A missing attribute leaves the zero value; one of the wrong type fails the
+// item, which is then quarantined rather than served half decoded. Themes
+// are the exception, since curators may store them as numbers (see
+// themeweights.go), so they decode through DocumentThemes.
+const dynamoTag = "dynamodbav"
+
+// DocumentThemes is a song's theme descriptions. Numeric themes decode as ""
+// here and get their label and weight from applyThemeWeights.
+type DocumentThemes map[string]string
+
+// Function to decode a themes attribute, whatever its values' types
+func (t *DocumentThemes) UnmarshalDynamoDBAttributeValue(attr types.AttributeValue) error {
+	*t = extractThemes(attr)
+	return nil
+}
+
+// Function to decode a DynamoDB item into the tagged fields of the struct out points to
+func unmarshalItem(item map[string]types.AttributeValue, out interface{}) error {
+	return attributevalue.UnmarshalMap(item, out)
+}
+
+// Helper function to read a field's attribute name, "" when it has none
+func dynamoAttributeName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get(dynamoTag), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// Helper function to list the attribute names of a struct's tagged fields
+func dynamoAttributeNames(v interface{}) []string {
+	var names []string
+	t := reflect.TypeOf(v)
+	for i := 0; i < t.NumField(); i++ {
+		if name := dynamoAttributeName(t.Field(i)); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
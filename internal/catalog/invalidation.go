@@ -0,0 +1,207 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"April32025/internal/config"
+)
+
+// Catalog edits reach warm containers two ways.
+//
+// The container that receives the stream batch applies it directly: songs in
+// the records' new images replace their cached copies, removed songs are
+// dropped, and the knowledge base is rebuilt from the patched catalog
+// without a scan. This needs a NEW_IMAGE or NEW_AND_OLD_IMAGES stream; when a
+// record carries no image the catalog is scanned again instead.
+//
+// Every other container learns of the edit from the catalog's generation, a
+// counter bumped for each stream batch that touches it. It lives in
+// CATALOG_VERSIONS_TABLE (key "genre", number "generation") and, when
+// configured, in the shared Redis cache. Requests read it at most every
+// CATALOG_VERSION_CHECK_SECONDS and drop the cached catalog when it moved.
+// Without a versions table, other containers catch up when their cache
+// entries expire.
+const (
+	defaultCatalogVersionCheckSeconds = 5
+	catalogVersionKeyAttribute        = "genre"
+	catalogVersionAttribute           = "generation"
+)
+
+// catalogGenerations is what this container last saw of each genre's
+// generation, and when it last looked
+var catalogGenerations = struct {
+	sync.Mutex
+	known   map[string]int64
+	checked map[string]time.Time
+}{
+	known:   make(map[string]int64),
+	checked: make(map[string]time.Time),
+}
+
+func catalogVersionCheckInterval() time.Duration {
+	seconds, err := strconv.Atoi(config.Env("CATALOG_VERSION_CHECK_SECONDS", strconv.Itoa(defaultCatalogVersionCheckSeconds)))
+	if err != nil || seconds < 0 {
+		seconds = defaultCatalogVersionCheckSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// Function to drop the cached catalog when another container has seen it
+// change since this one loaded it. Failures only log; the cache TTL still
+// bounds how stale a catalog can get.
+func SyncCatalogGeneration(ctx context.Context, svc *dynamodb.Client, c config.Catalog) {
+	table := config.Storage().CatalogVersionsTable
+	if table == "" {
+		return
+	}
+	catalogGenerations.Lock()
+	if time.Since(catalogGenerations.checked[c.Genre]) < catalogVersionCheckInterval() {
+		catalogGenerations.Unlock()
+		return
+	}
+	catalogGenerations.checked[c.Genre] = time.Now()
+	catalogGenerations.Unlock()
+
+	resp, err := svc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(table),
+		Key: map[string]types.AttributeValue{
+			catalogVersionKeyAttribute: &types.AttributeValueMemberS{Value: c.Genre},
+		},
+	})
+	if err != nil {
+		fmt.Printf("Failed to read %s catalog generation: %v\n", c.Genre, err)
+		return
+	}
+	generation, _ := strconv.ParseInt(GetNumberValue(resp.Item[catalogVersionAttribute]), 10, 64)
+
+	catalogGenerations.Lock()
+	known, seen := catalogGenerations.known[c.Genre]
+	catalogGenerations.known[c.Genre] = generation
+	catalogGenerations.Unlock()
+	if seen && generation != known {
+		fmt.Printf("Catalog %s changed elsewhere (generation %d -> %d), dropping cached copy\n", c.Genre, known, generation)
+		EvictCatalogCache(c)
+	}
+}
+
+// Function to record that a catalog changed, for every container to see
+func BumpCatalogGeneration(ctx context.Context, svc *dynamodb.Client, c config.Catalog) error {
+	bumpSharedCacheGeneration(ctx, c.Genre)
+
+	table := config.Storage().CatalogVersionsTable
+	if table == "" {
+		return nil
+	}
+	resp, err := svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(table),
+		Key: map[string]types.AttributeValue{
+			catalogVersionKeyAttribute: &types.AttributeValueMemberS{Value: c.Genre},
+		},
+		UpdateExpression:          aws.String("ADD #generation :one"),
+		ExpressionAttributeNames:  map[string]string{"#generation": catalogVersionAttribute},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":one": &types.AttributeValueMemberN{Value: "1"}},
+		ReturnValues:              types.ReturnValueUpdatedNew,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to bump %s catalog generation: %w", c.Genre, err)
+	}
+	// This container already has the change, so it needn't drop its cache
+	generation, _ := strconv.ParseInt(GetNumberValue(resp.Attributes[catalogVersionAttribute]), 10, 64)
+	catalogGenerations.Lock()
+	catalogGenerations.known[c.Genre] = generation
+	catalogGenerations.Unlock()
+	return nil
+}
+
+// catalogChange is one stream batch's edits to a catalog
+type catalogChange struct {
+	Upserts  []CountryMusicDocument
+	Removed  []string
+	Complete bool // false when some record had no usable image, so a scan is needed
+}
+
+// Function to turn a catalog's stream records into song edits
+func CollectCatalogChange(records []events.DynamoDBEventRecord) catalogChange {
+	change := catalogChange{Complete: true}
+	for _, record := range records {
+		image := record.Change.NewImage
+		if record.EventName == "REMOVE" {
+			image = record.Change.Keys
+		}
+		item := streamImageToItem(image)
+		if _, membership := item[themeIndexThemeAttribute]; membership {
+			// Theme index entries don't change the songs, only the
+			// theme queries, whose cache entries are dropped anyway
+			continue
+		}
+		ruleID := GetStringValue(item["RuleID"])
+		switch {
+		case ruleID == "":
+			change.Complete = false
+		case record.EventName == "REMOVE":
+			change.Removed = append(change.Removed, ruleID)
+		case len(record.Change.NewImage) == 0:
+			change.Complete = false
+		default:
+			documents := extractJSONFromDocuments([]map[string]types.AttributeValue{item})
+			if len(documents) == 0 {
+				// Edited into an invalid song, so its old copy has to go too
+				change.Removed = append(change.Removed, ruleID)
+			}
+			change.Upserts = append(change.Upserts, documents...)
+		}
+	}
+	return change
+}
+
+// Helper function to convert a stream image into the SDK's attribute values
+func streamImageToItem(image map[string]events.DynamoDBAttributeValue) map[string]types.AttributeValue {
+	item := make(map[string]types.AttributeValue, len(image))
+	for name, value := range image {
+		if converted := streamAttributeValue(value); converted != nil {
+			item[name] = converted
+		}
+	}
+	return item
+}
+
+func streamAttributeValue(value events.DynamoDBAttributeValue) types.AttributeValue {
+	switch value.DataType() {
+	case events.DataTypeString:
+		return &types.AttributeValueMemberS{Value: value.String()}
+	case events.DataTypeNumber:
+		return &types.AttributeValueMemberN{Value: value.Number()}
+	case events.DataTypeBoolean:
+		return &types.AttributeValueMemberBOOL{Value: value.Boolean()}
+	case events.DataTypeNull:
+		return &types.AttributeValueMemberNULL{Value: true}
+	case events.DataTypeBinary:
+		return &types.AttributeValueMemberB{Value: value.Binary()}
+	case events.DataTypeStringSet:
+		return &types.AttributeValueMemberSS{Value: value.StringSet()}
+	case events.DataTypeNumberSet:
+		return &types.AttributeValueMemberNS{Value: value.NumberSet()}
+	case events.DataTypeBinarySet:
+		return &types.AttributeValueMemberBS{Value: value.BinarySet()}
+	case events.DataTypeList:
+		var list []types.AttributeValue
+		for _, element := range value.List() {
+			if converted := streamAttributeValue(element); converted != nil {
+				list = append(list, converted)
+			}
+		}
+		return &types.AttributeValueMemberL{Value: list}
+	case events.DataTypeMap:
+		return &types.AttributeValueMemberM{Value: streamImageToItem(value.Map())}
+	}
+	return nil
+}
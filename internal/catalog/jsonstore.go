@@ -0,0 +1,167 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"April32025/internal/config"
+)
+
+// The s3 and memory catalog stores read a genre's catalog from a JSON array
+// of songs laid out like the table's items, so an export of the table loads
+// unchanged:
+//
+//	[{"RuleID": "song-1", "title": "...", "year": 1994, "themes": {"love": "...", "grit": 2}}]
+//
+// CATALOG_OBJECT_KEY (default "catalogs/{genre}.json") and CATALOG_FILE take
+// "{genre}" like RULES_PREFIX. Both stores read whole files, so GetByThemes
+// and GetByIDs filter after loading.
+const defaultCatalogObjectKey = "catalogs/{genre}.json"
+
+// Function to decode a JSON catalog file into songs
+func decodeCatalogJSON(data []byte) ([]CountryMusicDocument, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var raw []map[string]interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+	items := make([]map[string]types.AttributeValue, 0, len(raw))
+	for _, song := range raw {
+		item := make(map[string]types.AttributeValue, len(song))
+		for name, value := range song {
+			item[name] = jsonAttributeValue(value)
+		}
+		items = append(items, item)
+	}
+	return extractJSONFromDocuments(items), nil
+}
+
+// Helper function to convert a decoded JSON value to the DynamoDB attribute
+// it would be stored as
+func jsonAttributeValue(value interface{}) types.AttributeValue {
+	switch v := value.(type) {
+	case string:
+		return &types.AttributeValueMemberS{Value: v}
+	case json.Number:
+		return &types.AttributeValueMemberN{Value: v.String()}
+	case bool:
+		return &types.AttributeValueMemberBOOL{Value: v}
+	case []interface{}:
+		list := make([]types.AttributeValue, 0, len(v))
+		for _, item := range v {
+			list = append(list, jsonAttributeValue(item))
+		}
+		return &types.AttributeValueMemberL{Value: list}
+	case map[string]interface{}:
+		members := make(map[string]types.AttributeValue, len(v))
+		for name, item := range v {
+			members[name] = jsonAttributeValue(item)
+		}
+		return &types.AttributeValueMemberM{Value: members}
+	}
+	return &types.AttributeValueMemberNULL{Value: true}
+}
+
+// s3CatalogStore reads each catalog from a JSON object in CATALOG_BUCKET
+type s3CatalogStore struct {
+	client *s3.Client
+	bucket string
+	key    string
+}
+
+func newS3CatalogStore(cfg aws.Config) (*s3CatalogStore, error) {
+	bucket := config.Env("CATALOG_BUCKET", "")
+	if bucket == "" {
+		return nil, fmt.Errorf("CATALOG_BUCKET is required when CATALOG_STORE=s3")
+	}
+	return &s3CatalogStore{client: config.NewS3Client(cfg), bucket: bucket, key: config.Env("CATALOG_OBJECT_KEY", defaultCatalogObjectKey)}, nil
+}
+
+func (s *s3CatalogStore) GetAll(ctx context.Context, c config.Catalog) ([]CountryMusicDocument, error) {
+	key := GenrePath(s.key, c.Genre)
+	resp, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download catalog s3://%s/%s: %w", s.bucket, key, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalog s3://%s/%s: %w", s.bucket, key, err)
+	}
+	documents, err := decodeCatalogJSON(body)
+	if err != nil {
+		return nil, fmt.Errorf("catalog s3://%s/%s is not a JSON array of songs: %w", s.bucket, key, err)
+	}
+	return documents, nil
+}
+
+func (s *s3CatalogStore) GetByThemes(ctx context.Context, c config.Catalog, themes []string) ([]CountryMusicDocument, error) {
+	documents, err := s.GetAll(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return songsWithThemes(documents, themes), nil
+}
+
+func (s *s3CatalogStore) GetByIDs(ctx context.Context, c config.Catalog, songIds []string) ([]CountryMusicDocument, error) {
+	documents, err := s.GetAll(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return songsWithIDs(documents, songIds), nil
+}
+
+// memoryCatalogStore serves catalogs held in memory, keyed by genre
+type memoryCatalogStore struct {
+	catalogs map[string][]CountryMusicDocument
+}
+
+func newMemoryCatalogStore(catalogs map[string][]CountryMusicDocument) *memoryCatalogStore {
+	return &memoryCatalogStore{catalogs: catalogs}
+}
+
+// Function to fill a memory store from the configured catalogs' JSON files
+func loadMemoryCatalogStore(path string) (*memoryCatalogStore, error) {
+	if path == "" {
+		return nil, fmt.Errorf("CATALOG_FILE is required when CATALOG_STORE=memory")
+	}
+	catalogs := make(map[string][]CountryMusicDocument)
+	for genre := range config.ConfiguredCatalogs() {
+		file := GenrePath(path, genre)
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read catalog file %s: %w", file, err)
+		}
+		if catalogs[genre], err = decodeCatalogJSON(data); err != nil {
+			return nil, fmt.Errorf("catalog file %s is not a JSON array of songs: %w", file, err)
+		}
+	}
+	return newMemoryCatalogStore(catalogs), nil
+}
+
+// Callers get their own slice; like cached catalogs, the documents' maps are
+// shared and must not be modified
+func (s *memoryCatalogStore) GetAll(ctx context.Context, c config.Catalog) ([]CountryMusicDocument, error) {
+	return append([]CountryMusicDocument{}, s.catalogs[c.Genre]...), nil
+}
+
+func (s *memoryCatalogStore) GetByThemes(ctx context.Context, c config.Catalog, themes []string) ([]CountryMusicDocument, error) {
+	return songsWithThemes(s.catalogs[c.Genre], themes), nil
+}
+
+func (s *memoryCatalogStore) GetByIDs(ctx context.Context, c config.Catalog, songIds []string) ([]CountryMusicDocument, error) {
+	return songsWithIDs(s.catalogs[c.Genre], songIds), nil
+}
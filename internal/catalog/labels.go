@@ -0,0 +1,81 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"April32025/internal/config"
+)
+
+// Theme labels are translated in the ThemeTranslations table, one item per locale:
+//
+//	{ "locale": "es", "labels": { "carsTrucksTractors": "Autos, camionetas y tractores", ... } }
+//
+// Lookups try the exact locale, then its language ("es-MX" -> "es"), and any
+// theme still missing falls back to the English label below.
+const defaultLocale = "en"
+
+var defaultThemeLabels = map[string]string{
+	"adventure":          "Adventure",
+	"america":            "America",
+	"carsTrucksTractors": "Cars, Trucks & Tractors",
+	"goodtimes":          "Good Times",
+	"grit":               "Grit",
+	"home":               "Home",
+	"love":               "Love",
+	"heartbreak":         "Heartbreak",
+	"lessons":            "Life Lessons",
+	"rebellion":          "Rebellion",
+}
+
+// Function to load the translated labels stored for a single locale
+func getLocaleLabels(ctx context.Context, svc *dynamodb.Client, locale string) (map[string]string, error) {
+	resp, err := svc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(config.Storage().ThemeTranslationsTable),
+		Key: map[string]types.AttributeValue{
+			"locale": &types.AttributeValueMemberS{Value: locale},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Item == nil {
+		return nil, nil
+	}
+	return extractThemes(resp.Item["labels"]), nil
+}
+
+// Function to build the themeLabels map for a response
+func GetThemeLabels(ctx context.Context, svc *dynamodb.Client, locale string) map[string]string {
+	labels := make(map[string]string)
+	for theme, label := range defaultThemeLabels {
+		labels[theme] = label
+	}
+	if locale == "" || strings.EqualFold(locale, defaultLocale) {
+		return labels
+	}
+
+	// Most specific locale last so it overrides the language-only labels
+	candidates := []string{locale}
+	if language, _, found := strings.Cut(locale, "-"); found {
+		candidates = []string{language, locale}
+	}
+	for _, candidate := range candidates {
+		translated, err := getLocaleLabels(ctx, svc, candidate)
+		if err != nil {
+			fmt.Printf("Failed to load theme labels for locale %s: %v\n", candidate, err)
+			continue
+		}
+		for theme, label := range translated {
+			if _, known := defaultThemeLabels[theme]; known && label != "" {
+				labels[theme] = label
+			}
+		}
+	}
+	return labels
+}
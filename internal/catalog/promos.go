@@ -0,0 +1,61 @@
+package catalog
+
+import (
+	"fmt"
+	"time"
+)
+
+// Promotional and seasonal songs, e.g. a holiday playlist, carry an active
+// window on their catalog item:
+//
+//	activeFrom - date or time the song starts being recommended, e.g.
+//	             "2025-12-01" (UTC) or "2025-12-01T06:00:00-05:00"
+//	expiresAt  - Unix seconds after which it stops; make this the table's
+//	             TTL attribute and DynamoDB deletes the item some time later
+//
+// Songs outside their window are dropped after the catalog is loaded rather
+// than when it is read from the table, so a cached catalog still picks up a
+// promo the moment it starts. TTL deletion can lag by a day or two; the
+// expiresAt check is what takes a song out on time.
+
+// Function to drop the songs that aren't active at a given time
+func ActiveSongs(documents []CountryMusicDocument, now time.Time) []CountryMusicDocument {
+	active := make([]CountryMusicDocument, 0, len(documents))
+	skipped := 0
+	for _, document := range documents {
+		if songActive(document, now) {
+			active = append(active, document)
+		} else {
+			skipped++
+		}
+	}
+	if skipped > 0 {
+		fmt.Printf("Skipped %d songs outside their active window\n", skipped)
+	}
+	return active
+}
+
+// Helper function to check a song's active window. A malformed activeFrom
+// is logged and ignored, like other malformed attributes.
+func songActive(document CountryMusicDocument, now time.Time) bool {
+	if document.ExpiresAt > 0 && now.Unix() >= document.ExpiresAt {
+		return false
+	}
+	if document.ActiveFrom == "" {
+		return true
+	}
+	from, err := parseActiveFrom(document.ActiveFrom)
+	if err != nil {
+		fmt.Printf("Ignoring activeFrom '%s' on song %s: %v\n", document.ActiveFrom, document.RuleID, err)
+		return true
+	}
+	return !now.Before(from)
+}
+
+// Helper function to parse an activeFrom date or timestamp
+func parseActiveFrom(value string) (time.Time, error) {
+	if from, err := time.Parse(time.RFC3339, value); err == nil {
+		return from, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
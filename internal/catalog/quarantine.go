@@ -0,0 +1,118 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"April32025/internal/api"
+	"April32025/internal/config"
+)
+
+// Catalog items are checked as they are decoded, and items that would build
+// a broken rule are left out instead of passed downstream: items without a
+// RuleID, items that fail to decode, songs with no recognized theme and no
+// ruleJSON of their own, and songs rated outside the intensity scale.
+//
+// Rejected items are held until the invocation that loaded them reports
+// them, which logs an "InvalidDocuments" metric per genre and, with
+// QUARANTINE_TABLE set, copies each item there keyed by genre (partition)
+// and itemId (sort), with the reason, so curators can fix them. Lambda runs
+// one invocation per container at a time, so whatever is held belongs to the
+// current invocation.
+
+// rejectedItem is a catalog item left out of the catalog and why
+type rejectedItem struct {
+	Item   map[string]types.AttributeValue
+	Reason string
+}
+
+var rejectedItems = struct {
+	sync.Mutex
+	items []rejectedItem
+}{}
+
+// Function to check a decoded song, returning why it can't be used or ""
+func documentProblem(document CountryMusicDocument) string {
+	if document.RuleID == "" {
+		return "missing RuleID"
+	}
+	if document.RuleJSON == "" && !hasRecognizedTheme(document) {
+		return "no recognized themes"
+	}
+	if document.Intensity != 0 && (document.Intensity < MinIntensity || document.Intensity > MaxIntensity) {
+		return fmt.Sprintf("intensity %d is not between %d and %d", document.Intensity, MinIntensity, MaxIntensity)
+	}
+	return ""
+}
+
+// Helper function to check that a song has at least one described theme a
+// request can select
+func hasRecognizedTheme(document CountryMusicDocument) bool {
+	for theme, desc := range document.Themes {
+		if _, ok := ThemeFieldNames[theme]; ok && desc != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Function to hold an item that was left out, for reportRejectedItems
+func rejectItem(item map[string]types.AttributeValue, reason string) {
+	fmt.Printf("Skipping catalog item %s: %s\n", GetStringValue(item["RuleID"]), reason)
+	rejectedItems.Lock()
+	rejectedItems.items = append(rejectedItems.items, rejectedItem{Item: item, Reason: reason})
+	rejectedItems.Unlock()
+}
+
+// Function to take the held items, leaving none
+func TakeRejectedItems() []rejectedItem {
+	rejectedItems.Lock()
+	defer rejectedItems.Unlock()
+	rejected := rejectedItems.items
+	rejectedItems.items = nil
+	return rejected
+}
+
+// Function to report and quarantine the items left out while loading a
+// catalog. Failures are logged; a quarantine that can't be written never
+// fails the load.
+func ReportRejectedItems(ctx context.Context, svc *dynamodb.Client, c config.Catalog) {
+	rejected := TakeRejectedItems()
+	if len(rejected) == 0 {
+		return
+	}
+
+	config.EmitCountMetric(c.Genre, "InvalidDocuments", len(rejected))
+	table := config.Storage().QuarantineTable
+	if table == "" {
+		return
+	}
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	for i, rejection := range rejected {
+		itemID := GetStringValue(rejection.Item["RuleID"])
+		if itemID == "" {
+			itemID = fmt.Sprintf("(no RuleID) %s #%d", api.RequestID(ctx), i)
+		}
+		_, err := svc.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(table),
+			Item: map[string]types.AttributeValue{
+				"genre":         &types.AttributeValueMemberS{Value: c.Genre},
+				"itemId":        &types.AttributeValueMemberS{Value: itemID},
+				"reason":        &types.AttributeValueMemberS{Value: rejection.Reason},
+				"quarantinedAt": &types.AttributeValueMemberN{Value: now},
+				"item":          &types.AttributeValueMemberM{Value: rejection.Item},
+			},
+		})
+		if err != nil {
+			fmt.Printf("Failed to quarantine catalog item %s: %v\n", itemID, err)
+		}
+	}
+	fmt.Printf("Quarantined %d %s catalog items in %s\n", len(rejected), c.Genre, table)
+}
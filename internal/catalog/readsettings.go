@@ -0,0 +1,131 @@
+package catalog
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"April32025/internal/api"
+	"April32025/internal/config"
+)
+
+// Catalog reads (Scan, theme index Query and BatchGetItem) are tuned per
+// caller. Interactive requests, the ones that arrive over HTTP, use:
+//
+//	CATALOG_CONSISTENT_READ   - "true" for strongly consistent reads (default false)
+//	CATALOG_PAGE_SIZE         - items per Scan/Query page, 0 for DynamoDB's 1MB pages
+//	CATALOG_MAX_ATTEMPTS      - SDK attempts per read call, 0 for the SDK default
+//	CATALOG_BATCH_GET_RETRIES - retries of keys BatchGetItem leaves unprocessed
+//
+// Batch jobs (direct invocations and stream rebuilds) read the same settings
+// with a BATCH_ prefix, e.g. BATCH_CATALOG_CONSISTENT_READ=true, falling back
+// to the interactive value when unset. A batch job can then afford
+// consistent reads and more retries while the API stays fast.
+//
+// The settings apply to reads of the table; a catalog served from the
+// in-memory or shared cache is as fresh as CATALOG_CACHE_SECONDS allows.
+type catalogReadSettings struct {
+	ConsistentRead  bool
+	PageSize        int32
+	MaxAttempts     int
+	BatchGetRetries int
+}
+
+// Function to get the read settings for a caller
+func CatalogReadSettingsFor(inv api.Invocation) catalogReadSettings {
+	prefix := "BATCH_"
+	if inv.HTTP {
+		prefix = ""
+	}
+	return catalogReadSettings{
+		ConsistentRead:  readSetting(prefix, "CATALOG_CONSISTENT_READ", "false") == "true",
+		PageSize:        int32(readSettingInt(prefix, "CATALOG_PAGE_SIZE", 0)),
+		MaxAttempts:     readSettingInt(prefix, "CATALOG_MAX_ATTEMPTS", 0),
+		BatchGetRetries: readSettingInt(prefix, "CATALOG_BATCH_GET_RETRIES", defaultBatchGetRetries),
+	}
+}
+
+// Helper function to read a setting, preferring its prefixed variant
+func readSetting(prefix string, key string, fallback string) string {
+	return config.Env(prefix+key, config.Env(key, fallback))
+}
+
+// Helper function to read a non-negative number setting, ignoring bad values
+func readSettingInt(prefix string, key string, fallback int) int {
+	number, err := strconv.Atoi(readSetting(prefix, key, strconv.Itoa(fallback)))
+	if err != nil || number < 0 {
+		return fallback
+	}
+	return number
+}
+
+// catalogReader is the part of the DynamoDB API that catalog reads use
+type catalogReader interface {
+	dynamodb.ScanAPIClient
+	dynamodb.QueryAPIClient
+	BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+}
+
+// tunedCatalogReader applies read settings to every call it passes on to the
+// underlying DynamoDB client
+type tunedCatalogReader struct {
+	reader   catalogReader
+	settings catalogReadSettings
+}
+
+func WithReadSettings(reader catalogReader, settings catalogReadSettings) *tunedCatalogReader {
+	return &tunedCatalogReader{reader: reader, settings: settings}
+}
+
+// Helper function to add the retry setting to a call's options
+func (r *tunedCatalogReader) options(optFns []func(*dynamodb.Options)) []func(*dynamodb.Options) {
+	if r.settings.MaxAttempts == 0 {
+		return optFns
+	}
+	return append(optFns, func(o *dynamodb.Options) {
+		o.RetryMaxAttempts = r.settings.MaxAttempts
+	})
+}
+
+func (r *tunedCatalogReader) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	input := *params
+	if r.settings.ConsistentRead {
+		input.ConsistentRead = &r.settings.ConsistentRead
+	}
+	if r.settings.PageSize > 0 {
+		input.Limit = &r.settings.PageSize
+	}
+	return r.reader.Scan(ctx, &input, r.options(optFns)...)
+}
+
+// Global secondary indexes only support eventually consistent reads, so
+// ConsistentRead is left alone on Query
+func (r *tunedCatalogReader) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	input := *params
+	if r.settings.PageSize > 0 {
+		input.Limit = &r.settings.PageSize
+	}
+	return r.reader.Query(ctx, &input, r.options(optFns)...)
+}
+
+func (r *tunedCatalogReader) BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	input := *params
+	if r.settings.ConsistentRead {
+		input.RequestItems = make(map[string]types.KeysAndAttributes, len(params.RequestItems))
+		for table, request := range params.RequestItems {
+			request.ConsistentRead = &r.settings.ConsistentRead
+			input.RequestItems[table] = request
+		}
+	}
+	return r.reader.BatchGetItem(ctx, &input, r.options(optFns)...)
+}
+
+// Helper function to get how often batchGetItems retries unprocessed keys
+func batchGetRetryLimit(reader catalogReader) int {
+	if tuned, ok := reader.(*tunedCatalogReader); ok {
+		return tuned.settings.BatchGetRetries
+	}
+	return defaultBatchGetRetries
+}
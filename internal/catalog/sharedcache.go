@@ -0,0 +1,142 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"April32025/internal/config"
+)
+
+// The in-memory caches are per container, so every new Lambda instance reads
+// the catalog again. Setting CACHE_REDIS_ADDR (host:port of an ElastiCache
+// for Redis endpoint) adds a cache shared by all instances, consulted on a
+// local miss, for loaded catalogs and generated rules:
+//
+//	CACHE_REDIS_TLS=true        - in-transit encryption, as ElastiCache
+//	                              serverless and most replication groups require
+//	CACHE_REDIS_AUTH_TOKEN      - AUTH token, when the cluster has one
+//	CACHE_REDIS_TTL_SECONDS     - how long entries live, default 300
+//
+// The cache is an optimization only: any Redis failure is logged and the
+// request carries on against DynamoDB. Values are gob encoded, since the
+// documents' internal fields are hidden from JSON.
+const (
+	defaultSharedCacheTTLSeconds = 300
+	sharedCacheKeyPrefix         = "songrecs:"
+	sharedCacheTimeout           = 250 * time.Millisecond
+)
+
+var sharedCacheClient struct {
+	sync.Once
+	client *redis.Client
+}
+
+// Function to get the shared cache client, nil when none is configured. The
+// client pools its connections across warm invocations.
+func SharedCache() *redis.Client {
+	sharedCacheClient.Do(func() {
+		addr := config.Env("CACHE_REDIS_ADDR", "")
+		if addr == "" {
+			return
+		}
+		options := &redis.Options{
+			Addr:         addr,
+			Password:     config.Env("CACHE_REDIS_AUTH_TOKEN", ""),
+			DialTimeout:  sharedCacheTimeout,
+			ReadTimeout:  sharedCacheTimeout,
+			WriteTimeout: sharedCacheTimeout,
+			MaxRetries:   -1, // a miss is cheaper than a retry on the request path
+
+			// Older ElastiCache engines reject CLIENT SETINFO
+			DisableIdentity: true,
+		}
+		if config.Env("CACHE_REDIS_TLS", "false") == "true" {
+			options.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		sharedCacheClient.client = redis.NewClient(options)
+	})
+	return sharedCacheClient.client
+}
+
+func sharedCacheTTL() time.Duration {
+	seconds, err := strconv.Atoi(config.Env("CACHE_REDIS_TTL_SECONDS", strconv.Itoa(defaultSharedCacheTTLSeconds)))
+	if err != nil || seconds <= 0 {
+		seconds = defaultSharedCacheTTLSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// Function to read and decode a shared cache entry, reporting whether it was found
+func SharedCacheGet(ctx context.Context, key string, value interface{}) bool {
+	client := SharedCache()
+	if client == nil {
+		return false
+	}
+	encoded, err := client.Get(ctx, sharedCacheKeyPrefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return false
+	}
+	if err == nil {
+		err = gob.NewDecoder(bytes.NewReader(encoded)).Decode(value)
+	}
+	if err != nil {
+		fmt.Printf("Shared cache read failed for %s: %v\n", key, err)
+		return false
+	}
+	return true
+}
+
+// Function to encode and store a shared cache entry
+func SharedCacheSet(ctx context.Context, key string, value interface{}) {
+	client := SharedCache()
+	if client == nil {
+		return
+	}
+	var encoded bytes.Buffer
+	err := gob.NewEncoder(&encoded).Encode(value)
+	if err == nil {
+		err = client.Set(ctx, sharedCacheKeyPrefix+key, encoded.Bytes(), sharedCacheTTL()).Err()
+	}
+	if err != nil {
+		fmt.Printf("Shared cache write failed for %s: %v\n", key, err)
+	}
+}
+
+// Function to get a genre's cache generation. Stream updates bump it, which
+// retires every shared entry for the genre at once, whatever themes it was
+// loaded for.
+func sharedCacheGeneration(ctx context.Context, genre string) (string, bool) {
+	client := SharedCache()
+	if client == nil {
+		return "", false
+	}
+	generation, err := client.Get(ctx, sharedCacheKeyPrefix+"generation:"+genre).Result()
+	if errors.Is(err, redis.Nil) {
+		return "0", true
+	}
+	if err != nil {
+		fmt.Printf("Shared cache generation read failed for %s: %v\n", genre, err)
+		return "", false
+	}
+	return generation, true
+}
+
+// Function to retire a genre's shared entries after its catalog changed
+func bumpSharedCacheGeneration(ctx context.Context, genre string) {
+	client := SharedCache()
+	if client == nil {
+		return
+	}
+	if err := client.Incr(ctx, sharedCacheKeyPrefix+"generation:"+genre).Err(); err != nil {
+		fmt.Printf("Shared cache generation bump failed for %s: %v\n", genre, err)
+	}
+}
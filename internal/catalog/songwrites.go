@@ -0,0 +1,127 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"April32025/internal/api"
+	"April32025/internal/config"
+)
+
+// Writes to catalog songs (admin edits, listener feedback) use optimistic
+// locking on the song's "version" attribute: the writer passes the version
+// it read, the write only succeeds if the song is still at that version, and
+// the version goes up by one. A writer that lost the race gets a 409
+// "version_conflict" naming the current version, and should re-read and
+// retry rather than overwrite the other change.
+//
+// Songs written before versioning have no version attribute and count as 0,
+// as do songs that don't exist yet.
+const songVersionAttribute = "version"
+
+// Function to write a whole song item if the stored song is still at
+// expectedVersion, returning the version written
+func putSongIfVersion(ctx context.Context, svc *dynamodb.Client, c config.Catalog, item map[string]types.AttributeValue, expectedVersion int) (int, error) {
+	songId := GetStringValue(item["RuleID"])
+	if songId == "" {
+		return 0, api.BadRequest("invalid_song", "song items need a RuleID")
+	}
+	next := expectedVersion + 1
+	versioned := make(map[string]types.AttributeValue, len(item)+1)
+	for name, value := range item {
+		versioned[name] = value
+	}
+	versioned[songVersionAttribute] = &types.AttributeValueMemberN{Value: strconv.Itoa(next)}
+
+	condition, values := versionCondition(expectedVersion)
+	_, err := svc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                           aws.String(c.Table),
+		Item:                                versioned,
+		ConditionExpression:                 condition,
+		ExpressionAttributeNames:            map[string]string{"#version": songVersionAttribute},
+		ExpressionAttributeValues:           values,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	if err != nil {
+		return 0, versionWriteError(c, songId, expectedVersion, err)
+	}
+	return next, nil
+}
+
+// Function to set some of a song's attributes if the song is still at
+// expectedVersion, returning the version written. The song must exist.
+func updateSongIfVersion(ctx context.Context, svc *dynamodb.Client, c config.Catalog, songId string, expectedVersion int, updates map[string]types.AttributeValue) (int, error) {
+	if len(updates) == 0 {
+		return expectedVersion, nil
+	}
+	if _, ok := updates["RuleID"]; ok {
+		return 0, api.BadRequest("invalid_update", "a song's RuleID can't be changed")
+	}
+	next := expectedVersion + 1
+	condition, values := versionCondition(expectedVersion)
+	*condition = "attribute_exists(RuleID) AND (" + *condition + ")"
+	values[":next"] = &types.AttributeValueMemberN{Value: strconv.Itoa(next)}
+	names := map[string]string{"#version": songVersionAttribute}
+
+	// Placeholders for every attribute, since several are reserved words
+	expression := "SET #version = :next"
+	for i, attribute := range slices.Sorted(maps.Keys(updates)) {
+		if attribute == songVersionAttribute {
+			return 0, api.BadRequest("invalid_update", "a song's version is set by the write itself")
+		}
+		names[fmt.Sprintf("#u%d", i)] = attribute
+		values[fmt.Sprintf(":u%d", i)] = updates[attribute]
+		expression += fmt.Sprintf(", #u%d = :u%d", i, i)
+	}
+
+	_, err := svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.Table),
+		Key: map[string]types.AttributeValue{
+			"RuleID": &types.AttributeValueMemberS{Value: songId},
+		},
+		UpdateExpression:                    aws.String(expression),
+		ConditionExpression:                 condition,
+		ExpressionAttributeNames:            names,
+		ExpressionAttributeValues:           values,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	if err != nil {
+		return 0, versionWriteError(c, songId, expectedVersion, err)
+	}
+	return next, nil
+}
+
+// Helper function to build the condition that the stored song is at a version
+func versionCondition(expectedVersion int) (*string, map[string]types.AttributeValue) {
+	values := map[string]types.AttributeValue{
+		":expected": &types.AttributeValueMemberN{Value: strconv.Itoa(expectedVersion)},
+	}
+	if expectedVersion == 0 {
+		return aws.String("attribute_not_exists(#version) OR #version = :expected"), values
+	}
+	return aws.String("#version = :expected"), values
+}
+
+// Helper function to turn a failed conditional write into a version conflict,
+// reporting the version the other writer left behind
+func versionWriteError(c config.Catalog, songId string, expectedVersion int, err error) error {
+	var conditionFailed *types.ConditionalCheckFailedException
+	if !errors.As(err, &conditionFailed) {
+		return api.BackendError(fmt.Sprintf("failed to write %s song %s", c.Genre, songId), err)
+	}
+	if conditionFailed.Item == nil {
+		return &api.RequestError{Status: http.StatusNotFound, Code: "song_not_found", Message: fmt.Sprintf("%s song %s does not exist", c.Genre, songId)}
+	}
+	current, _ := strconv.Atoi(GetNumberValue(conditionFailed.Item[songVersionAttribute]))
+	fmt.Printf("Version conflict writing %s song %s: expected %d, found %d\n", c.Genre, songId, expectedVersion, current)
+	return api.Conflict("version_conflict", "%s song %s is at version %d, not %d; re-read it and retry", c.Genre, songId, current, expectedVersion)
+}
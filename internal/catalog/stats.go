@@ -0,0 +1,91 @@
+package catalog
+
+import (
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"April32025/internal/config"
+)
+
+// The stats action reports how well a catalog covers the themes listeners
+// can pick and which songs lack media, so curators can see gaps such as a
+// theme with only two songs. Themes with fewer than STATS_THIN_THEME_SONGS
+// songs (default 5) are listed as thin, fewest first.
+const defaultThinThemeSongs = 5
+
+// catalogStats is the response to a stats request
+type catalogStats struct {
+	RequestID     string         `json:"requestId"`
+	Genre         string         `json:"genre"`
+	CatalogSize   int            `json:"catalogSize"`
+	Inactive      int            `json:"inactive"` // promotional songs outside their window, see promos.go
+	Rejected      int            `json:"rejected"` // items left out by validation, see quarantine.go
+	ThemeCoverage map[string]int `json:"themeCoverage"`
+	ThinThemes    []string       `json:"thinThemes"`
+	MissingMedia  mediaGaps      `json:"missingMedia"`
+}
+
+// mediaGaps counts the songs without each kind of link or quote
+type mediaGaps struct {
+	VideoLink        int `json:"videoLink"`
+	SpotifyLink      int `json:"spotifyLink"`
+	AppleMusicLink   int `json:"appleMusicLink"`
+	YouTubeMusicLink int `json:"youTubeMusicLink"`
+	LyricQuote       int `json:"lyricQuote"`
+}
+
+func ThinThemeSongs() int {
+	songs, err := strconv.Atoi(config.Env("STATS_THIN_THEME_SONGS", strconv.Itoa(defaultThinThemeSongs)))
+	if err != nil || songs < 0 {
+		return defaultThinThemeSongs
+	}
+	return songs
+}
+
+// Function to compute a catalog's statistics. Coverage is keyed by request
+// theme key and lists every theme, so an uncovered one shows up as 0.
+func ComputeCatalogStats(documents []CountryMusicDocument, now time.Time, thinBelow int) catalogStats {
+	stats := catalogStats{CatalogSize: len(documents), ThemeCoverage: make(map[string]int), ThinThemes: []string{}}
+	for theme := range ThemeFieldNames {
+		stats.ThemeCoverage[theme] = 0
+	}
+
+	for _, document := range documents {
+		if !songActive(document, now) {
+			stats.Inactive++
+		}
+		for theme, desc := range document.Themes {
+			if _, ok := ThemeFieldNames[theme]; ok && desc != "" {
+				stats.ThemeCoverage[theme]++
+			}
+		}
+		if document.VideoLink == "" {
+			stats.MissingMedia.VideoLink++
+		}
+		if document.SpotifyLink == "" {
+			stats.MissingMedia.SpotifyLink++
+		}
+		if document.AppleMusicLink == "" {
+			stats.MissingMedia.AppleMusicLink++
+		}
+		if document.YouTubeMusicLink == "" {
+			stats.MissingMedia.YouTubeMusicLink++
+		}
+		if document.LyricQuote == "" {
+			stats.MissingMedia.LyricQuote++
+		}
+	}
+
+	for _, theme := range slices.Sorted(maps.Keys(stats.ThemeCoverage)) {
+		if stats.ThemeCoverage[theme] < thinBelow {
+			stats.ThinThemes = append(stats.ThinThemes, theme)
+		}
+	}
+	sort.SliceStable(stats.ThinThemes, func(i, j int) bool {
+		return stats.ThemeCoverage[stats.ThinThemes[i]] < stats.ThemeCoverage[stats.ThinThemes[j]]
+	})
+	return stats
+}
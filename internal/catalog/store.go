@@ -0,0 +1,129 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	"April32025/internal/config"
+)
+
+// CatalogStore supplies a catalog's songs to the pipeline. CATALOG_STORE
+// selects one:
+//
+//	dynamodb (default) - the CATALOG_TABLES tables
+//	s3                 - one JSON file per genre at CATALOG_BUCKET/CATALOG_OBJECT_KEY,
+//	                     see jsonstore.go
+//	memory             - JSON files on local disk at CATALOG_FILE, for local
+//	                     runs and tests
+//
+// Themes are catalog theme keys, e.g. "love". GetByThemes returns the songs
+// with at least one of them; it is only used when CATALOG_THEME_INDEX is set,
+// see themeindex.go. GetByIDs skips IDs that aren't in the catalog.
+//
+// There is no DAX read path: its Go client (aws-dax-go-v2) can't be resolved
+// for this module, so a CATALOG_DAX_ENDPOINT left over from an older
+// configuration is reported as an error rather than quietly read around.
+type CatalogStore interface {
+	GetAll(ctx context.Context, c config.Catalog) ([]CountryMusicDocument, error)
+	GetByThemes(ctx context.Context, c config.Catalog, themes []string) ([]CountryMusicDocument, error)
+	GetByIDs(ctx context.Context, c config.Catalog, songIds []string) ([]CountryMusicDocument, error)
+}
+
+const (
+	catalogStoreDynamoDB = "dynamodb"
+	catalogStoreS3       = "s3"
+	catalogStoreMemory   = "memory"
+)
+
+// Function to build the configured catalog store
+func NewCatalogStore(cfg aws.Config, svc *dynamodb.Client, settings catalogReadSettings) (CatalogStore, error) {
+	if config.Env("CATALOG_DAX_ENDPOINT", "") != "" {
+		return nil, fmt.Errorf("CATALOG_DAX_ENDPOINT is set but DAX is not supported; unset it to read the catalog tables directly")
+	}
+	switch config.Env("CATALOG_STORE", catalogStoreDynamoDB) {
+	case catalogStoreDynamoDB:
+		return &dynamoCatalogStore{reader: WithReadSettings(svc, settings)}, nil
+	case catalogStoreS3:
+		return newS3CatalogStore(cfg)
+	case catalogStoreMemory:
+		return loadMemoryCatalogStore(config.Env("CATALOG_FILE", ""))
+	}
+	return nil, fmt.Errorf("unknown CATALOG_STORE '%s', expected dynamodb, s3 or memory", config.Env("CATALOG_STORE", ""))
+}
+
+// dynamoCatalogStore reads the catalog tables: Scan for the whole catalog,
+// the theme index for themes and BatchGetItem for IDs
+type dynamoCatalogStore struct {
+	reader catalogReader
+}
+
+func (s *dynamoCatalogStore) GetAll(ctx context.Context, c config.Catalog) ([]CountryMusicDocument, error) {
+	return LoadCatalog(ctx, s.reader, c)
+}
+
+func (s *dynamoCatalogStore) GetByThemes(ctx context.Context, c config.Catalog, themes []string) ([]CountryMusicDocument, error) {
+	index := config.Storage().ThemeIndex
+	if index == "" {
+		documents, err := LoadCatalog(ctx, s.reader, c)
+		if err != nil {
+			return nil, err
+		}
+		return songsWithThemes(documents, themes), nil
+	}
+
+	seen := make(map[string]bool)
+	var documents []CountryMusicDocument
+	for _, theme := range themes {
+		items, err := queryThemeIndex(ctx, s.reader, c, index, theme)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query %s for theme %s: %w", index, theme, err)
+		}
+		for _, document := range extractJSONFromDocuments(items) {
+			if !seen[document.RuleID] {
+				seen[document.RuleID] = true
+				documents = append(documents, document)
+			}
+		}
+	}
+	fmt.Printf("Loaded %d %s songs from %s for %d themes\n", len(documents), c.Genre, index, len(themes))
+	return documents, nil
+}
+
+func (s *dynamoCatalogStore) GetByIDs(ctx context.Context, c config.Catalog, songIds []string) ([]CountryMusicDocument, error) {
+	return loadSongs(ctx, s.reader, c, songIds)
+}
+
+// Helper function to keep the songs carrying at least one of the themes
+func songsWithThemes(documents []CountryMusicDocument, themes []string) []CountryMusicDocument {
+	var matched []CountryMusicDocument
+	for _, document := range documents {
+		for _, theme := range themes {
+			if _, ok := document.Themes[theme]; ok {
+				matched = append(matched, document)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// Helper function to pick the listed songs, in the order requested and
+// without repeats
+func songsWithIDs(documents []CountryMusicDocument, songIds []string) []CountryMusicDocument {
+	byID := make(map[string]CountryMusicDocument, len(documents))
+	for _, document := range documents {
+		byID[document.RuleID] = document
+	}
+	seen := make(map[string]bool)
+	var matched []CountryMusicDocument
+	for _, songId := range songIds {
+		if document, ok := byID[songId]; ok && !seen[songId] {
+			seen[songId] = true
+			matched = append(matched, document)
+		}
+	}
+	return matched
+}
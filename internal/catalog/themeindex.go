@@ -0,0 +1,88 @@
+package catalog
+
+import (
+	"context"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"April32025/internal/config"
+)
+
+// With CATALOG_THEME_INDEX set, recommendations read only the songs that have
+// at least one selected theme instead of scanning the whole table. Songs
+// without a selected theme can never match their generated rule, so the
+// scores come out the same.
+//
+// The index is a global secondary index on theme membership items stored next
+// to the songs, one per song and theme:
+//
+//	RuleID  = "<song RuleID>#theme#<theme key>"  (table key, unique per item)
+//	theme   = theme key, e.g. "love"              (index partition key)
+//	songId  = the song's RuleID
+//	...     song attributes, projected into the index
+//
+// Songs have no theme attribute, which keeps them out of the index, and the
+// full-table Scan skips membership items. The loaded songs depend on the
+// selection, so the generated rule set does too; pair the index with
+// RULE_SOURCE=facts to keep one cached knowledge base per catalog. Songs
+// with a ruleJSON are only loaded when they carry a selected theme.
+const (
+	themeIndexThemeAttribute = "theme"
+	themeIndexSongAttribute  = "songId"
+)
+
+// Function to read the songs a request can match: the songs with a selected
+// theme when the theme index is configured, every song otherwise
+func loadCatalogForSelections(ctx context.Context, store CatalogStore, c config.Catalog, selected map[string]bool) ([]CountryMusicDocument, error) {
+	if config.Storage().ThemeIndex == "" || len(selected) == 0 {
+		return store.GetAll(ctx, c)
+	}
+	return store.GetByThemes(ctx, c, selectedThemeKeys(selected))
+}
+
+// Helper function to list the catalog theme keys of the selected themes
+func selectedThemeKeys(selected map[string]bool) []string {
+	var keys []string
+	for key, name := range ThemeFieldNames {
+		if selected[name] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Function to read every membership item for one theme, page by page, with
+// each item's RuleID set back to the song's
+func queryThemeIndex(ctx context.Context, reader catalogReader, c config.Catalog, index string, theme string) ([]map[string]types.AttributeValue, error) {
+	names := map[string]string{"#theme": themeIndexThemeAttribute}
+	input := &dynamodb.QueryInput{
+		TableName:                aws.String(c.Table),
+		IndexName:                aws.String(index),
+		KeyConditionExpression:   aws.String("#theme = :theme"),
+		ProjectionExpression:     catalogProjection(names, themeIndexSongAttribute),
+		ExpressionAttributeNames: names,
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":theme": &types.AttributeValueMemberS{Value: theme},
+		},
+	}
+
+	var items []map[string]types.AttributeValue
+	paginator := dynamodb.NewQueryPaginator(reader, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			if songId, ok := item[themeIndexSongAttribute]; ok {
+				item["RuleID"] = songId
+			}
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
@@ -0,0 +1,81 @@
+package catalog
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// A song's themes map usually holds a description per theme:
+//
+//	"themes": { "heartbreak": "Left at the altar", "grit": "Keeps on driving" }
+//
+// Curators can instead give numbers, saying how much of the song each theme
+// is, and may mix the two; a description counts as weight 1:
+//
+//	"themes": { "heartbreak": 3, "grit": 1 }
+//
+// Weights are relative, scaled so the song's strongest theme is 1, and a
+// matched theme's points are multiplied by its weight. The song above earns
+// full points for heartbreak and a third for grit. Weighted themes show their
+// English label as the description.
+
+// Function to read numeric theme weights from an item's themes attribute
+// into the document
+func applyThemeWeights(document *CountryMusicDocument, attr types.AttributeValue) {
+	mAttr, ok := attr.(*types.AttributeValueMemberM)
+	if !ok {
+		return
+	}
+	weights := make(map[string]float64)
+	strongest, numeric := 0.0, false
+	for key, value := range mAttr.Value {
+		weight := 1.0
+		if nAttr, ok := value.(*types.AttributeValueMemberN); ok {
+			parsed, err := strconv.ParseFloat(nAttr.Value, 64)
+			if err != nil || parsed <= 0 {
+				continue
+			}
+			weight, numeric = parsed, true
+			if document.Themes[key] == "" {
+				document.Themes[key] = themeLabel(key)
+			}
+		} else if document.Themes[key] == "" {
+			continue
+		}
+		// Unknown themes never match, so they need no weight
+		if name, known := CanonicalTheme(key); known {
+			weights[name] = weight
+			strongest = math.Max(strongest, weight)
+		}
+	}
+
+	// Only songs that gave a number need weights; the rest score as before
+	if !numeric || strongest == 0 {
+		return
+	}
+	for name, weight := range weights {
+		weights[name] = weight / strongest
+	}
+	document.ThemeWeights = weights
+}
+
+// Helper function to get a theme's English label, or its key when it has none
+func themeLabel(key string) string {
+	if label, ok := defaultThemeLabels[key]; ok {
+		return label
+	}
+	return key
+}
+
+// Function to collect the weighted songs' theme weights for UserSelections
+func ThemeWeightsBySong(documents []CountryMusicDocument) map[string]map[string]float64 {
+	weights := make(map[string]map[string]float64)
+	for _, document := range documents {
+		if document.ThemeWeights != nil {
+			weights[document.RuleID] = document.ThemeWeights
+		}
+	}
+	return weights
+}
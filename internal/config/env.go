@@ -0,0 +1,11 @@
+package config
+
+import "os"
+
+// Helper function to read an environment variable with a fallback value
+func Env(key string, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
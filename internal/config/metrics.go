@@ -0,0 +1,102 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+// Rule engine cost is published as CloudWatch metrics using the embedded
+// metric format: one JSON log line per request that CloudWatch Logs turns
+// into metrics under METRICS_NAMESPACE, dimensioned by genre, without an API
+// call on the request path. Durations are summed across shards, so they track
+// the work done rather than the wall time.
+const defaultMetricsNamespace = "SongRecs"
+
+// RuleMetrics is what one request spent on its rules
+type RuleMetrics struct {
+	ExtractRules time.Duration // rendering or loading the GRL
+	BuildRules   time.Duration // BuildRuleFromResource, zero on cache hits
+	Execute      time.Duration // engine execution, overrides included
+	RuleCount    int           // rules in the knowledge bases
+	RulesBuilt   int           // rules compiled by this request
+	RulesFired   int
+	Cycles       uint64
+}
+
+type EmfMetric struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+type emfDirective struct {
+	Namespace  string      `json:"Namespace"`
+	Dimensions [][]string  `json:"Dimensions"`
+	Metrics    []EmfMetric `json:"Metrics"`
+}
+
+// Function to write a request's rule metrics to the log in embedded metric format
+func EmitRuleMetrics(genre string, metrics RuleMetrics) {
+	emitMetrics(genre, []EmfMetric{
+		{Name: "ExtractRulesMs", Unit: "Milliseconds"},
+		{Name: "BuildRulesMs", Unit: "Milliseconds"},
+		{Name: "ExecuteMs", Unit: "Milliseconds"},
+		{Name: "RuleCount", Unit: "Count"},
+		{Name: "RulesBuilt", Unit: "Count"},
+		{Name: "RulesFired", Unit: "Count"},
+		{Name: "Cycles", Unit: "Count"},
+	}, map[string]interface{}{
+		"ExtractRulesMs": durationMs(metrics.ExtractRules),
+		"BuildRulesMs":   durationMs(metrics.BuildRules),
+		"ExecuteMs":      durationMs(metrics.Execute),
+		"RuleCount":      metrics.RuleCount,
+		"RulesBuilt":     metrics.RulesBuilt,
+		"RulesFired":     metrics.RulesFired,
+		"Cycles":         metrics.Cycles,
+	})
+}
+
+// Function to write a single count metric, e.g. InvalidDocuments
+func EmitCountMetric(genre string, name string, count int) {
+	emitMetrics(genre, []EmfMetric{{Name: name, Unit: "Count"}}, map[string]interface{}{name: count})
+}
+
+// Helper function to write one embedded metric format line for a genre
+func emitMetrics(genre string, metrics []EmfMetric, values map[string]interface{}) {
+	EmitDimensionedMetrics(map[string]string{"Genre": genre}, metrics, values)
+}
+
+// Helper function to write one embedded metric format line with the given
+// dimensions, e.g. genre and experiment variant
+func EmitDimensionedMetrics(dimensions map[string]string, metrics []EmfMetric, values map[string]interface{}) {
+	line := map[string]interface{}{
+		"_aws": map[string]interface{}{
+			"Timestamp": time.Now().UnixMilli(),
+			"CloudWatchMetrics": []emfDirective{{
+				Namespace:  Env("METRICS_NAMESPACE", defaultMetricsNamespace),
+				Dimensions: [][]string{slices.Sorted(maps.Keys(dimensions))},
+				Metrics:    metrics,
+			}},
+		},
+	}
+	for name, value := range dimensions {
+		line[name] = value
+	}
+	for name, value := range values {
+		line[name] = value
+	}
+	encoded, err := json.Marshal(line)
+	if err != nil {
+		fmt.Println("Failed to encode metrics: " + err.Error())
+		return
+	}
+	fmt.Println(string(encoded))
+}
+
+// Helper function to report a duration in fractional milliseconds, since
+// cached builds and small catalogs finish well under a millisecond
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// For development the whole pipeline can run against DynamoDB Local or
+// LocalStack instead of AWS:
+//
+//	DYNAMODB_ENDPOINT - e.g. "http://localhost:8000" for DynamoDB Local
+//	S3_ENDPOINT       - e.g. "http://localhost:4566" for LocalStack; path-style
+//	                    addressing is used, since local endpoints have no
+//	                    bucket subdomains
+//
+// With either set, requests are signed with static credentials from
+// LOCAL_ACCESS_KEY_ID and LOCAL_SECRET_ACCESS_KEY (both default "local"),
+// which the emulators accept, so no AWS account or profile is needed.
+
+// The configuration is loaded once per container and kept across warm
+// invocations, so every client shares one retryer and its throttling state
+var sdkConfig struct {
+	sync.Mutex
+	cfg    aws.Config
+	loaded bool
+}
+
+// Function to get the SDK configuration every client is built from, loading
+// it on the first call; a failed load is retried by the next one
+func LoadSDKConfig(ctx context.Context) (aws.Config, error) {
+	sdkConfig.Lock()
+	defer sdkConfig.Unlock()
+	if sdkConfig.loaded {
+		return sdkConfig.cfg, nil
+	}
+
+	options := []func(*config.LoadOptions) error{
+		config.WithRegion(Storage().Region),
+		sdkRetryer(),
+	}
+	if localEndpoints() {
+		fmt.Println("Using local endpoints with static credentials")
+		options = append(options, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
+			Env("LOCAL_ACCESS_KEY_ID", "local"),
+			Env("LOCAL_SECRET_ACCESS_KEY", "local"),
+			"",
+		)))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return cfg, err
+	}
+	sdkConfig.cfg, sdkConfig.loaded = cfg, true
+	return cfg, nil
+}
+
+func localEndpoints() bool {
+	return Env("DYNAMODB_ENDPOINT", "") != "" || Env("S3_ENDPOINT", "") != ""
+}
+
+// Function to create a DynamoDB client, honoring DYNAMODB_ENDPOINT
+func NewDynamoDBClient(cfg aws.Config) *dynamodb.Client {
+	return dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+		if endpoint := Env("DYNAMODB_ENDPOINT", ""); endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+}
+
+// Function to create an S3 client, honoring S3_ENDPOINT
+func NewS3Client(cfg aws.Config) *s3.Client {
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint := Env("S3_ENDPOINT", ""); endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		}
+	})
+}
@@ -0,0 +1,192 @@
+// Package config reads the Lambda's environment: storage settings, the AWS
+// SDK configuration and its retries on throttling, and the metrics the
+// other packages emit.
+package config
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// StorageSettings names the AWS resources the function reads and writes, so
+// dev, stage and prod can each point at their own tables:
+//
+//	STORAGE_REGION           - region of the tables and buckets; defaults to
+//	                           the function's AWS_REGION, then us-east-2
+//	CATALOG_TABLES           - genre=table pairs, see catalog/catalog.go
+//	CATALOG_THEME_INDEX      - theme membership index, see catalog/themeindex.go
+//	CATALOG_VERSIONS_TABLE   - catalog generations, see catalog/invalidation.go
+//	HISTORY_TABLE            - served recommendations, see scoring/history.go
+//	QUARANTINE_TABLE         - catalog items that failed validation, see catalog/quarantine.go
+//	CONFIG_TABLE             - runtime settings such as scoring, see scoring/scoring.go,
+//	                           and the learned ranker, see scoring/ranker.go
+//	COUNTERS_TABLE           - served and accepted counts, see scoring/collaborative.go
+//	SEASONS_TABLE            - seasonal boost windows, see scoring/seasons.go
+//	ARTIST_RELATIONS_TABLE   - related artists for artist affinity, see scoring/affinity.go
+//	IDEMPOTENCY_TABLE, THEME_BUNDLES_TABLE, THEME_TRANSLATIONS_TABLE
+//
+// They are read and validated once, at cold start: a typo fails the init
+// rather than every request.
+type StorageSettings struct {
+	Region                 string
+	Catalogs               map[string]Catalog
+	ThemeIndex             string
+	CatalogVersionsTable   string
+	HistoryTable           string
+	QuarantineTable        string
+	ConfigTable            string
+	CountersTable          string
+	SeasonsTable           string
+	ArtistRelationsTable   string
+	IdempotencyTable       string
+	ThemeBundlesTable      string
+	ThemeTranslationsTable string
+}
+
+const (
+	defaultRegion = "us-east-2"
+
+	defaultIdempotencyTable       = "RecommendationIdempotency"
+	defaultThemeBundlesTable      = "ThemeBundles"
+	defaultThemeTranslationsTable = "ThemeTranslations"
+)
+
+var (
+	regionPattern = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-[0-9]+$`)
+	// DynamoDB table and index names: 3-255 letters, digits, _ - and .
+	tableNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{3,255}$`)
+)
+
+var loadedStorageSettings struct {
+	sync.Once
+	settings StorageSettings
+	err      error
+}
+
+// Function to get the storage settings, loading them on first use
+func GetStorageSettings() (StorageSettings, error) {
+	loadedStorageSettings.Do(func() {
+		loadedStorageSettings.settings, loadedStorageSettings.err = loadStorageSettings()
+	})
+	return loadedStorageSettings.settings, loadedStorageSettings.err
+}
+
+// Helper function for the many places that only need a setting; the
+// settings were validated at cold start, see main
+func Storage() StorageSettings {
+	settings, _ := GetStorageSettings()
+	return settings
+}
+
+// Function to read and validate the storage settings from the environment
+func loadStorageSettings() (StorageSettings, error) {
+	settings := StorageSettings{
+		Region:                 Env("STORAGE_REGION", Env("AWS_REGION", defaultRegion)),
+		ThemeIndex:             Env("CATALOG_THEME_INDEX", ""),
+		CatalogVersionsTable:   Env("CATALOG_VERSIONS_TABLE", ""),
+		HistoryTable:           Env("HISTORY_TABLE", ""),
+		QuarantineTable:        Env("QUARANTINE_TABLE", ""),
+		ConfigTable:            Env("CONFIG_TABLE", ""),
+		CountersTable:          Env("COUNTERS_TABLE", ""),
+		SeasonsTable:           Env("SEASONS_TABLE", ""),
+		ArtistRelationsTable:   Env("ARTIST_RELATIONS_TABLE", ""),
+		IdempotencyTable:       Env("IDEMPOTENCY_TABLE", defaultIdempotencyTable),
+		ThemeBundlesTable:      Env("THEME_BUNDLES_TABLE", defaultThemeBundlesTable),
+		ThemeTranslationsTable: Env("THEME_TRANSLATIONS_TABLE", defaultThemeTranslationsTable),
+	}
+	if !regionPattern.MatchString(settings.Region) {
+		return settings, fmt.Errorf("STORAGE_REGION '%s' is not an AWS region", settings.Region)
+	}
+
+	catalogs, err := parseCatalogTables(Env("CATALOG_TABLES", defaultCatalogTables))
+	if err != nil {
+		return settings, err
+	}
+	settings.Catalogs = catalogs
+
+	names := map[string]string{
+		"IDEMPOTENCY_TABLE":        settings.IdempotencyTable,
+		"THEME_BUNDLES_TABLE":      settings.ThemeBundlesTable,
+		"THEME_TRANSLATIONS_TABLE": settings.ThemeTranslationsTable,
+	}
+	if settings.ThemeIndex != "" {
+		names["CATALOG_THEME_INDEX"] = settings.ThemeIndex
+	}
+	if settings.CatalogVersionsTable != "" {
+		names["CATALOG_VERSIONS_TABLE"] = settings.CatalogVersionsTable
+	}
+	if settings.HistoryTable != "" {
+		names["HISTORY_TABLE"] = settings.HistoryTable
+	}
+	if settings.QuarantineTable != "" {
+		names["QUARANTINE_TABLE"] = settings.QuarantineTable
+	}
+	if settings.ConfigTable != "" {
+		names["CONFIG_TABLE"] = settings.ConfigTable
+	}
+	if settings.CountersTable != "" {
+		names["COUNTERS_TABLE"] = settings.CountersTable
+	}
+	if settings.SeasonsTable != "" {
+		names["SEASONS_TABLE"] = settings.SeasonsTable
+	}
+	if settings.ArtistRelationsTable != "" {
+		names["ARTIST_RELATIONS_TABLE"] = settings.ArtistRelationsTable
+	}
+	for _, key := range slices.Sorted(maps.Keys(names)) {
+		if !tableNamePattern.MatchString(names[key]) {
+			return settings, fmt.Errorf("%s '%s' is not a valid DynamoDB name", key, names[key])
+		}
+	}
+	return settings, nil
+}
+
+// Function to parse CATALOG_TABLES, e.g. "country=CountryMusicRepo,folk=FolkMusicRepo"
+func parseCatalogTables(value string) (map[string]Catalog, error) {
+	catalogs := make(map[string]Catalog)
+	for _, entry := range strings.Split(value, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		genre, table, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		genre = strings.ToLower(strings.TrimSpace(genre))
+		table = strings.TrimSpace(table)
+		if !ok || genre == "" || table == "" {
+			return nil, fmt.Errorf("CATALOG_TABLES entry '%s' is not genre=table", entry)
+		}
+		if !tableNamePattern.MatchString(table) {
+			return nil, fmt.Errorf("CATALOG_TABLES table '%s' is not a valid DynamoDB name", table)
+		}
+		if _, dup := catalogs[genre]; dup {
+			return nil, fmt.Errorf("CATALOG_TABLES lists genre '%s' twice", genre)
+		}
+		catalogs[genre] = Catalog{Genre: genre, Table: table}
+	}
+	return catalogs, nil
+}
+
+// A catalog is one genre's song table. CATALOG_TABLES lists them as
+// genre=table pairs, e.g. "country=CountryMusicRepo,folk=FolkMusicRepo", and
+// requests pick one with "genre". Everything derived from a catalog is kept
+// per genre: knowledge bases (so rules built from one genre's songs never
+// fire for another), in-memory and shared cache entries, catalog
+// generations, rule prefixes ("{genre}" in RULES_PREFIX), audit paths and
+// metrics. Genres may share a table; stream updates then refresh them all.
+const (
+	DefaultGenre         = "country"
+	defaultCatalogTables = DefaultGenre + "=CountryMusicRepo"
+)
+
+type Catalog struct {
+	Genre string
+	Table string
+}
+
+// Function to get the configured catalogs keyed by genre
+func ConfiguredCatalogs() map[string]Catalog {
+	return Storage().Catalogs
+}
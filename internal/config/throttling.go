@@ -0,0 +1,45 @@
+package config
+
+import (
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// SDK clients retry in adaptive mode by default: on top of the standard
+// exponential backoff, a client-side rate limiter slows every call down once
+// DynamoDB starts throttling, rather than each request hammering the table
+// through its own retries. The SDK configuration is loaded once per
+// container and hands every client the same retryer, so the rate limiter
+// learns from all of a warm container's calls, not just one request's.
+//
+//	AWS_SDK_RETRY_MODE   - "adaptive" (default) or "standard"
+//	AWS_SDK_MAX_ATTEMPTS - attempts per call, including the first (default 5)
+const defaultSDKMaxAttempts = 5
+
+// Function to get the retryer option for LoadSDKConfig. The SDK calls the
+// option's function for every client it builds, so it returns one shared
+// retryer rather than making a new one each time.
+func sdkRetryer() config.LoadOptionsFunc {
+	maxAttempts, err := strconv.Atoi(Env("AWS_SDK_MAX_ATTEMPTS", strconv.Itoa(defaultSDKMaxAttempts)))
+	if err != nil || maxAttempts <= 0 {
+		maxAttempts = defaultSDKMaxAttempts
+	}
+	standard := func(o *retry.StandardOptions) {
+		o.MaxAttempts = maxAttempts
+	}
+
+	var retryer aws.Retryer
+	if Env("AWS_SDK_RETRY_MODE", string(aws.RetryModeAdaptive)) == string(aws.RetryModeStandard) {
+		retryer = retry.NewStandard(standard)
+	} else {
+		retryer = retry.NewAdaptiveMode(func(o *retry.AdaptiveModeOptions) {
+			o.StandardOptions = append(o.StandardOptions, standard)
+		})
+	}
+	return config.WithRetryer(func() aws.Retryer {
+		return retryer
+	})
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	"April32025/internal/api"
+	"April32025/internal/catalog"
+	"April32025/internal/config"
+	"April32025/internal/respond"
+	"April32025/internal/rules"
+	"April32025/internal/scoring"
+)
+
+// Request actions, picked with "action":
+//
+//	recommend (default) - score the catalog and return the best matches
+//	validateRules       - report problems with the catalog's rules, see rules/validate.go
+//	previewMatches      - list the songs the rules match, without scoring, see preview.go
+//	stats               - theme coverage and media gaps, see catalog/stats.go
+//	accept              - count songs as accepted in their segment, see scoring/collaborative.go
+//
+// and the snapshot maintenance actions in snapshot.go.
+const (
+	actionRecommend      = "recommend"
+	actionValidateRules  = "validateRules"
+	actionPreviewMatches = "previewMatches"
+	actionStats          = "stats"
+	actionAccept         = "accept"
+)
+
+// acceptReport is the response to an accept request
+type acceptReport struct {
+	RequestID string `json:"requestId"`
+	Genre     string `json:"genre"`
+	Segment   string `json:"segment"`
+	Accepted  int    `json:"accepted"`
+}
+
+// Function to answer an accept request by counting its songs as accepted
+func acceptSongs(ctx context.Context, svc *dynamodb.Client, c config.Catalog, p *scoring.UserSelections, incoming api.IncomingRequest, inv api.Invocation) (respond.RenderedResponse, error) {
+	if config.Storage().CountersTable == "" {
+		return respond.RenderedResponse{}, api.BadRequest("counters_disabled", "COUNTERS_TABLE is not configured")
+	}
+	userID := api.RequestUserID(incoming, inv)
+	if userID == "" {
+		return respond.RenderedResponse{}, api.Forbidden("accept_needs_user", "accept needs a signed-in userId")
+	}
+	segment := scoring.SelectionSegment(c, p)
+	if segment == "" || len(incoming.SongIds) == 0 {
+		return respond.RenderedResponse{}, api.BadRequest("invalid_accept", "accept needs the selected themes and the accepted songIds")
+	}
+
+	report := acceptReport{RequestID: api.RequestID(ctx), Genre: c.Genre, Segment: segment}
+	report.Accepted = scoring.RecordAccepts(ctx, svc, segment, userID, incoming.SongIds)
+	body, err := json.Marshal(report)
+	if err != nil {
+		return respond.RenderedResponse{}, api.BackendError("failed to serialize response", err)
+	}
+	return respond.RenderedResponse{StatusCode: http.StatusOK, ContentType: "application/json", Body: body}, nil
+}
+
+// Function to answer a validateRules request with the catalog's rule report
+func validateCatalogRules(ctx context.Context, cfg aws.Config, store catalog.CatalogStore, c config.Catalog) (respond.RenderedResponse, error) {
+	documents, err := store.GetAll(ctx, c)
+	if err != nil {
+		return respond.RenderedResponse{}, api.BackendError("failed to scan catalog", err)
+	}
+	ruleSource, err := rules.NewRuleSource(cfg, c)
+	if err != nil {
+		return respond.RenderedResponse{}, api.BackendError("invalid rule source configuration", err)
+	}
+
+	report := rules.ValidateRules(ctx, c, documents, ruleSource)
+	body, err := json.Marshal(report)
+	if err != nil {
+		return respond.RenderedResponse{}, api.BackendError("failed to serialize response", err)
+	}
+	return respond.RenderedResponse{StatusCode: http.StatusOK, ContentType: "application/json", Body: body}, nil
+}
+
+// Function to answer a stats request from the whole catalog
+func catalogStatsResponse(ctx context.Context, store catalog.CatalogStore, c config.Catalog) (respond.RenderedResponse, error) {
+	documents, err := store.GetAll(ctx, c)
+	if err != nil {
+		return respond.RenderedResponse{}, api.BackendError("failed to scan catalog", err)
+	}
+	stats := catalog.ComputeCatalogStats(documents, time.Now(), catalog.ThinThemeSongs())
+	stats.RequestID = api.RequestID(ctx)
+	stats.Genre = c.Genre
+	stats.Rejected = len(catalog.TakeRejectedItems())
+
+	body, err := json.Marshal(stats)
+	if err != nil {
+		return respond.RenderedResponse{}, api.BackendError("failed to serialize response", err)
+	}
+	return respond.RenderedResponse{StatusCode: http.StatusOK, ContentType: "application/json", Body: body}, nil
+}
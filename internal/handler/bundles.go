@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"April32025/internal/api"
+	"April32025/internal/catalog"
+	"April32025/internal/config"
+)
+
+// A listening context ("roadTrip", "workout", "breakup", "backyardBBQ") names
+// a bundle of themes stored in the ThemeBundles table:
+//
+//	{ "context": "roadTrip", "themes": { "adventure": 5, "carsTrucksTractors": 4, "goodtimes": 3 } }
+//
+// Each theme in the bundle is selected and its number is used as the
+// importance rating. Anything the request sets explicitly wins over the bundle.
+
+// Function to load the theme bundle for a listening context
+func getThemeBundle(ctx context.Context, svc *dynamodb.Client, listeningContext string) (map[string]int, error) {
+	resp, err := svc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(config.Storage().ThemeBundlesTable),
+		Key: map[string]types.AttributeValue{
+			"context": &types.AttributeValueMemberS{Value: listeningContext},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Item == nil {
+		return nil, fmt.Errorf("no theme bundle for context '%s'", listeningContext)
+	}
+
+	bundle := make(map[string]int)
+	if mAttr, ok := resp.Item["themes"].(*types.AttributeValueMemberM); ok {
+		for theme, value := range mAttr.Value {
+			weight, err := strconv.Atoi(catalog.GetNumberValue(value))
+			if err != nil {
+				fmt.Printf("Skipping theme %s in bundle %s, weight is not a whole number\n", theme, listeningContext)
+				continue
+			}
+			bundle[theme] = weight
+		}
+	}
+	return bundle, nil
+}
+
+// Function to merge a listening context's theme bundle into the request
+func applyThemeBundle(ctx context.Context, svc *dynamodb.Client, incoming *api.IncomingRequest) {
+	bundle, err := getThemeBundle(ctx, svc, incoming.Context)
+	if err != nil {
+		fmt.Println("Unable to expand listening context, using request themes only:", err)
+		return
+	}
+	fmt.Printf("Expanding context %s into bundle: %v\n", incoming.Context, bundle)
+
+	if incoming.Themes == nil {
+		incoming.Themes = make(map[string]bool)
+	}
+	if incoming.Importance == nil {
+		incoming.Importance = make(map[string]int)
+	}
+	for theme, weight := range bundle {
+		if _, explicit := incoming.Themes[theme]; explicit {
+			continue
+		}
+		if _, explicit := incoming.Importance[theme]; explicit {
+			continue
+		}
+		incoming.Themes[theme] = true
+		incoming.Importance[theme] = weight
+	}
+}
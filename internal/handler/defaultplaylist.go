@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"April32025/internal/api"
+	"April32025/internal/catalog"
+	"April32025/internal/config"
+	"April32025/internal/respond"
+	"April32025/internal/rules"
+	"April32025/internal/scoring"
+)
+
+// A request that ends up with no themes selected, because it sent none or
+// only switched them off, would score nothing and come back 404. With a
+// default playlist configured it gets that instead: DEFAULT_PLAYLIST lists
+// the songs' RuleIDs, comma-separated and in order, and the "songIds" list of
+// the "DefaultPlaylist" item of CONFIG_TABLE, when present, replaces it
+// without a deploy. The item is re-read with the scoring config, every
+// SCORING_CACHE_SECONDS. Songs not in the requested genre's catalog, out of
+// their active window or ineligible are skipped, so one playlist can list
+// songs from every genre. Eligibility is the same stage scoring runs, so a
+// premium-only song in the playlist only reaches premium listeners.
+//
+// The playlist is served in its own order with scores of 0, paged like any
+// other result, and flagged with "defaultPlaylist" in the response. Like a
+// scored response it is stored for the request's idempotencyKey.
+const defaultPlaylistConfigID = "DefaultPlaylist"
+
+var defaultPlaylistCache = struct {
+	sync.Mutex
+	songIds  []string
+	loadedAt time.Time
+}{}
+
+// Function to get the default playlist's RuleIDs, empty when none is
+// configured. Lookup failures fall back to DEFAULT_PLAYLIST.
+func loadDefaultPlaylist(ctx context.Context, svc *dynamodb.Client) []string {
+	var songIds []string
+	for _, songId := range strings.Split(config.Env("DEFAULT_PLAYLIST", ""), ",") {
+		if songId = strings.TrimSpace(songId); songId != "" {
+			songIds = append(songIds, songId)
+		}
+	}
+	table := config.Storage().ConfigTable
+	if table == "" {
+		return songIds
+	}
+
+	defaultPlaylistCache.Lock()
+	defer defaultPlaylistCache.Unlock()
+	if !defaultPlaylistCache.loadedAt.IsZero() && time.Since(defaultPlaylistCache.loadedAt) < scoring.ScoringCacheTTL() {
+		return defaultPlaylistCache.songIds
+	}
+
+	resp, err := svc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(table),
+		Key: map[string]types.AttributeValue{
+			"configId": &types.AttributeValueMemberS{Value: defaultPlaylistConfigID},
+		},
+	})
+	if err != nil {
+		fmt.Println("Failed to load default playlist, using DEFAULT_PLAYLIST:", err)
+		return songIds
+	}
+	if configured := catalog.GetStringListValue(resp.Item["songIds"]); len(configured) > 0 {
+		songIds = configured
+	}
+	defaultPlaylistCache.songIds = songIds
+	defaultPlaylistCache.loadedAt = time.Now()
+	return songIds
+}
+
+// Function to answer a request without selected themes with the default
+// playlist
+func defaultPlaylistResponse(ctx context.Context, cfg aws.Config, svc *dynamodb.Client, store catalog.CatalogStore, c config.Catalog, event json.RawMessage, incoming api.IncomingRequest, inv api.Invocation, userSelections *scoring.UserSelections, songIds []string, page respond.PageRequest) (respond.RenderedResponse, error) {
+	startTime := time.Now()
+	documents, err := store.GetByIDs(ctx, c, songIds)
+	if err != nil {
+		return respond.RenderedResponse{}, api.BackendError("failed to load default playlist", err)
+	}
+	documents = catalog.ActiveSongs(documents, startTime)
+	catalogLoadTime := time.Since(startTime)
+	if err := rules.ApplyEligibility(ctx, incoming, documents, userSelections); err != nil {
+		return respond.RenderedResponse{}, api.BackendError("eligibility rules failed", err)
+	}
+
+	found := make(map[string]bool, len(documents))
+	for _, document := range documents {
+		if _, excluded := userSelections.Ineligible[document.RuleID]; !excluded {
+			found[document.RuleID] = true
+		}
+	}
+	var playlist []string
+	for _, songId := range songIds {
+		if found[songId] {
+			playlist = append(playlist, songId)
+			delete(found, songId)
+		}
+	}
+	fmt.Printf("Serving default playlist, %d of %d songs available\n", len(playlist), len(songIds))
+
+	topRuleIDs, nextCursor := respond.PageRuleIDs(playlist, page)
+	userRecs := respond.BuildRecommendations(respond.FilterDocuments(documents, topRuleIDs), topRuleIDs, page.Offset, map[string]int{}, nil)
+	if err := respond.SignMediaLinks(ctx, cfg, userRecs); err != nil {
+		return respond.RenderedResponse{}, api.BackendError("failed to sign media links", err)
+	}
+
+	response := respond.RecommendationResponse{
+		RequestID:     api.RequestID(ctx),
+		EngineVersion: respond.EngineVersion(),
+		Genre:         c.Genre,
+		CatalogSize:   len(documents),
+		Timing: respond.ResponseTiming{
+			CatalogLoadMs: catalogLoadTime.Milliseconds(),
+			TotalMs:       time.Since(startTime).Milliseconds(),
+		},
+		TotalMatches:    len(playlist),
+		PageSize:        page.Limit,
+		NextCursor:      nextCursor,
+		ThemeLabels:     catalog.GetThemeLabels(ctx, svc, incoming.Locale),
+		Recommendations: userRecs,
+		DefaultPlaylist: true,
+	}
+	if response.TotalMatches == 0 {
+		response.NoMatches = respond.ExplainNoMatches(documents, userSelections, nil)
+	}
+	rendered, err := respond.RenderResponse(response, incoming, inv)
+	if err != nil {
+		return respond.RenderedResponse{}, api.BackendError("failed to serialize response", err)
+	}
+	if response.TotalMatches == 0 {
+		rendered.StatusCode = http.StatusNotFound
+	}
+
+	if userID := api.RequestUserID(incoming, inv); userID != "" {
+		recordServedRecommendations(ctx, svc, userID, response)
+	}
+	if incoming.IdempotencyKey != "" {
+		storeIdempotentResponse(ctx, svc, incoming.IdempotencyKey, event, inv, rendered)
+	}
+	return rendered, nil
+}
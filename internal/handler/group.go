@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"fmt"
+	"math"
+
+	"April32025/internal/api"
+	"April32025/internal/catalog"
+)
+
+// Merge strategies for group requests
+const (
+	mergeUnion        = "union"        // a theme is on if anyone picked it, at the highest rating given
+	mergeIntersection = "intersection" // a theme is on only if everyone picked it, at the lowest rating given
+	mergeWeighted     = "weighted"     // a theme is on if its weighted average rating rounds to at least 1
+)
+
+// Function to merge every group member's selections into the request's own
+// themes and importance. Top-level themes count as one more member.
+func mergeGroupSelections(incoming *api.IncomingRequest) {
+	members := append([]api.GroupMember{}, incoming.Group...)
+	if len(incoming.Themes) > 0 || len(incoming.Importance) > 0 {
+		members = append(members, api.GroupMember{Themes: incoming.Themes, Importance: incoming.Importance})
+	}
+
+	// validateIncomingRequest has already rejected unknown strategies
+	strategy := incoming.MergeStrategy
+	if strategy == "" {
+		strategy = mergeUnion
+	}
+
+	themes := make(map[string]bool)
+	importance := make(map[string]int)
+
+	for theme := range catalog.ThemeFieldNames {
+		ratings := make([]int, len(members))
+		for i, member := range members {
+			ratings[i] = member.ThemeRating(theme)
+		}
+
+		rating := 0
+		switch strategy {
+		case mergeUnion:
+			for _, r := range ratings {
+				rating = max(rating, r)
+			}
+		case mergeIntersection:
+			rating = api.MaxImportance
+			for _, r := range ratings {
+				rating = min(rating, r)
+			}
+		case mergeWeighted:
+			totalWeight, weightedSum := 0.0, 0.0
+			for i, member := range members {
+				weight := member.Weight
+				if weight <= 0 {
+					weight = 1
+				}
+				totalWeight += weight
+				weightedSum += weight * float64(ratings[i])
+			}
+			rating = int(math.Round(weightedSum / totalWeight))
+		}
+
+		if rating >= api.MinImportance {
+			themes[theme] = true
+			importance[theme] = rating
+		}
+	}
+
+	fmt.Printf("Merged %d group members with strategy %s: %v\n", len(members), strategy, importance)
+	incoming.Themes = themes
+	incoming.Importance = importance
+}
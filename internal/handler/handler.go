@@ -0,0 +1,397 @@
+// Package handler is the Lambda entry point: it decodes an invocation,
+// dispatches its action and wires the catalog, rules, scoring and respond
+// stages together for a recommendation.
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"maps"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hyperjumptech/grule-rule-engine/ast"
+
+	"April32025/internal/api"
+	"April32025/internal/catalog"
+	"April32025/internal/config"
+	"April32025/internal/respond"
+	"April32025/internal/rules"
+	"April32025/internal/scoring"
+)
+
+// Function to handle every Lambda invocation: catalog stream events, HTTP
+// requests and direct invocations
+func HandleRequest(ctx context.Context, event json.RawMessage) (json.RawMessage, error) {
+	// Catalog changes arrive from DynamoDB Streams
+	if streamEvent, ok := parseStreamEvent(event); ok {
+		return handleStreamEvent(ctx, streamEvent)
+	}
+
+	// API Gateway and Function URL invocations get status codes and error bodies
+	if httpReq, ok := parseHTTPRequest(event); ok {
+		return handleHTTPRequest(ctx, httpReq)
+	}
+
+	response, err := processRequest(ctx, api.Invocation{}, event)
+	if err != nil {
+		return nil, err
+	}
+	return respond.DirectInvocationBody(response)
+}
+
+// Function to load what every invocation shares at cold start: the SDK
+// configuration, see config/throttling.go, and the learned ranker. Failures
+// are logged and retried later, by the requests that need them.
+func Warm(ctx context.Context) {
+	cfg, err := config.LoadSDKConfig(ctx)
+	if err != nil {
+		fmt.Println("Failed to load SDK config, retrying on the first request:", err)
+		return
+	}
+	scoring.LoadRankerModel(ctx, cfg, config.NewDynamoDBClient(cfg))
+}
+
+func processRequest(ctx context.Context, inv api.Invocation, event json.RawMessage) (respond.RenderedResponse, error) {
+
+	startTime := time.Now()
+	incoming, err := parseIncomingRequest(event)
+	if err != nil {
+		return respond.RenderedResponse{}, err
+	}
+	page, err := respond.ParsePageRequest(incoming)
+	if err != nil {
+		return respond.RenderedResponse{}, err
+	}
+	songCatalog, err := catalog.ResolveCatalog(incoming.Genre)
+	if err != nil {
+		return respond.RenderedResponse{}, err
+	}
+
+	// Group/party mode folds everyone's selections into one set of themes
+	if len(incoming.Group) > 0 {
+		mergeGroupSelections(&incoming)
+	}
+
+	//Call DynamoDB
+	cfg, err := config.LoadSDKConfig(ctx)
+
+	if err != nil {
+		return respond.RenderedResponse{}, api.BackendError("unable to load SDK config", err)
+	}
+
+	svc := config.NewDynamoDBClient(cfg)
+	store, err := catalog.NewCatalogStore(cfg, svc, catalog.CatalogReadSettingsFor(inv))
+	if err != nil {
+		return respond.RenderedResponse{}, api.BackendError("invalid catalog store configuration", err)
+	}
+
+	// Retried client calls with the same key get the stored response back
+	if incoming.IdempotencyKey != "" {
+		if cached, ok := getIdempotentResponse(ctx, svc, incoming.IdempotencyKey, event, inv); ok {
+			return cached, nil
+		}
+	}
+
+	if incoming.Action == actionExportSnapshot || incoming.Action == actionImportSnapshot {
+		return handleSnapshotAction(ctx, cfg, svc, inv, songCatalog, incoming)
+	}
+
+	// Curators can dry-run the catalog's rules without scoring anything
+	if incoming.Action == actionValidateRules {
+		return validateCatalogRules(ctx, cfg, store, songCatalog)
+	}
+	if incoming.Action == actionStats {
+		return catalogStatsResponse(ctx, store, songCatalog)
+	}
+
+	// Expand a listening context into its theme bundle before building selections
+	if incoming.Context != "" {
+		applyThemeBundle(ctx, svc, &incoming)
+	}
+
+	userSelections := scoring.GetUserSelections(incoming)
+	userSelections.Tier = scoring.RequestTier(incoming, inv)
+	userSelections.Scoring, err = scoring.ApplyScoringOverrides(scoring.LoadScoringConfig(ctx, svc), incoming.ScoringOverrides, inv)
+	if err != nil {
+		return respond.RenderedResponse{}, err
+	}
+	userSelections.Era = scoring.RequestEra(incoming)
+	userSelections.Intensity = incoming.Intensity
+	userSelections.Scorer = incoming.Scorer
+	if userSelections.Scorer == "" {
+		userSelections.Scorer = scoring.DefaultScorer()
+	}
+	assignment, err := scoring.AssignExperiment(incoming, inv)
+	if err != nil {
+		return respond.RenderedResponse{}, err
+	}
+	if assignment != nil {
+		userSelections.Scorer = assignment.Variant
+		userSelections.Variant = assignment.Variant
+	}
+	if userSelections.Scorer == scoring.ScorerSimulation {
+		if !scoring.CanSimulate(inv) {
+			return respond.RenderedResponse{}, api.Forbidden("simulation_not_allowed", "the %s scorer is only for tests", scoring.ScorerSimulation)
+		}
+		userSelections.Scoring = scoring.SimulationConfig()
+	}
+
+	fmt.Printf("Parsed UserSelections: %+v\n", userSelections)
+	if incoming.Action == actionAccept {
+		return acceptSongs(ctx, svc, songCatalog, userSelections, incoming, inv)
+	}
+
+	// Nothing selected would score nothing; serve the default playlist instead
+	if len(userSelections.Selected) == 0 && (incoming.Action == "" || incoming.Action == actionRecommend) && len(incoming.SongIds) == 0 {
+		if playlist := loadDefaultPlaylist(ctx, svc); len(playlist) > 0 {
+			return defaultPlaylistResponse(ctx, cfg, svc, store, songCatalog, event, incoming, inv, userSelections, playlist, page)
+		}
+	}
+
+	catalogStart := time.Now()
+	var documents []catalog.CountryMusicDocument
+	if len(incoming.SongIds) > 0 {
+		documents, err = store.GetByIDs(ctx, songCatalog, incoming.SongIds)
+	} else {
+		catalog.SyncCatalogGeneration(ctx, svc, songCatalog)
+		documents, err = catalog.LoadCachedCatalog(ctx, store, songCatalog, userSelections.Selected)
+	}
+	if err != nil {
+		return respond.RenderedResponse{}, api.BackendError("failed to scan catalog", err)
+	}
+	catalog.ReportRejectedItems(ctx, svc, songCatalog)
+	documents = catalog.ActiveSongs(documents, time.Now())
+	catalogLoadTime := time.Since(catalogStart)
+	userSelections.ThemeWeights = catalog.ThemeWeightsBySong(documents)
+
+	buildStart := time.Now()
+	ruleSource, err := rules.NewRuleSource(cfg, songCatalog)
+	if err != nil {
+		return respond.RenderedResponse{}, api.BackendError("invalid rule source configuration", err)
+	}
+	knowledgeBases, rebuilt, err := rules.BuildKnowledgeBases(ctx, songCatalog, ruleSource, documents)
+	if err != nil {
+		return respond.RenderedResponse{}, api.BackendError("failed to build knowledge base", err)
+	}
+	documentRules := knowledgeBases.Rules
+
+	fmt.Println(ruleSource.Name() + " Rules: ")
+	fmt.Println(documentRules) // Print the combined rule set
+	rules.AuditRules(ctx, cfg, songCatalog, documentRules)
+
+	var overlay *ast.KnowledgeBase
+	if len(incoming.RuleOverrides) > 0 {
+		if overlay, err = rules.BuildRuleOverlay(ctx, incoming.RuleOverrides, inv); err != nil {
+			return respond.RenderedResponse{}, err
+		}
+	}
+	ruleBuildTime := time.Since(buildStart)
+	fmt.Printf("Knowledge base %s %s ready in %v (rebuilt: %t)\n", songCatalog.Genre, knowledgeBases.Version, ruleBuildTime, rebuilt)
+
+	//Get GRULE working
+	catalogFact := rules.NewCatalogFact(documents)
+	executeStart := time.Now()
+	if err := rules.ApplyEligibility(ctx, incoming, documents, userSelections); err != nil {
+		return respond.RenderedResponse{}, api.BackendError("eligibility rules failed", err)
+	}
+	if incoming.Action == actionPreviewMatches {
+		return previewMatches(ctx, songCatalog, documents, knowledgeBases, userSelections, catalogFact)
+	}
+
+	execution := rules.ExecutionResult{Trace: rules.NewRuleTrace()}
+	maxCycle := rules.EngineMaxCycle(incoming.MaxCycle)
+	if userSelections.Scorer == scoring.ScorerSimilarity {
+		scoring.ScoreBySimilarity(userSelections, documents)
+	} else if userSelections.Scorer == scoring.ScorerSimulation {
+		scoring.ScoreBySimulation(userSelections, documents)
+	} else if execution, err = rules.ExecuteKnowledgeBases(ctx, knowledgeBases, userSelections, catalogFact, rules.CycleBudget(ruleSource, catalogFact, maxCycle)); err != nil {
+		return respond.RenderedResponse{}, api.BackendError("rule execution failed", err)
+	}
+	if overlay != nil {
+		if err := rules.ExecuteRuleOverlay(ctx, overlay, userSelections, catalogFact, maxCycle, &execution); err != nil {
+			return respond.RenderedResponse{}, api.BadRequest("rule_override_failed", "ruleOverrides failed to execute: %v", err)
+		}
+	}
+	userSelections.DropIneligible()
+	scoring.ApplyScoreBoosts(userSelections, documents, time.Now())
+	scoring.ApplyIntensityProximity(userSelections, documents)
+	scoring.ApplyArtistAffinity(ctx, svc, userSelections, documents, incoming.FavoriteArtists)
+	scoring.ApplySeasonalBoosts(userSelections, documents, scoring.LoadSeasons(ctx, svc), time.Now())
+	scoring.ApplyCollaborativeSignals(ctx, svc, songCatalog, userSelections)
+	scoring.ApplyRepeatPenalty(ctx, svc, userSelections, api.RequestUserID(incoming, inv), time.Now())
+	scoring.ApplyExposureDecay(ctx, svc, songCatalog, userSelections, time.Now())
+	// The ranker's scores are the final ones, so minScore applies to them
+	scoring.ApplyRanker(userSelections, scoring.LoadRankerModel(ctx, cfg, svc))
+	belowMinScore := userSelections.DropBelowMinScore()
+	userSelections.DropDuplicateSongs(documents)
+	executeTime := time.Since(executeStart)
+	config.EmitRuleMetrics(songCatalog.Genre, config.RuleMetrics{
+		ExtractRules: knowledgeBases.ExtractTime,
+		BuildRules:   knowledgeBases.BuildTime,
+		Execute:      executeTime,
+		RuleCount:    knowledgeBases.RuleCount(),
+		RulesBuilt:   knowledgeBases.RulesBuilt,
+		RulesFired:   len(execution.Trace.Fired),
+		Cycles:       execution.Trace.Cycles,
+	})
+
+	//return "Success", nil
+	explore := scoring.Exploration{Enabled: incoming.Explore, Seed: incoming.Seed}
+	userRecs, nextCursor := respond.FilterDocumentsByRecommendations(documents, userSelections, page, explore)
+	respond.SortRecommendations(userRecs, incoming.SortBy, incoming.Seed)
+	if err := respond.SignMediaLinks(ctx, cfg, userRecs); err != nil {
+		return respond.RenderedResponse{}, api.BackendError("failed to sign media links", err)
+	}
+
+	response := respond.RecommendationResponse{
+		RequestID:      api.RequestID(ctx),
+		EngineVersion:  respond.EngineVersion(),
+		Genre:          songCatalog.Genre,
+		RulesVersion:   knowledgeBases.Version,
+		RankerVersion:  userSelections.RankerVersion,
+		RulesEvaluated: knowledgeBases.RuleCount(),
+		CatalogSize:    len(documents),
+		Timing: respond.ResponseTiming{
+			CatalogLoadMs: catalogLoadTime.Milliseconds(),
+			RuleBuildMs:   ruleBuildTime.Milliseconds(),
+			ExecuteMs:     executeTime.Milliseconds(),
+			TotalMs:       time.Since(startTime).Milliseconds(),
+		},
+		TotalMatches:    len(userSelections.Recommendations),
+		PageSize:        page.Limit,
+		NextCursor:      nextCursor,
+		ThemeLabels:     catalog.GetThemeLabels(ctx, svc, incoming.Locale),
+		Recommendations: userRecs,
+		Partial:         execution.PartialReason != "",
+		PartialReason:   execution.PartialReason,
+		Experiment:      assignment,
+	}
+	if response.TotalMatches == 0 {
+		response.NoMatches = respond.ExplainNoMatches(documents, userSelections, belowMinScore)
+	}
+	if incoming.Debug {
+		response.Debug = respond.BuildDebugInfo(documentRules, userSelections, execution.Trace)
+	}
+	rendered, err := respond.RenderResponse(response, incoming, inv)
+	if err != nil {
+		return respond.RenderedResponse{}, api.BackendError("failed to serialize response", err)
+	}
+
+	if response.TotalMatches == 0 {
+		rendered.StatusCode = http.StatusNotFound
+	}
+
+	scoring.EmitExperimentMetrics(songCatalog.Genre, assignment, response.TotalMatches)
+	servedIDs := make([]string, 0, len(response.Recommendations))
+	for _, rec := range response.Recommendations {
+		servedIDs = append(servedIDs, rec.RuleID)
+	}
+	scoring.RecordServedCounts(ctx, svc, songCatalog, userSelections, servedIDs)
+	scoring.RecordExposure(ctx, svc, songCatalog, userSelections, servedIDs, time.Now())
+	if userID := api.RequestUserID(incoming, inv); userID != "" {
+		recordServedRecommendations(ctx, svc, userID, response)
+	}
+	if incoming.IdempotencyKey != "" {
+		storeIdempotentResponse(ctx, svc, incoming.IdempotencyKey, event, inv, rendered)
+	}
+	return rendered, nil
+}
+
+func parseIncomingRequest(event json.RawMessage) (api.IncomingRequest, error) {
+	var incoming api.IncomingRequest
+	if err := json.Unmarshal([]byte(event), &incoming); err != nil {
+		fmt.Println("Error unmarshalling JSON:", err)
+		return incoming, api.BadRequest("invalid_json", "request body is not valid JSON: %v", err)
+	}
+	if err := validateIncomingRequest(incoming); err != nil {
+		return incoming, err
+	}
+	return incoming, nil
+}
+
+// Function to reject requests that name themes or options we don't know about
+func validateIncomingRequest(incoming api.IncomingRequest) error {
+	checkThemes := func(where string, themes iter.Seq[string]) error {
+		for theme := range themes {
+			if _, ok := catalog.ThemeFieldNames[theme]; !ok {
+				return api.BadRequest("unknown_theme", "unknown theme '%s' in %s", theme, where)
+			}
+		}
+		return nil
+	}
+
+	if err := checkThemes("themes", maps.Keys(incoming.Themes)); err != nil {
+		return err
+	}
+	if err := checkThemes("importance", maps.Keys(incoming.Importance)); err != nil {
+		return err
+	}
+	for i, member := range incoming.Group {
+		where := fmt.Sprintf("group[%d]", i)
+		if err := checkThemes(where, maps.Keys(member.Themes)); err != nil {
+			return err
+		}
+		if err := checkThemes(where, maps.Keys(member.Importance)); err != nil {
+			return err
+		}
+	}
+
+	if !respond.IsValidFormat(incoming.Format) {
+		return api.BadRequest("unknown_format", "format must be one of %s", strings.Join(respond.FormatOptions, ", "))
+	}
+	if err := respond.ValidateFields(incoming.Fields); err != nil {
+		return err
+	}
+	if !respond.IsValidSortBy(incoming.SortBy) {
+		return api.BadRequest("unknown_sort", "sortBy must be one of %s", strings.Join(respond.SortOptions, ", "))
+	}
+
+	if err := catalog.ValidateSongIds(incoming.SongIds); err != nil {
+		return err
+	}
+	if err := rules.ValidateEligibilityFilters(incoming); err != nil {
+		return err
+	}
+	if err := rules.ValidateRuleOverrides(incoming.RuleOverrides); err != nil {
+		return err
+	}
+	if !scoring.IsValidScorer(incoming.Scorer) {
+		return api.BadRequest("unknown_scorer", "scorer must be %s, %s or %s", scoring.ScorerRules, scoring.ScorerSimilarity, scoring.ScorerSimulation)
+	}
+	if incoming.Scorer != "" && incoming.Scorer != scoring.ScorerRules && len(incoming.RuleOverrides) > 0 {
+		return api.BadRequest("scorer_conflict", "ruleOverrides need the %s scorer", scoring.ScorerRules)
+	}
+	if incoming.PreferNew && incoming.PreferClassics {
+		return api.BadRequest("conflicting_preferences", "preferNew and preferClassics can't both be set")
+	}
+	if err := scoring.ValidateIntensity(incoming.Intensity); err != nil {
+		return err
+	}
+	if err := scoring.ValidateFavoriteArtists(incoming.FavoriteArtists); err != nil {
+		return err
+	}
+	if incoming.MaxCycle < 0 || incoming.MaxCycle > rules.MaxCycleLimit {
+		return api.BadRequest("invalid_max_cycle", "maxCycle must be between 1 and %d", rules.MaxCycleLimit)
+	}
+
+	if _, ok := scoring.TierRanks[incoming.Tier]; incoming.Tier != "" && !ok {
+		return api.BadRequest("unknown_tier", "tier must be %s or %s", scoring.TierFree, scoring.TierPremium)
+	}
+
+	switch incoming.Action {
+	case "", actionRecommend, actionValidateRules, actionPreviewMatches, actionStats, actionExportSnapshot, actionImportSnapshot, actionAccept:
+	default:
+		return api.BadRequest("unknown_action", "action must be %s, %s, %s, %s, %s, %s or %s", actionRecommend, actionValidateRules, actionPreviewMatches, actionStats, actionExportSnapshot, actionImportSnapshot, actionAccept)
+	}
+
+	switch incoming.MergeStrategy {
+	case "", mergeUnion, mergeIntersection, mergeWeighted:
+	default:
+		return api.BadRequest("unknown_merge_strategy", "mergeStrategy must be one of %s, %s or %s", mergeUnion, mergeIntersection, mergeWeighted)
+	}
+	return nil
+}
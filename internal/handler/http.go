@@ -0,0 +1,269 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"April32025/internal/api"
+	"April32025/internal/respond"
+	"April32025/internal/scoring"
+)
+
+// httpRequest holds the parts of an API Gateway (REST or HTTP API) or Lambda
+// Function URL event that we use. Direct invocations never carry a
+// requestContext, which is how the two are told apart.
+type httpRequest struct {
+	RequestContext        json.RawMessage   `json:"requestContext"`
+	Headers               map[string]string `json:"headers"`
+	QueryStringParameters map[string]string `json:"queryStringParameters"`
+	Body                  string            `json:"body"`
+	IsBase64Encoded       bool              `json:"isBase64Encoded"`
+}
+
+// httpRequestContext covers both the REST API (path) and HTTP API / Function
+// URL (http.path) layouts of requestContext
+type httpRequestContext struct {
+	DomainName string `json:"domainName"`
+	Path       string `json:"path"`
+	HTTP       struct {
+		Path string `json:"path"`
+	} `json:"http"`
+	// REST API Lambda authorizers put their context directly under
+	// authorizer, HTTP API ones under authorizer.lambda
+	Authorizer struct {
+		Tier   string `json:"tier"`
+		Role   string `json:"role"`
+		UserID string `json:"userId"`
+		Lambda struct {
+			Tier   string `json:"tier"`
+			Role   string `json:"role"`
+			UserID string `json:"userId"`
+		} `json:"lambda"`
+	} `json:"authorizer"`
+}
+
+// httpResponse is the proxy response shape understood by API Gateway and
+// Function URLs alike
+type httpResponse struct {
+	StatusCode      int               `json:"statusCode"`
+	Headers         map[string]string `json:"headers"`
+	Body            string            `json:"body"`
+	IsBase64Encoded bool              `json:"isBase64Encoded"`
+}
+
+type errorBody struct {
+	Error errorDetail `json:"error"`
+}
+
+type errorDetail struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"requestId,omitempty"`
+
+	RetryAfterSeconds int `json:"retryAfterSeconds,omitempty"`
+}
+
+// Function to detect an HTTP-fronted invocation
+func parseHTTPRequest(event json.RawMessage) (*httpRequest, bool) {
+	var req httpRequest
+	if err := json.Unmarshal(event, &req); err != nil || len(req.RequestContext) == 0 {
+		return nil, false
+	}
+	return &req, true
+}
+
+// Function to run a request that arrived over HTTP and map the outcome to a status code
+func handleHTTPRequest(ctx context.Context, req *httpRequest) (json.RawMessage, error) {
+	payload := []byte(req.Body)
+	if req.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(req.Body)
+		if err != nil {
+			return marshalHTTPResponse(errorResponse(ctx, api.BadRequest("invalid_body", "request body is not valid base64")), false)
+		}
+		payload = decoded
+	}
+	// Feed readers and plain links subscribe with a GET and query parameters
+	if len(payload) == 0 {
+		fromQuery, err := queryToPayload(req.QueryStringParameters)
+		if err != nil {
+			return marshalHTTPResponse(errorResponse(ctx, err), false)
+		}
+		payload = fromQuery
+	}
+
+	response, err := processRequest(ctx, api.Invocation{HTTP: true, SelfURL: req.selfURL(), Query: req.QueryStringParameters, Tier: req.authorizedTier(), Role: req.authorizedRole(), UserID: req.authorizedUserID(), ExperimentVariant: req.header(scoring.ExperimentVariantHeader)}, payload)
+	if err != nil {
+		response = errorResponse(ctx, err)
+	}
+	return marshalHTTPResponse(response, respond.AcceptsGzip(req.header("Accept-Encoding")))
+}
+
+// Helper function to read a header; REST APIs keep the client's casing while
+// HTTP APIs and Function URLs lowercase every name
+func (req *httpRequest) header(name string) string {
+	for key, value := range req.Headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// Helper function to rebuild the URL the client called, without its query
+func (req *httpRequest) selfURL() string {
+	var rc httpRequestContext
+	if err := json.Unmarshal(req.RequestContext, &rc); err != nil || rc.DomainName == "" {
+		return ""
+	}
+	path := rc.HTTP.Path
+	if path == "" {
+		path = rc.Path
+	}
+	return "https://" + rc.DomainName + path
+}
+
+// Helper function to read the listener's plan from the authorizer context
+func (req *httpRequest) authorizedTier() string {
+	var rc httpRequestContext
+	if err := json.Unmarshal(req.RequestContext, &rc); err != nil {
+		return ""
+	}
+	if rc.Authorizer.Lambda.Tier != "" {
+		return rc.Authorizer.Lambda.Tier
+	}
+	return rc.Authorizer.Tier
+}
+
+// Helper function to read the caller's role from the authorizer context
+func (req *httpRequest) authorizedRole() string {
+	var rc httpRequestContext
+	if err := json.Unmarshal(req.RequestContext, &rc); err != nil {
+		return ""
+	}
+	if rc.Authorizer.Lambda.Role != "" {
+		return rc.Authorizer.Lambda.Role
+	}
+	return rc.Authorizer.Role
+}
+
+// Helper function to read the signed-in listener from the authorizer context
+func (req *httpRequest) authorizedUserID() string {
+	var rc httpRequestContext
+	if err := json.Unmarshal(req.RequestContext, &rc); err != nil {
+		return ""
+	}
+	if rc.Authorizer.Lambda.UserID != "" {
+		return rc.Authorizer.Lambda.UserID
+	}
+	return rc.Authorizer.UserID
+}
+
+// Function to translate query parameters into the JSON request body, e.g.
+// ?themes=love,grit&intensity=1-2&format=rss&locale=es-MX&limit=5
+func queryToPayload(params map[string]string) ([]byte, error) {
+	request := map[string]interface{}{}
+	for key, value := range params {
+		switch key {
+		case "themes":
+			themes := map[string]bool{}
+			for _, theme := range strings.Split(value, ",") {
+				if theme = strings.TrimSpace(theme); theme != "" {
+					themes[theme] = true
+				}
+			}
+			request["themes"] = themes
+		case "limit", "seed", "maxCycle":
+			number, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, api.BadRequest("invalid_query", "query parameter %s must be a number", key)
+			}
+			request[key] = number
+		case "decades":
+			decades := []int64{}
+			for _, decade := range strings.Split(value, ",") {
+				number, err := strconv.ParseInt(strings.TrimSpace(decade), 10, 64)
+				if err != nil {
+					return nil, api.BadRequest("invalid_query", "query parameter decades must be a list of years, e.g. 1990,2000")
+				}
+				decades = append(decades, number)
+			}
+			request[key] = decades
+		case "intensity":
+			// A range like 1-2, or a single level
+			low, high, isRange := strings.Cut(value, "-")
+			if !isRange {
+				high = low
+			}
+			minLevel, minErr := strconv.Atoi(strings.TrimSpace(low))
+			maxLevel, maxErr := strconv.Atoi(strings.TrimSpace(high))
+			if minErr != nil || maxErr != nil {
+				return nil, api.BadRequest("invalid_query", "query parameter intensity must be a level or a range, e.g. 1-2")
+			}
+			request[key] = api.IntensityRange{Min: minLevel, Max: maxLevel}
+		case "excludedArtists", "favoriteArtists", "songIds", "requiredThemes", "fields":
+			request[key] = strings.Split(value, ",")
+		case "excludeExplicit", "preferNew", "preferClassics", "explore", "compact", "debug":
+			request[key] = value == "true"
+		case "format", "cursor", "context", "genre", "action", "sortBy", "mergeStrategy", "idempotencyKey", "scorer", "locale":
+			request[key] = value
+		}
+	}
+	return json.Marshal(request)
+}
+
+// Function to turn any pipeline error into a structured error response
+func errorResponse(ctx context.Context, err error) respond.RenderedResponse {
+	var reqErr *api.RequestError
+	if !errors.As(err, &reqErr) {
+		reqErr = &api.RequestError{Status: http.StatusInternalServerError, Code: "internal_error", Message: "unexpected failure", Err: err}
+	}
+
+	// Backend details stay in the logs, clients only see the summary
+	body, _ := json.Marshal(errorBody{Error: errorDetail{
+		Code:      reqErr.Code,
+		Message:   reqErr.Message,
+		RequestID: api.RequestID(ctx),
+
+		RetryAfterSeconds: reqErr.RetryAfter,
+	}})
+	return respond.RenderedResponse{StatusCode: reqErr.Status, ContentType: "application/json", Body: body, RetryAfter: reqErr.RetryAfter}
+}
+
+func marshalHTTPResponse(response respond.RenderedResponse, gzipAllowed bool) (json.RawMessage, error) {
+	out := httpResponse{
+		StatusCode: response.StatusCode,
+		Headers:    map[string]string{"Content-Type": response.ContentType, "Vary": "Accept-Encoding"},
+		Body:       string(response.Body),
+	}
+	if response.RetryAfter > 0 {
+		out.Headers["Retry-After"] = strconv.Itoa(response.RetryAfter)
+	}
+	if respond.IsBinaryContent(response.ContentType) {
+		out.Body = base64.StdEncoding.EncodeToString(response.Body)
+		out.IsBase64Encoded = true
+	}
+
+	// Compressed bodies are binary, so the gateway needs them base64 encoded
+	if gzipAllowed && len(response.Body) >= respond.MinGzipBytes {
+		compressed, err := respond.GzipBytes(response.Body)
+		if err != nil {
+			fmt.Println("Failed to gzip response, sending it uncompressed:", err)
+		} else {
+			out.Headers["Content-Encoding"] = "gzip"
+			out.Body = base64.StdEncoding.EncodeToString(compressed)
+			out.IsBase64Encoded = true
+		}
+	}
+
+	encoded, err := json.Marshal(out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode HTTP response: %w", err)
+	}
+	return encoded, nil
+}
@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"April32025/internal/api"
+	"April32025/internal/catalog"
+	"April32025/internal/config"
+	"April32025/internal/respond"
+)
+
+// Responses for requests carrying an idempotencyKey are stored in a DynamoDB
+// table keyed by that key, with a hash of the request and the caller's
+// identity so a reused key never replays another caller's response. The
+// table should have TTL enabled on "expiresAt" so old entries are cleaned up;
+// expiry is also checked on read because TTL deletion can lag by hours.
+const defaultIdempotencyTTLSeconds = 600
+
+func idempotencyTableName() string {
+	return config.Storage().IdempotencyTable
+}
+
+func idempotencyWindow() time.Duration {
+	seconds, err := strconv.Atoi(config.Env("IDEMPOTENCY_TTL_SECONDS", strconv.Itoa(defaultIdempotencyTTLSeconds)))
+	if err != nil || seconds <= 0 {
+		seconds = defaultIdempotencyTTLSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// Helper function to fingerprint the request so a key reused with a
+// different request, or by a different caller, is not answered with someone
+// else's response. Over HTTP the authorizer's listener, plan and role and
+// the variant override header aren't in the payload, so they are hashed with it.
+func hashRequest(event json.RawMessage, inv api.Invocation) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%t\x00%s\x00%s\x00%s\x00%s\x00", inv.HTTP, inv.UserID, inv.Tier, inv.Role, inv.ExperimentVariant)
+	hash.Write(event)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Function to look up a previously stored response for an idempotency key
+func getIdempotentResponse(ctx context.Context, svc *dynamodb.Client, key string, event json.RawMessage, inv api.Invocation) (respond.RenderedResponse, bool) {
+	resp, err := svc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(idempotencyTableName()),
+		Key: map[string]types.AttributeValue{
+			"idempotencyKey": &types.AttributeValueMemberS{Value: key},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		fmt.Println("Idempotency lookup failed, continuing without cache:", err)
+		return respond.RenderedResponse{}, false
+	}
+	if resp.Item == nil {
+		return respond.RenderedResponse{}, false
+	}
+
+	expiresAt, _ := strconv.ParseInt(catalog.GetNumberValue(resp.Item["expiresAt"]), 10, 64)
+	if expiresAt <= time.Now().Unix() {
+		fmt.Println("Idempotency record expired for key: " + key)
+		return respond.RenderedResponse{}, false
+	}
+
+	if catalog.GetStringValue(resp.Item["requestHash"]) != hashRequest(event, inv) {
+		fmt.Println("Idempotency key reused with a different request, ignoring stored response: " + key)
+		return respond.RenderedResponse{}, false
+	}
+
+	statusCode, err := strconv.Atoi(catalog.GetNumberValue(resp.Item["statusCode"]))
+	if err != nil {
+		statusCode = http.StatusOK
+	}
+
+	// Bodies are stored as binary, since format=proto isn't valid UTF-8;
+	// records written before that hold a string
+	var body []byte
+	switch stored := resp.Item["response"].(type) {
+	case *types.AttributeValueMemberB:
+		body = stored.Value
+	case *types.AttributeValueMemberS:
+		body = []byte(stored.Value)
+	}
+
+	fmt.Println("Returning stored response for idempotency key: " + key)
+	return respond.RenderedResponse{
+		StatusCode:  statusCode,
+		ContentType: catalog.GetStringValue(resp.Item["contentType"]),
+		Body:        body,
+	}, true
+}
+
+// Function to store the serialized response for an idempotency key. The first
+// writer wins; a concurrent retry that loses the race keeps its own result.
+func storeIdempotentResponse(ctx context.Context, svc *dynamodb.Client, key string, event json.RawMessage, inv api.Invocation, response respond.RenderedResponse) {
+	now := time.Now()
+	expiresAt := now.Add(idempotencyWindow()).Unix()
+
+	_, err := svc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(idempotencyTableName()),
+		Item: map[string]types.AttributeValue{
+			"idempotencyKey": &types.AttributeValueMemberS{Value: key},
+			"requestHash":    &types.AttributeValueMemberS{Value: hashRequest(event, inv)},
+			"response":       &types.AttributeValueMemberB{Value: response.Body},
+			"statusCode":     &types.AttributeValueMemberN{Value: strconv.Itoa(response.StatusCode)},
+			"contentType":    &types.AttributeValueMemberS{Value: response.ContentType},
+			"expiresAt":      &types.AttributeValueMemberN{Value: strconv.FormatInt(expiresAt, 10)},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(idempotencyKey) OR expiresAt < :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+		},
+	})
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		fmt.Println("Idempotency record already stored for key: " + key)
+	} else if err != nil {
+		fmt.Println("Failed to store idempotent response:", err)
+	}
+}
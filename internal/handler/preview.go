@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/hyperjumptech/grule-rule-engine/ast"
+	"github.com/hyperjumptech/grule-rule-engine/engine"
+
+	"April32025/internal/api"
+	"April32025/internal/catalog"
+	"April32025/internal/config"
+	"April32025/internal/respond"
+	"April32025/internal/rules"
+	"April32025/internal/scoring"
+)
+
+// previewResponse lists the songs whose rules match the selections, in the
+// order the engine would consider them. Nothing is scored: then-scopes never
+// run, so Recommendations is left untouched.
+type previewResponse struct {
+	RequestID      string         `json:"requestId"`
+	Genre          string         `json:"genre"`
+	RulesVersion   string         `json:"rulesVersion"`
+	RulesEvaluated int            `json:"rulesEvaluated"`
+	CatalogSize    int            `json:"catalogSize"`
+	TotalMatches   int            `json:"totalMatches"`
+	Matches        []previewMatch `json:"matches"`
+}
+
+type previewMatch struct {
+	Rule     string `json:"rule"`
+	Salience int    `json:"salience"`
+	RuleID   string `json:"ruleId,omitempty"` // empty for hand-authored rules that aren't tied to one song
+	Artist   string `json:"artist,omitempty"`
+	Title    string `json:"title,omitempty"`
+}
+
+// Function to list the rules whose when-scope passes, without executing any of them
+func previewMatches(ctx context.Context, c config.Catalog, documents []catalog.CountryMusicDocument, knowledgeBases *rules.KnowledgeBaseSet, userSelections *scoring.UserSelections, catalogFact *rules.Catalog) (respond.RenderedResponse, error) {
+	var entries []*ast.RuleEntry
+	for _, knowledgeBase := range knowledgeBases.Shards {
+		matched, err := engine.NewGruleEngine().FetchMatchingRules(rules.NewRuleFacts(userSelections, catalogFact), knowledgeBase)
+		if err != nil {
+			return respond.RenderedResponse{}, api.BackendError("rule matching failed", err)
+		}
+		entries = append(entries, matched...)
+	}
+	// Each shard comes back ordered by salience; keep that order overall
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Salience > entries[j].Salience
+	})
+
+	songsByRule := make(map[string]catalog.CountryMusicDocument, len(documents))
+	for _, document := range documents {
+		songsByRule[catalog.RuleNameFor(document.RuleID)] = document
+	}
+
+	response := previewResponse{
+		RequestID:      api.RequestID(ctx),
+		Genre:          c.Genre,
+		RulesVersion:   knowledgeBases.Version,
+		RulesEvaluated: knowledgeBases.RuleCount(),
+		CatalogSize:    len(documents),
+		TotalMatches:   len(entries),
+		Matches:        []previewMatch{},
+	}
+	for _, entry := range entries {
+		match := previewMatch{Rule: entry.RuleName, Salience: entry.Salience}
+		if song, ok := songsByRule[entry.RuleName]; ok {
+			match.RuleID, match.Artist, match.Title = song.RuleID, song.Artist, song.Title
+		}
+		response.Matches = append(response.Matches, match)
+	}
+	fmt.Printf("Preview found %d matching rules\n", len(entries))
+
+	body, err := json.Marshal(response)
+	if err != nil {
+		return respond.RenderedResponse{}, api.BackendError("failed to serialize response", err)
+	}
+	return respond.RenderedResponse{StatusCode: http.StatusOK, ContentType: "application/json", Body: body}, nil
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"April32025/internal/config"
+	"April32025/internal/respond"
+	"April32025/internal/scoring"
+)
+
+// With HISTORY_TABLE set, every page of recommendations served to a known
+// listener is written there, for "recently played" features, repeat
+// suppression and offline analysis. The table is keyed by userId (partition)
+// and servedAt (sort, Unix milliseconds) and should have TTL enabled on
+// "expiresAt"; HISTORY_TTL_DAYS controls how long entries are kept.
+//
+// Over HTTP the listener comes from the authorizer's userId, direct
+// invocations pass "userId". Anonymous requests are not recorded.
+const defaultHistoryTTLDays = 90
+
+func historyRetention() time.Duration {
+	days, err := strconv.Atoi(config.Env("HISTORY_TTL_DAYS", strconv.Itoa(defaultHistoryTTLDays)))
+	if err != nil || days <= 0 {
+		days = defaultHistoryTTLDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// Function to record the songs a listener was served, in rank order with
+// their scores. Failures are logged rather than failing a request the
+// listener already has an answer for.
+func recordServedRecommendations(ctx context.Context, svc *dynamodb.Client, userID string, response respond.RecommendationResponse) {
+	table := config.Storage().HistoryTable
+	if table == "" || len(response.Recommendations) == 0 {
+		return
+	}
+
+	ruleIDs := make([]types.AttributeValue, 0, len(response.Recommendations))
+	scores := make(map[string]types.AttributeValue, len(response.Recommendations))
+	features := make(map[string]types.AttributeValue, len(response.Recommendations))
+	for _, rec := range response.Recommendations {
+		ruleIDs = append(ruleIDs, &types.AttributeValueMemberS{Value: rec.RuleID})
+		scores[rec.RuleID] = &types.AttributeValueMemberN{Value: strconv.Itoa(rec.Score)}
+		if songFeatures := scoring.RankerFeatures(rec.Breakdown); songFeatures != nil {
+			values := make(map[string]types.AttributeValue, len(songFeatures))
+			for name, value := range songFeatures {
+				values[name] = &types.AttributeValueMemberN{Value: strconv.FormatFloat(value, 'f', -1, 64)}
+			}
+			features[rec.RuleID] = &types.AttributeValueMemberM{Value: values}
+		}
+	}
+
+	now := time.Now()
+	item := map[string]types.AttributeValue{
+		"userId":    &types.AttributeValueMemberS{Value: userID},
+		"servedAt":  &types.AttributeValueMemberN{Value: strconv.FormatInt(now.UnixMilli(), 10)},
+		"genre":     &types.AttributeValueMemberS{Value: response.Genre},
+		"ruleIds":   &types.AttributeValueMemberL{Value: ruleIDs},
+		"scores":    &types.AttributeValueMemberM{Value: scores},
+		"features":  &types.AttributeValueMemberM{Value: features}, // ranker training data, see scoring/ranker.go
+		"expiresAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(historyRetention()).Unix(), 10)},
+	}
+	if response.RequestID != "" {
+		item["requestId"] = &types.AttributeValueMemberS{Value: response.RequestID}
+	}
+	if response.RulesVersion != "" {
+		item["rulesVersion"] = &types.AttributeValueMemberS{Value: response.RulesVersion}
+	}
+	if response.RankerVersion != "" {
+		item["rankerVersion"] = &types.AttributeValueMemberS{Value: response.RankerVersion}
+	}
+	if response.Experiment != nil {
+		item["experiment"] = &types.AttributeValueMemberS{Value: response.Experiment.Name}
+		item["variant"] = &types.AttributeValueMemberS{Value: response.Experiment.Variant}
+	}
+
+	_, err := svc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(table),
+		Item:      item,
+	})
+	if err != nil {
+		fmt.Println("Failed to record served recommendations:", err)
+		return
+	}
+	fmt.Printf("Recorded %d served recommendations for user %s\n", len(ruleIDs), userID)
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// The simulation scorer promises identical responses for the same catalog and
+// request, whatever the deployment's scoring settings. This runs a request
+// through the whole pipeline against the fixture catalog and compares the
+// response, less its requestId and timing, with
+// testdata/simulation.golden.json; run with -update to rewrite it after an
+// intended change.
+func TestSimulationGolden(t *testing.T) {
+	t.Setenv("AWS_REGION", "us-east-2")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("CATALOG_STORE", "memory")
+	t.Setenv("CATALOG_FILE", "testdata/catalog.json")
+
+	request := json.RawMessage(`{
+		"scorer": "simulation",
+		"themes": {"love": true, "heartbreak": true, "goodtimes": true},
+		"importance": {"heartbreak": 5},
+		"intensity": {"min": 1, "max": 3},
+		"favoriteArtists": ["Dolly Parton"],
+		"preferClassics": true,
+		"limit": 3
+	}`)
+
+	response, err := HandleRequest(context.Background(), request)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+
+	// Settings the simulation scorer pins must not move the result
+	t.Setenv("SCORING_POPULARITY_WEIGHT", "50")
+	t.Setenv("SCORING_RECENCY_WEIGHT", "50")
+	t.Setenv("SCORING_INTENSITY_WEIGHT", "50")
+	t.Setenv("SCORING_AFFINITY_WEIGHT", "50")
+	t.Setenv("SCORING_RERANK_ARTIST_WEIGHT", "50")
+	t.Setenv("SCORING_MIN_SCORE", "100")
+	tuned, err := HandleRequest(context.Background(), request)
+	if err != nil {
+		t.Fatalf("request with tuned scoring failed: %v", err)
+	}
+	got := normalizedResponse(t, response)
+	if tunedGot := normalizedResponse(t, tuned); !bytes.Equal(got, tunedGot) {
+		t.Errorf("scoring settings changed the response:\n%s\nwant\n%s", tunedGot, got)
+	}
+
+	golden := "testdata/simulation.golden.json"
+	if *updateGolden {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v; run with -update to create it", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("response differs from %s:\n%s", golden, got)
+	}
+}
+
+// Helper function to drop the fields that differ between runs of the same
+// request and indent the rest for the golden file
+func normalizedResponse(t *testing.T, response []byte) []byte {
+	t.Helper()
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(response, &fields); err != nil {
+		t.Fatalf("response is not a JSON object: %v\n%s", err, response)
+	}
+	delete(fields, "requestId")
+	delete(fields, "timing")
+	normalized, err := json.MarshalIndent(fields, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(normalized, '\n')
+}
@@ -0,0 +1,366 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"April32025/internal/api"
+	"April32025/internal/catalog"
+	"April32025/internal/config"
+	"April32025/internal/respond"
+)
+
+// Maintenance actions, for direct invocations only. exportSnapshot dumps a
+// catalog table to s3://SNAPSHOT_BUCKET/SNAPSHOT_PREFIX<timestamp>.json
+// (SNAPSHOT_PREFIX defaults to "snapshots/{genre}/"), so every export is kept
+// as its own version. importSnapshot writes the items of the snapshot named
+// by "snapshot" (its key) back to the table; with "prune" it also deletes
+// items the snapshot doesn't have, undoing bulk edits that added songs.
+//
+// Items are stored in DynamoDB's typed JSON ({"S": "..."}, {"N": "3"}) so a
+// restore puts back exactly what was exported, theme membership items
+// included. Imports overwrite whatever is there, versions too, and bump the
+// catalog generation so warm containers reload.
+const (
+	actionExportSnapshot = "exportSnapshot"
+	actionImportSnapshot = "importSnapshot"
+
+	defaultSnapshotPrefix = "snapshots/{genre}/"
+	batchWriteChunkSize   = 25 // BatchWriteItem's limit per call
+	batchWriteRetries     = 5
+)
+
+// catalogSnapshot is the snapshot file layout
+type catalogSnapshot struct {
+	Genre      string                       `json:"genre"`
+	Table      string                       `json:"table"`
+	ExportedAt string                       `json:"exportedAt"`
+	ItemCount  int                          `json:"itemCount"`
+	Items      []map[string]json.RawMessage `json:"items"`
+}
+
+// snapshotReport is the response to either action
+type snapshotReport struct {
+	RequestID string `json:"requestId"`
+	Action    string `json:"action"`
+	Genre     string `json:"genre"`
+	Location  string `json:"location"`
+	Items     int    `json:"items"`
+	Pruned    int    `json:"pruned,omitempty"`
+}
+
+// Function to run a snapshot action
+func handleSnapshotAction(ctx context.Context, cfg aws.Config, svc *dynamodb.Client, inv api.Invocation, c config.Catalog, incoming api.IncomingRequest) (respond.RenderedResponse, error) {
+	if inv.HTTP {
+		return respond.RenderedResponse{}, api.Forbidden("maintenance_only", "%s is only available to direct invocations", incoming.Action)
+	}
+	bucket := config.Env("SNAPSHOT_BUCKET", "")
+	if bucket == "" {
+		return respond.RenderedResponse{}, api.BadRequest("snapshots_disabled", "SNAPSHOT_BUCKET is not configured")
+	}
+
+	report := snapshotReport{RequestID: api.RequestID(ctx), Action: incoming.Action, Genre: c.Genre}
+	var err error
+	if incoming.Action == actionExportSnapshot {
+		err = exportSnapshot(ctx, svc, config.NewS3Client(cfg), bucket, c, &report)
+	} else {
+		err = importSnapshot(ctx, svc, config.NewS3Client(cfg), bucket, c, incoming, &report)
+	}
+	if err != nil {
+		return respond.RenderedResponse{}, err
+	}
+
+	body, err := json.Marshal(report)
+	if err != nil {
+		return respond.RenderedResponse{}, api.BackendError("failed to serialize response", err)
+	}
+	return respond.RenderedResponse{StatusCode: http.StatusOK, ContentType: "application/json", Body: body}, nil
+}
+
+// Function to write every item of a catalog table to a new snapshot
+func exportSnapshot(ctx context.Context, svc *dynamodb.Client, client *s3.Client, bucket string, c config.Catalog, report *snapshotReport) error {
+	items, err := scanTableItems(ctx, svc, c, nil)
+	if err != nil {
+		return api.BackendError("failed to scan catalog", err)
+	}
+
+	now := time.Now().UTC()
+	snapshot := catalogSnapshot{Genre: c.Genre, Table: c.Table, ExportedAt: now.Format(time.RFC3339), ItemCount: len(items)}
+	for _, item := range items {
+		encoded, err := encodeTypedItem(item)
+		if err != nil {
+			return api.BackendError("failed to encode catalog item", err)
+		}
+		snapshot.Items = append(snapshot.Items, encoded)
+	}
+	body, err := json.Marshal(snapshot)
+	if err != nil {
+		return api.BackendError("failed to encode snapshot", err)
+	}
+
+	key := catalog.GenrePath(config.Env("SNAPSHOT_PREFIX", defaultSnapshotPrefix), c.Genre) + now.Format("20060102T150405Z") + ".json"
+	_, err = client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+		IfNoneMatch: aws.String("*"),
+	})
+	if err != nil {
+		return api.BackendError("failed to store snapshot", err)
+	}
+	report.Location = "s3://" + bucket + "/" + key
+	report.Items = len(items)
+	fmt.Printf("Exported %d %s items to %s\n", len(items), c.Genre, report.Location)
+	return nil
+}
+
+// Function to restore a catalog table from a snapshot
+func importSnapshot(ctx context.Context, svc *dynamodb.Client, client *s3.Client, bucket string, c config.Catalog, incoming api.IncomingRequest, report *snapshotReport) error {
+	if incoming.Snapshot == "" {
+		return api.BadRequest("missing_snapshot", "importSnapshot needs the snapshot's key in \"snapshot\"")
+	}
+	report.Location = "s3://" + bucket + "/" + incoming.Snapshot
+	resp, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(incoming.Snapshot),
+	})
+	if err != nil {
+		return api.BackendError("failed to download snapshot "+report.Location, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return api.BackendError("failed to read snapshot "+report.Location, err)
+	}
+
+	var snapshot catalogSnapshot
+	if err := json.Unmarshal(body, &snapshot); err != nil {
+		return api.BadRequest("invalid_snapshot", "%s is not a catalog snapshot: %v", report.Location, err)
+	}
+	if snapshot.Genre != c.Genre {
+		return api.BadRequest("invalid_snapshot", "%s is a %s snapshot, not %s", report.Location, snapshot.Genre, c.Genre)
+	}
+	keep := make(map[string]bool, len(snapshot.Items))
+	var writes []types.WriteRequest
+	for _, encoded := range snapshot.Items {
+		item, err := decodeTypedItem(encoded)
+		if err != nil {
+			return api.BadRequest("invalid_snapshot", "%s has a malformed item: %v", report.Location, err)
+		}
+		keep[catalog.GetStringValue(item["RuleID"])] = true
+		writes = append(writes, types.WriteRequest{PutRequest: &types.PutRequest{Item: item}})
+	}
+
+	if incoming.Prune {
+		keys, err := scanTableItems(ctx, svc, c, aws.String("RuleID"))
+		if err != nil {
+			return api.BackendError("failed to scan catalog", err)
+		}
+		for _, key := range keys {
+			if !keep[catalog.GetStringValue(key["RuleID"])] {
+				writes = append(writes, types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: key}})
+				report.Pruned++
+			}
+		}
+	}
+
+	if err := batchWriteItems(ctx, svc, c, writes); err != nil {
+		return api.BackendError("failed to restore snapshot", err)
+	}
+	if err := catalog.BumpCatalogGeneration(ctx, svc, c); err != nil {
+		return err
+	}
+	catalog.EvictCatalogCache(c)
+	report.Items = len(snapshot.Items)
+	fmt.Printf("Imported %d %s items from %s, pruned %d\n", report.Items, c.Genre, report.Location, report.Pruned)
+	return nil
+}
+
+// Function to read every item of a table with strongly consistent reads,
+// optionally projected
+func scanTableItems(ctx context.Context, svc *dynamodb.Client, c config.Catalog, projection *string) ([]map[string]types.AttributeValue, error) {
+	var items []map[string]types.AttributeValue
+	paginator := dynamodb.NewScanPaginator(svc, &dynamodb.ScanInput{
+		TableName:            aws.String(c.Table),
+		ConsistentRead:       aws.Bool(true),
+		ProjectionExpression: projection,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page.Items...)
+	}
+	return items, nil
+}
+
+// Function to apply writes in BatchWriteItem-sized chunks, retrying the ones
+// DynamoDB leaves unprocessed
+func batchWriteItems(ctx context.Context, svc *dynamodb.Client, c config.Catalog, writes []types.WriteRequest) error {
+	for start := 0; start < len(writes); start += batchWriteChunkSize {
+		pending := writes[start:min(start+batchWriteChunkSize, len(writes))]
+		for attempt := 0; len(pending) > 0; attempt++ {
+			if attempt > batchWriteRetries {
+				return fmt.Errorf("%d writes still unprocessed after %d retries", len(pending), batchWriteRetries)
+			}
+			if attempt > 0 {
+				select {
+				case <-time.After(time.Duration(50<<attempt) * time.Millisecond):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			resp, err := svc.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+				RequestItems: map[string][]types.WriteRequest{c.Table: pending},
+			})
+			if err != nil {
+				return err
+			}
+			pending = resp.UnprocessedItems[c.Table]
+		}
+	}
+	return nil
+}
+
+// Helper function to encode an item in DynamoDB's typed JSON
+func encodeTypedItem(item map[string]types.AttributeValue) (map[string]json.RawMessage, error) {
+	encoded := make(map[string]json.RawMessage, len(item))
+	for name, attr := range item {
+		value, err := json.Marshal(typedJSON(attr))
+		if err != nil {
+			return nil, err
+		}
+		encoded[name] = value
+	}
+	return encoded, nil
+}
+
+// Helper function to describe one attribute in DynamoDB's typed JSON
+func typedJSON(attr types.AttributeValue) map[string]interface{} {
+	switch v := attr.(type) {
+	case *types.AttributeValueMemberS:
+		return map[string]interface{}{"S": v.Value}
+	case *types.AttributeValueMemberN:
+		return map[string]interface{}{"N": v.Value}
+	case *types.AttributeValueMemberBOOL:
+		return map[string]interface{}{"BOOL": v.Value}
+	case *types.AttributeValueMemberNULL:
+		return map[string]interface{}{"NULL": true}
+	case *types.AttributeValueMemberB:
+		return map[string]interface{}{"B": v.Value} // base64 via encoding/json
+	case *types.AttributeValueMemberSS:
+		return map[string]interface{}{"SS": v.Value}
+	case *types.AttributeValueMemberNS:
+		return map[string]interface{}{"NS": v.Value}
+	case *types.AttributeValueMemberBS:
+		return map[string]interface{}{"BS": v.Value}
+	case *types.AttributeValueMemberL:
+		list := make([]interface{}, 0, len(v.Value))
+		for _, item := range v.Value {
+			list = append(list, typedJSON(item))
+		}
+		return map[string]interface{}{"L": list}
+	case *types.AttributeValueMemberM:
+		members := make(map[string]interface{}, len(v.Value))
+		for name, item := range v.Value {
+			members[name] = typedJSON(item)
+		}
+		return map[string]interface{}{"M": members}
+	}
+	return map[string]interface{}{"NULL": true}
+}
+
+// typedValue is one attribute in DynamoDB's typed JSON
+type typedValue struct {
+	S    *string               `json:"S"`
+	N    *string               `json:"N"`
+	BOOL *bool                 `json:"BOOL"`
+	NULL *bool                 `json:"NULL"`
+	B    *string               `json:"B"`
+	SS   []string              `json:"SS"`
+	NS   []string              `json:"NS"`
+	BS   []string              `json:"BS"`
+	L    []typedValue          `json:"L"`
+	M    map[string]typedValue `json:"M"`
+}
+
+// Helper function to decode an item from DynamoDB's typed JSON
+func decodeTypedItem(encoded map[string]json.RawMessage) (map[string]types.AttributeValue, error) {
+	item := make(map[string]types.AttributeValue, len(encoded))
+	for name, raw := range encoded {
+		var value typedValue
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, fmt.Errorf("attribute %s: %w", name, err)
+		}
+		attr, err := value.attributeValue()
+		if err != nil {
+			return nil, fmt.Errorf("attribute %s: %w", name, err)
+		}
+		item[name] = attr
+	}
+	return item, nil
+}
+
+func (v typedValue) attributeValue() (types.AttributeValue, error) {
+	switch {
+	case v.S != nil:
+		return &types.AttributeValueMemberS{Value: *v.S}, nil
+	case v.N != nil:
+		return &types.AttributeValueMemberN{Value: *v.N}, nil
+	case v.BOOL != nil:
+		return &types.AttributeValueMemberBOOL{Value: *v.BOOL}, nil
+	case v.NULL != nil:
+		return &types.AttributeValueMemberNULL{Value: true}, nil
+	case v.B != nil:
+		data, err := base64.StdEncoding.DecodeString(*v.B)
+		return &types.AttributeValueMemberB{Value: data}, err
+	case v.SS != nil:
+		return &types.AttributeValueMemberSS{Value: v.SS}, nil
+	case v.NS != nil:
+		return &types.AttributeValueMemberNS{Value: v.NS}, nil
+	case v.BS != nil:
+		values := make([][]byte, 0, len(v.BS))
+		for _, encoded := range v.BS {
+			data, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, data)
+		}
+		return &types.AttributeValueMemberBS{Value: values}, nil
+	case v.L != nil:
+		list := make([]types.AttributeValue, 0, len(v.L))
+		for _, item := range v.L {
+			attr, err := item.attributeValue()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, attr)
+		}
+		return &types.AttributeValueMemberL{Value: list}, nil
+	case v.M != nil:
+		members := make(map[string]types.AttributeValue, len(v.M))
+		for name, item := range v.M {
+			attr, err := item.attributeValue()
+			if err != nil {
+				return nil, err
+			}
+			members[name] = attr
+		}
+		return &types.AttributeValueMemberM{Value: members}, nil
+	}
+	return nil, fmt.Errorf("no recognized type")
+}
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"April32025/internal/api"
+	"April32025/internal/catalog"
+	"April32025/internal/config"
+	"April32025/internal/rules"
+)
+
+// With a DynamoDB Streams event source mapping on the catalog tables, item
+// changes invoke the function with a batch of stream records. The affected
+// catalogs' caches are patched or dropped and their knowledge bases rebuilt
+// straight away, so the rebuild cost is paid here rather than by the next user
+// request. catalog/invalidation.go covers how other warm containers find out.
+const dynamoDBEventSource = "aws:dynamodb"
+
+// Function to detect a DynamoDB Streams invocation
+func parseStreamEvent(event json.RawMessage) (*events.DynamoDBEvent, bool) {
+	var streamEvent events.DynamoDBEvent
+	if err := json.Unmarshal(event, &streamEvent); err != nil || len(streamEvent.Records) == 0 {
+		return nil, false
+	}
+	for _, record := range streamEvent.Records {
+		if record.EventSource != dynamoDBEventSource {
+			return nil, false
+		}
+	}
+	return &streamEvent, true
+}
+
+// Helper function to get the table name out of a stream ARN, e.g.
+// arn:aws:dynamodb:us-east-2:123456789012:table/CountryMusicRepo/stream/2025-04-03T00:00:00.000
+func streamTableName(arn string) string {
+	_, rest, ok := strings.Cut(arn, ":table/")
+	if !ok {
+		return ""
+	}
+	table, _, _ := strings.Cut(rest, "/")
+	return table
+}
+
+// Function to rebuild the knowledge base of every catalog touched by a batch
+// of stream records. Returning an error makes Lambda retry the batch.
+func handleStreamEvent(ctx context.Context, streamEvent *events.DynamoDBEvent) (json.RawMessage, error) {
+	// Several genres may be served from one table
+	catalogsByTable := make(map[string][]config.Catalog)
+	for _, c := range config.ConfiguredCatalogs() {
+		catalogsByTable[c.Table] = append(catalogsByTable[c.Table], c)
+	}
+
+	changed := make(map[string]config.Catalog)
+	recordsByGenre := make(map[string][]events.DynamoDBEventRecord)
+	for _, record := range streamEvent.Records {
+		table := streamTableName(record.EventSourceArn)
+		catalogs, ok := catalogsByTable[table]
+		if !ok {
+			fmt.Println("Ignoring stream record for unknown table: " + table)
+			continue
+		}
+		for _, c := range catalogs {
+			changed[c.Genre] = c
+			recordsByGenre[c.Genre] = append(recordsByGenre[c.Genre], record)
+		}
+	}
+	if len(changed) == 0 {
+		return json.Marshal(map[string]interface{}{"rebuilt": []string{}})
+	}
+
+	cfg, err := config.LoadSDKConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load SDK config: %w", err)
+	}
+	svc := config.NewDynamoDBClient(cfg)
+	reader := catalog.WithReadSettings(svc, catalog.CatalogReadSettingsFor(api.Invocation{}))
+
+	rebuilt := []string{}
+	for _, genre := range slices.Sorted(maps.Keys(changed)) {
+		c := changed[genre]
+		if err := catalog.BumpCatalogGeneration(ctx, svc, c); err != nil {
+			return nil, err
+		}
+
+		change := catalog.CollectCatalogChange(recordsByGenre[genre])
+		var documents []catalog.CountryMusicDocument
+		patched := false
+		if change.Complete {
+			documents, patched = catalog.PatchCatalogCache(c, change)
+		}
+		if !patched {
+			catalog.EvictCatalogCache(c)
+			if documents, err = catalog.LoadCatalog(ctx, reader, c); err != nil {
+				return nil, fmt.Errorf("failed to scan %s catalog: %w", genre, err)
+			}
+		}
+
+		catalog.ReportRejectedItems(ctx, svc, c)
+		documents = catalog.ActiveSongs(documents, time.Now())
+
+		ruleSource, err := rules.NewRuleSource(cfg, c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule source configuration: %w", err)
+		}
+		if _, _, err := rules.BuildKnowledgeBases(ctx, c, ruleSource, documents); err != nil {
+			return nil, fmt.Errorf("failed to rebuild %s knowledge base: %w", genre, err)
+		}
+		fmt.Printf("Rebuilt %s knowledge base from %d documents after stream update (patched cache: %t)\n", genre, len(documents), patched)
+		rebuilt = append(rebuilt, genre)
+	}
+	return json.Marshal(map[string]interface{}{"rebuilt": rebuilt})
+}
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"April32025/internal/scoring"
+)
+
+// Tiers and the songs' theme combinations are eligibility gates, so they hold
+// whichever scorer runs. In the fixture catalog song-7 is premium-only and
+// song-8 is excluded for listeners who select love.
+func TestGatedSongsUnderEveryScorer(t *testing.T) {
+	t.Setenv("AWS_REGION", "us-east-2")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("CATALOG_STORE", "memory")
+	t.Setenv("CATALOG_FILE", "testdata/catalog.json")
+
+	for _, scorer := range []string{scoring.ScorerRules, scoring.ScorerSimilarity, scoring.ScorerSimulation} {
+		for _, tier := range []string{scoring.TierFree, scoring.TierPremium} {
+			request, _ := json.Marshal(map[string]interface{}{
+				"scorer": scorer,
+				"tier":   tier,
+				"themes": map[string]bool{"love": true, "lessons": true, "rebellion": true, "goodtimes": true},
+				"limit":  20,
+			})
+			response, err := HandleRequest(context.Background(), request)
+			if err != nil {
+				t.Fatalf("%s scorer, %s tier: request failed: %v", scorer, tier, err)
+			}
+			var body struct {
+				Recommendations []struct{ RuleID string }
+			}
+			if err := json.Unmarshal(response, &body); err != nil {
+				t.Fatalf("%s scorer, %s tier: response is not JSON: %v", scorer, tier, err)
+			}
+
+			served := make(map[string]bool)
+			for _, rec := range body.Recommendations {
+				served[rec.RuleID] = true
+			}
+			if served["song-7"] != (tier == scoring.TierPremium) {
+				t.Errorf("%s scorer, %s tier: premium song served is %t", scorer, tier, served["song-7"])
+			}
+			if served["song-8"] {
+				t.Errorf("%s scorer, %s tier: served a song that excludes a selected theme", scorer, tier)
+			}
+		}
+	}
+}
+
+// The default playlist runs the same eligibility stage, so a premium song
+// listed in it is skipped for free listeners
+func TestGatedSongsInDefaultPlaylist(t *testing.T) {
+	t.Setenv("AWS_REGION", "us-east-2")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("CATALOG_STORE", "memory")
+	t.Setenv("CATALOG_FILE", "testdata/catalog.json")
+	t.Setenv("DEFAULT_PLAYLIST", "song-7,song-1")
+
+	for _, tier := range []string{scoring.TierFree, scoring.TierPremium} {
+		request, _ := json.Marshal(map[string]interface{}{"tier": tier})
+		response, err := HandleRequest(context.Background(), request)
+		if err != nil {
+			t.Fatalf("%s tier: request failed: %v", tier, err)
+		}
+		var body struct {
+			DefaultPlaylist bool
+			Recommendations []struct{ RuleID string }
+		}
+		if err := json.Unmarshal(response, &body); err != nil {
+			t.Fatalf("%s tier: response is not JSON: %v", tier, err)
+		}
+		var served []string
+		for _, rec := range body.Recommendations {
+			served = append(served, rec.RuleID)
+		}
+		want := "song-1"
+		if tier == scoring.TierPremium {
+			want = "song-7,song-1"
+		}
+		if !body.DefaultPlaylist || strings.Join(served, ",") != want {
+			t.Errorf("%s tier: default playlist served %v, want %s", tier, served, want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package respond
+
+import (
+	"encoding/xml"
+	"fmt"
+	"time"
+
+	"April32025/internal/api"
+	"April32025/internal/config"
+)
+
+// Feeds are meant to be polled daily. Every item is stamped with the day it
+// was generated and its id includes that date, so a reader shows the day's
+// picks as new entries even when the same song comes back.
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link,omitempty"`
+	Description string  `xml:"description,omitempty"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type atomFeed struct {
+	XMLName   xml.Name    `xml:"feed"`
+	Namespace string      `xml:"xmlns,attr"`
+	Title     string      `xml:"title"`
+	ID        string      `xml:"id"`
+	Updated   string      `xml:"updated"`
+	Links     []atomLink  `xml:"link"`
+	Entries   []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title   string     `xml:"title"`
+	ID      string     `xml:"id"`
+	Updated string     `xml:"updated"`
+	Links   []atomLink `xml:"link,omitempty"`
+	Summary string     `xml:"summary,omitempty"`
+	Author  atomAuthor `xml:"author"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+const feedTitle = "Country Song of the Day"
+
+// Helper function to pick the link the feed points back to
+func feedLink(inv api.Invocation) string {
+	if inv.SelfURL != "" {
+		return inv.SelfURL
+	}
+	return config.Env("FEED_SITE_URL", "")
+}
+
+// Helper function to build a stable per-day entry id
+func feedItemID(ruleID string, day string) string {
+	return fmt.Sprintf("urn:songrecs:%s:%s", ruleID, day)
+}
+
+// Function to render recommendations as an RSS 2.0 document
+func renderRSS(recs []Recommendation, link string, now time.Time) ([]byte, error) {
+	day := now.UTC().Truncate(24 * time.Hour)
+	channel := rssChannel{
+		Title:         feedTitle,
+		Link:          link,
+		Description:   "Daily country music picks for your favorite themes",
+		LastBuildDate: now.UTC().Format(time.RFC1123Z),
+		Items:         []rssItem{},
+	}
+	for _, rec := range recs {
+		channel.Items = append(channel.Items, rssItem{
+			Title:       rec.Artist + " - " + rec.Title,
+			Link:        rec.VideoLink,
+			Description: rec.LyricQuote,
+			GUID:        rssGUID{IsPermaLink: "false", Value: feedItemID(rec.RuleID, day.Format("2006-01-02"))},
+			PubDate:     day.Format(time.RFC1123Z),
+		})
+	}
+
+	body, err := xml.MarshalIndent(rssFeed{Version: "2.0", Channel: channel}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// Function to render recommendations as an Atom 1.0 document
+func renderAtom(recs []Recommendation, link string, now time.Time) ([]byte, error) {
+	day := now.UTC().Truncate(24 * time.Hour)
+	feed := atomFeed{
+		Namespace: "http://www.w3.org/2005/Atom",
+		Title:     feedTitle,
+		ID:        "urn:songrecs:feed:" + day.Format("2006-01-02"),
+		Updated:   now.UTC().Format(time.RFC3339),
+		Entries:   []atomEntry{},
+	}
+	if link != "" {
+		feed.ID = link
+		feed.Links = []atomLink{{Href: link, Rel: "self"}}
+	}
+	for _, rec := range recs {
+		entry := atomEntry{
+			Title:   rec.Artist + " - " + rec.Title,
+			ID:      feedItemID(rec.RuleID, day.Format("2006-01-02")),
+			Updated: day.Format(time.RFC3339),
+			Summary: rec.LyricQuote,
+			Author:  atomAuthor{Name: rec.Artist},
+		}
+		if rec.VideoLink != "" {
+			entry.Links = []atomLink{{Href: rec.VideoLink}}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	body, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
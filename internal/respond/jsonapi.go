@@ -0,0 +1,163 @@
+package respond
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"April32025/internal/api"
+	"April32025/internal/config"
+)
+
+// JSON:API (https://jsonapi.org/format/1.1/) representation of a response.
+// Songs are the primary data; each song relates to an artist resource, and
+// the artists are sideloaded in "included".
+
+const jsonAPIContentType = "application/vnd.api+json"
+
+type jsonAPIDocument struct {
+	Data     []jsonAPIResource `json:"data"`
+	Included []jsonAPIResource `json:"included"`
+	Links    map[string]string `json:"links,omitempty"`
+	Meta     jsonAPIMeta       `json:"meta"`
+}
+
+type jsonAPIResource struct {
+	Type          string                         `json:"type"`
+	ID            string                         `json:"id"`
+	Attributes    map[string]interface{}         `json:"attributes"`
+	Relationships map[string]jsonAPIRelationship `json:"relationships,omitempty"`
+	Links         map[string]string              `json:"links,omitempty"`
+}
+
+type jsonAPIRelationship struct {
+	Data  jsonAPIIdentifier `json:"data"`
+	Links map[string]string `json:"links,omitempty"`
+}
+
+type jsonAPIIdentifier struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type jsonAPIMeta struct {
+	RequestID      string            `json:"requestId"`
+	EngineVersion  string            `json:"engineVersion"`
+	RulesEvaluated int               `json:"rulesEvaluated"`
+	CatalogSize    int               `json:"catalogSize"`
+	Timing         ResponseTiming    `json:"timing"`
+	TotalMatches   int               `json:"totalMatches"`
+	PageSize       int               `json:"pageSize"`
+	ThemeLabels    map[string]string `json:"themeLabels"`
+}
+
+var nonSlugCharacters = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Helper function to turn an artist name into a stable resource id
+func artistID(artist string) string {
+	return strings.Trim(nonSlugCharacters.ReplaceAllString(strings.ToLower(artist), "-"), "-")
+}
+
+// Helper function to pick the base URL resource links hang off. API_BASE_URL
+// wins; otherwise the origin of the URL the request came in on is used.
+func jsonAPIBaseURL(inv api.Invocation) string {
+	if base := config.Env("API_BASE_URL", ""); base != "" {
+		return strings.TrimSuffix(base, "/")
+	}
+	if parsed, err := url.Parse(inv.SelfURL); err == nil && parsed.Host != "" {
+		return parsed.Scheme + "://" + parsed.Host
+	}
+	return ""
+}
+
+// Helper function to link to another page of the same request: the query
+// the client sent with only its cursor replaced
+func jsonAPIPageURL(inv api.Invocation, cursor string) string {
+	query := url.Values{}
+	for key, value := range inv.Query {
+		query.Set(key, value)
+	}
+	query.Set("cursor", cursor)
+	return inv.SelfURL + "?" + query.Encode()
+}
+
+// Function to render the response envelope as a JSON:API document
+func renderJSONAPI(response RecommendationResponse, inv api.Invocation) ([]byte, error) {
+	base := jsonAPIBaseURL(inv)
+	document := jsonAPIDocument{
+		Data:     []jsonAPIResource{},
+		Included: []jsonAPIResource{},
+		Meta: jsonAPIMeta{
+			RequestID:      response.RequestID,
+			EngineVersion:  response.EngineVersion,
+			RulesEvaluated: response.RulesEvaluated,
+			CatalogSize:    response.CatalogSize,
+			Timing:         response.Timing,
+			TotalMatches:   response.TotalMatches,
+			PageSize:       response.PageSize,
+			ThemeLabels:    response.ThemeLabels,
+		},
+	}
+
+	if inv.SelfURL != "" {
+		document.Links = map[string]string{"self": inv.SelfURL}
+		if response.NextCursor != "" {
+			document.Links["next"] = jsonAPIPageURL(inv, response.NextCursor)
+		}
+	}
+
+	seenArtists := make(map[string]bool)
+	for _, rec := range response.Recommendations {
+		song := jsonAPIResource{
+			Type: "songs",
+			ID:   rec.RuleID,
+			Attributes: map[string]interface{}{
+				"artist":             rec.Artist,
+				"title":              rec.Title,
+				"lyricQuote":         rec.LyricQuote,
+				"videoLink":          rec.VideoLink,
+				"year":               rec.Year,
+				"popularity":         rec.Popularity,
+				"tempo":              rec.Tempo,
+				"intensity":          rec.Intensity,
+				"themes":             rec.Themes,
+				"spotifyLink":        rec.SpotifyLink,
+				"appleMusicLink":     rec.AppleMusicLink,
+				"youTubeMusicLink":   rec.YouTubeMusicLink,
+				"score":              rec.Score,
+				"confidence":         rec.Confidence,
+				"matchTier":          rec.MatchTier,
+				"breakdown":          rec.Breakdown,
+				"rank":               rec.Rank,
+				"matchedThemes":      rec.MatchedThemes,
+				"themeContributions": rec.ThemeContributions,
+				"rule":               rec.Rule,
+			},
+		}
+		if base != "" {
+			song.Links = map[string]string{"self": base + "/songs/" + url.PathEscape(rec.RuleID)}
+		}
+
+		if id := artistID(rec.Artist); id != "" {
+			relationship := jsonAPIRelationship{Data: jsonAPIIdentifier{Type: "artists", ID: id}}
+			if base != "" {
+				relationship.Links = map[string]string{"related": base + "/artists/" + id}
+			}
+			song.Relationships = map[string]jsonAPIRelationship{"artist": relationship}
+
+			if !seenArtists[id] {
+				seenArtists[id] = true
+				artist := jsonAPIResource{Type: "artists", ID: id, Attributes: map[string]interface{}{"name": rec.Artist}}
+				if base != "" {
+					artist.Links = map[string]string{"self": base + "/artists/" + id}
+				}
+				document.Included = append(document.Included, artist)
+			}
+		}
+
+		document.Data = append(document.Data, song)
+	}
+
+	return json.Marshal(document)
+}
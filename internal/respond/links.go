@@ -0,0 +1,42 @@
+package respond
+
+import (
+	"net/url"
+	"strings"
+
+	"April32025/internal/catalog"
+)
+
+// Search pages used when the catalog has no direct link for a service
+const (
+	spotifySearchURL      = "https://open.spotify.com/search/"
+	appleMusicSearchURL   = "https://music.apple.com/us/search?term="
+	youTubeMusicSearchURL = "https://music.youtube.com/search?q="
+)
+
+// Function to fill any missing streaming links with search URLs built from
+// the artist and title
+func withStreamingLinks(doc catalog.CountryMusicDocument) catalog.CountryMusicDocument {
+	query := strings.TrimSpace(doc.Artist + " " + doc.Title)
+	if query == "" {
+		return doc
+	}
+
+	if doc.SpotifyLink == "" {
+		doc.SpotifyLink = spotifySearchURL + url.PathEscape(query)
+	}
+	if doc.AppleMusicLink == "" {
+		doc.AppleMusicLink = appleMusicSearchURL + url.QueryEscape(query)
+	}
+	if doc.YouTubeMusicLink == "" {
+		doc.YouTubeMusicLink = youTubeMusicSearchURL + url.QueryEscape(query)
+	}
+	return doc
+}
+
+// Helper function to tell a generated search link from a catalog link
+func isSearchLink(link string) bool {
+	return strings.HasPrefix(link, spotifySearchURL) ||
+		strings.HasPrefix(link, appleMusicSearchURL) ||
+		strings.HasPrefix(link, youTubeMusicSearchURL)
+}
@@ -0,0 +1,143 @@
+package respond
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/cloudfront/sign"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"April32025/internal/config"
+)
+
+// When media moves to a private bucket or distribution, VideoLink values are
+// replaced with short-lived signed URLs. MEDIA_URL_SIGNER picks the scheme:
+//
+//	s3         - VideoLink is s3://bucket/key, or a bare key in MEDIA_BUCKET
+//	cloudfront - VideoLink is a URL on MEDIA_CLOUDFRONT_DOMAIN, or a bare path
+//	             on it; signed with MEDIA_CLOUDFRONT_KEY_PAIR_ID and the PEM in
+//	             MEDIA_CLOUDFRONT_PRIVATE_KEY
+//
+// Links pointing anywhere else (YouTube and friends) are left alone.
+const (
+	mediaSignerS3         = "s3"
+	mediaSignerCloudFront = "cloudfront"
+
+	defaultMediaURLTTLSeconds = 900
+)
+
+// mediaURLSigner rewrites a stored media link into one the client can fetch
+type mediaURLSigner interface {
+	SignLink(ctx context.Context, link string) (string, error)
+}
+
+type s3MediaSigner struct {
+	presigner *s3.PresignClient
+	bucket    string
+	ttl       time.Duration
+}
+
+func (s s3MediaSigner) SignLink(ctx context.Context, link string) (string, error) {
+	bucket, key := s.bucket, link
+	if strings.HasPrefix(link, "s3://") {
+		bucket, key, _ = strings.Cut(strings.TrimPrefix(link, "s3://"), "/")
+	} else if strings.Contains(link, "://") || bucket == "" {
+		return link, nil
+	}
+
+	req, err := s.presigner.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(s.ttl))
+	if err != nil {
+		return "", err
+	}
+	return req.URL, nil
+}
+
+type cloudFrontMediaSigner struct {
+	signer *sign.URLSigner
+	domain string
+	ttl    time.Duration
+}
+
+func (s cloudFrontMediaSigner) SignLink(ctx context.Context, link string) (string, error) {
+	if !strings.Contains(link, "://") {
+		link = "https://" + s.domain + "/" + strings.TrimPrefix(link, "/")
+	}
+	parsed, err := url.Parse(link)
+	if err != nil || !strings.EqualFold(parsed.Host, s.domain) {
+		return link, nil
+	}
+	return s.signer.Sign(link, time.Now().Add(s.ttl))
+}
+
+// Function to build the configured signer, nil when signing is off
+func newMediaURLSigner(cfg aws.Config) (mediaURLSigner, error) {
+	ttlSeconds, err := strconv.Atoi(config.Env("MEDIA_URL_TTL_SECONDS", strconv.Itoa(defaultMediaURLTTLSeconds)))
+	if err != nil || ttlSeconds <= 0 {
+		ttlSeconds = defaultMediaURLTTLSeconds
+	}
+	ttl := time.Duration(ttlSeconds) * time.Second
+
+	switch config.Env("MEDIA_URL_SIGNER", "") {
+	case "":
+		return nil, nil
+	case mediaSignerS3:
+		return s3MediaSigner{
+			presigner: s3.NewPresignClient(config.NewS3Client(cfg)),
+			bucket:    config.Env("MEDIA_BUCKET", ""),
+			ttl:       ttl,
+		}, nil
+	case mediaSignerCloudFront:
+		domain := config.Env("MEDIA_CLOUDFRONT_DOMAIN", "")
+		keyPairID := config.Env("MEDIA_CLOUDFRONT_KEY_PAIR_ID", "")
+		if domain == "" || keyPairID == "" {
+			return nil, fmt.Errorf("MEDIA_CLOUDFRONT_DOMAIN and MEDIA_CLOUDFRONT_KEY_PAIR_ID are required for CloudFront signing")
+		}
+		key, err := loadCloudFrontKey(config.Env("MEDIA_CLOUDFRONT_PRIVATE_KEY", ""))
+		if err != nil {
+			return nil, err
+		}
+		return cloudFrontMediaSigner{signer: sign.NewURLSigner(keyPairID, key), domain: domain, ttl: ttl}, nil
+	default:
+		return nil, fmt.Errorf("unknown MEDIA_URL_SIGNER '%s'", config.Env("MEDIA_URL_SIGNER", ""))
+	}
+}
+
+// Helper function to parse a CloudFront key in either PKCS#1 or PKCS#8 PEM form
+func loadCloudFrontKey(pemKey string) (crypto.Signer, error) {
+	if pemKey == "" {
+		return nil, fmt.Errorf("MEDIA_CLOUDFRONT_PRIVATE_KEY is required for CloudFront signing")
+	}
+	if key, err := sign.LoadPEMPrivKey(strings.NewReader(pemKey)); err == nil {
+		return key, nil
+	}
+	return sign.LoadPEMPrivKeyPKCS8AsSigner(strings.NewReader(pemKey))
+}
+
+// Function to replace each recommendation's VideoLink with a signed URL
+func SignMediaLinks(ctx context.Context, cfg aws.Config, recs []Recommendation) error {
+	signer, err := newMediaURLSigner(cfg)
+	if err != nil || signer == nil {
+		return err
+	}
+
+	for i := range recs {
+		if recs[i].VideoLink == "" {
+			continue
+		}
+		signed, err := signer.SignLink(ctx, recs[i].VideoLink)
+		if err != nil {
+			return fmt.Errorf("failed to sign media link for %s: %w", recs[i].RuleID, err)
+		}
+		recs[i].VideoLink = signed
+	}
+	return nil
+}
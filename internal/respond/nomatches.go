@@ -0,0 +1,100 @@
+package respond
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+
+	"April32025/internal/catalog"
+	"April32025/internal/scoring"
+)
+
+// When nothing is left after minScore (see scoring/minscore.go) the response
+// still comes back 404, now with a "noMatches" explanation: why nothing
+// matched, the songs that came closest and the themes that would have brought
+// them in.
+const (
+	maxNearestMisses   = 3
+	maxSuggestedThemes = 5
+
+	noMatchNothingSelected = "nothing_selected"
+	noMatchAllIneligible   = "all_ineligible"
+	noMatchNoThemes        = "no_theme_matches"
+	noMatchBelowMinScore   = "below_min_score"
+)
+
+// noMatchExplanation tells a client why a request matched nothing
+type noMatchExplanation struct {
+	Reason          string        `json:"reason"`
+	Message         string        `json:"message"`
+	MinScore        int           `json:"minScore"`
+	NearestMisses   []nearestMiss `json:"nearestMisses"`
+	SuggestedThemes []string      `json:"suggestedThemes"` // unselected theme keys of the nearest misses, most common first
+}
+
+// nearestMiss is a song that was scored but fell below minScore
+type nearestMiss struct {
+	RuleID        string   `json:"ruleId"`
+	Artist        string   `json:"artist"`
+	Title         string   `json:"title"`
+	Score         int      `json:"score"`
+	MatchedThemes []string `json:"matchedThemes"`
+}
+
+// Function to explain an empty result from the selections and the songs
+// dropIneligible and dropBelowMinScore took out
+func ExplainNoMatches(documents []catalog.CountryMusicDocument, p *scoring.UserSelections, dropped map[string]int) *noMatchExplanation {
+	explanation := &noMatchExplanation{MinScore: p.Config().MinScore, NearestMisses: []nearestMiss{}, SuggestedThemes: []string{}}
+	switch {
+	case len(p.Selected) == 0:
+		explanation.Reason = noMatchNothingSelected
+		explanation.Message = "no known themes were selected"
+		return explanation
+	case len(documents) > 0 && len(p.Ineligible) >= len(documents):
+		explanation.Reason = noMatchAllIneligible
+		explanation.Message = "every song was excluded by the decade, required theme, artist or explicit content filters"
+		return explanation
+	case len(dropped) == 0:
+		explanation.Reason = noMatchNoThemes
+		explanation.Message = "no eligible song has any of the selected themes"
+		return explanation
+	}
+	explanation.Reason = noMatchBelowMinScore
+	explanation.Message = fmt.Sprintf("songs matched, but none scored at least %d", explanation.MinScore)
+
+	missIDs := slices.Sorted(maps.Keys(dropped))
+	sort.SliceStable(missIDs, func(i, j int) bool {
+		return dropped[missIDs[i]] > dropped[missIDs[j]]
+	})
+	missIDs = missIDs[:min(len(missIDs), maxNearestMisses)]
+
+	documentsByID := make(map[string]catalog.CountryMusicDocument, len(documents))
+	for _, document := range documents {
+		documentsByID[document.RuleID] = document
+	}
+	themeCounts := make(map[string]int)
+	for _, songId := range missIDs {
+		document := documentsByID[songId]
+		matchedThemes, _ := explainMatches(document, p.Contributions[songId])
+		explanation.NearestMisses = append(explanation.NearestMisses, nearestMiss{
+			RuleID:        songId,
+			Artist:        document.Artist,
+			Title:         document.Title,
+			Score:         dropped[songId],
+			MatchedThemes: matchedThemes,
+		})
+		for key, desc := range document.Themes {
+			if name, known := catalog.CanonicalTheme(key); known && desc != "" && !p.Selected[name] {
+				themeCounts[key]++
+			}
+		}
+	}
+
+	suggested := slices.Sorted(maps.Keys(themeCounts))
+	sort.SliceStable(suggested, func(i, j int) bool {
+		return themeCounts[suggested[i]] > themeCounts[suggested[j]]
+	})
+	explanation.SuggestedThemes = suggested[:min(len(suggested), maxSuggestedThemes)]
+	return explanation
+}
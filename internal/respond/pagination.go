@@ -0,0 +1,75 @@
+package respond
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	"April32025/internal/api"
+)
+
+// Page sizes for the "limit" request option. The default matches the three
+// songs the function has always returned.
+const (
+	defaultPageSize = 3
+	maxPageSize     = 50
+	cursorPrefix    = "offset:"
+)
+
+// PageRequest is the slice of the ranked matches a request asked for
+type PageRequest struct {
+	Offset int
+	Limit  int
+}
+
+// Function to read the page size and cursor from the request
+func ParsePageRequest(incoming api.IncomingRequest) (PageRequest, error) {
+	page := PageRequest{Limit: defaultPageSize}
+
+	if incoming.Limit != 0 {
+		if incoming.Limit < 0 || incoming.Limit > maxPageSize {
+			return page, api.BadRequest("invalid_limit", "limit must be between 1 and %d", maxPageSize)
+		}
+		page.Limit = incoming.Limit
+	}
+
+	if incoming.Cursor != "" {
+		offset, err := decodeCursor(incoming.Cursor)
+		if err != nil {
+			return page, api.BadRequest("invalid_cursor", "cursor is not one returned by this API")
+		}
+		page.Offset = offset
+	}
+	return page, nil
+}
+
+// Cursors are opaque to clients; today they only carry the next offset
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	offset, err := strconv.Atoi(strings.TrimPrefix(string(raw), cursorPrefix))
+	if err != nil || !strings.HasPrefix(string(raw), cursorPrefix) || offset < 0 {
+		return 0, strconv.ErrSyntax
+	}
+	return offset, nil
+}
+
+// Function to cut one page out of the ranked RuleIDs, returning the cursor
+// for the following page or "" when this is the last one
+func PageRuleIDs(rankedRuleIDs []string, page PageRequest) ([]string, string) {
+	if page.Offset >= len(rankedRuleIDs) {
+		return []string{}, ""
+	}
+
+	end := page.Offset + page.Limit
+	if end >= len(rankedRuleIDs) {
+		return rankedRuleIDs[page.Offset:], ""
+	}
+	return rankedRuleIDs[page.Offset:end], encodeCursor(end)
+}
@@ -0,0 +1,86 @@
+package respond
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// xspfPlaylist follows the XSPF 1 schema (https://xspf.org/spec)
+type xspfPlaylist struct {
+	XMLName   xml.Name    `xml:"playlist"`
+	Version   string      `xml:"version,attr"`
+	Namespace string      `xml:"xmlns,attr"`
+	Title     string      `xml:"title"`
+	Tracks    []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Location   string `xml:"location"`
+	Identifier string `xml:"identifier,omitempty"`
+	Title      string `xml:"title"`
+	Creator    string `xml:"creator"`
+	Annotation string `xml:"annotation,omitempty"`
+}
+
+const playlistTitle = "Country Song Recommendations"
+
+// Helper function to pick the link a media player should open for a song. Only
+// real catalog links qualify; search-page fallbacks aren't playable.
+func playableLink(rec Recommendation) string {
+	if rec.VideoLink != "" {
+		return rec.VideoLink
+	}
+	if rec.YouTubeMusicLink != "" && !isSearchLink(rec.YouTubeMusicLink) {
+		return rec.YouTubeMusicLink
+	}
+	return ""
+}
+
+// Function to render recommendations as an extended M3U playlist. Songs
+// without a playable link are left out since players can't open them.
+func renderM3U(recs []Recommendation) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("#EXTM3U\n")
+	buf.WriteString("#PLAYLIST:" + playlistTitle + "\n")
+	for _, rec := range recs {
+		link := playableLink(rec)
+		if link == "" {
+			continue
+		}
+		// A line break would end the EXTINF entry early
+		title := strings.NewReplacer("\n", " ", "\r", " ").Replace(rec.Artist + " - " + rec.Title)
+		fmt.Fprintf(&buf, "#EXTINF:-1,%s\n%s\n", title, link)
+	}
+	return buf.Bytes()
+}
+
+// Function to render recommendations as an XSPF playlist
+func renderXSPF(recs []Recommendation) ([]byte, error) {
+	playlist := xspfPlaylist{
+		Version:   "1",
+		Namespace: "http://xspf.org/ns/0/",
+		Title:     playlistTitle,
+		Tracks:    []xspfTrack{},
+	}
+	for _, rec := range recs {
+		link := playableLink(rec)
+		if link == "" {
+			continue
+		}
+		playlist.Tracks = append(playlist.Tracks, xspfTrack{
+			Location:   link,
+			Identifier: rec.RuleID,
+			Title:      rec.Title,
+			Creator:    rec.Artist,
+			Annotation: rec.LyricQuote,
+		})
+	}
+
+	body, err := xml.MarshalIndent(playlist, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
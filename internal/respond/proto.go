@@ -0,0 +1,162 @@
+package respond
+
+import (
+	"maps"
+	"slices"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"April32025/internal/scoring"
+)
+
+// Hand-written encoder for proto/recommendations.proto. The response is small
+// and flat enough that generated code isn't worth a protoc step in the build.
+// Zero values are skipped, matching proto3's implicit presence, and map
+// entries are written in key order so the output is deterministic.
+
+func appendProtoString(b []byte, num protowire.Number, value string) []byte {
+	if value == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, value)
+}
+
+func appendProtoInt(b []byte, num protowire.Number, value int64) []byte {
+	if value == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(value))
+}
+
+func appendProtoBool(b []byte, num protowire.Number, value bool) []byte {
+	if !value {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, protowire.EncodeBool(value))
+}
+
+func appendProtoMessage(b []byte, num protowire.Number, message []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, message)
+}
+
+func appendProtoStringMap(b []byte, num protowire.Number, m map[string]string) []byte {
+	for _, key := range slices.Sorted(maps.Keys(m)) {
+		var entry []byte
+		entry = appendProtoString(entry, 1, key)
+		entry = appendProtoString(entry, 2, m[key])
+		b = appendProtoMessage(b, num, entry)
+	}
+	return b
+}
+
+func appendProtoIntMap(b []byte, num protowire.Number, m map[string]int) []byte {
+	for _, key := range slices.Sorted(maps.Keys(m)) {
+		var entry []byte
+		entry = appendProtoString(entry, 1, key)
+		entry = appendProtoInt(entry, 2, int64(m[key]))
+		b = appendProtoMessage(b, num, entry)
+	}
+	return b
+}
+
+// Function to encode the response envelope as a songrecs.v1.RecommendationResponse
+func encodeProtoResponse(response RecommendationResponse) []byte {
+	var b []byte
+	b = appendProtoString(b, 1, response.RequestID)
+	b = appendProtoString(b, 2, response.EngineVersion)
+	b = appendProtoInt(b, 3, int64(response.RulesEvaluated))
+	b = appendProtoInt(b, 4, int64(response.CatalogSize))
+
+	var timing []byte
+	timing = appendProtoInt(timing, 1, response.Timing.CatalogLoadMs)
+	timing = appendProtoInt(timing, 2, response.Timing.RuleBuildMs)
+	timing = appendProtoInt(timing, 3, response.Timing.ExecuteMs)
+	timing = appendProtoInt(timing, 4, response.Timing.TotalMs)
+	b = appendProtoMessage(b, 5, timing)
+
+	b = appendProtoInt(b, 6, int64(response.TotalMatches))
+	b = appendProtoInt(b, 7, int64(response.PageSize))
+	b = appendProtoString(b, 8, response.NextCursor)
+	b = appendProtoStringMap(b, 9, response.ThemeLabels)
+	for _, rec := range response.Recommendations {
+		b = appendProtoMessage(b, 10, encodeProtoRecommendation(rec))
+	}
+	b = appendProtoString(b, 11, response.Genre)
+	b = appendProtoBool(b, 12, response.Partial)
+	b = appendProtoString(b, 13, response.PartialReason)
+	b = appendProtoString(b, 14, response.RulesVersion)
+	b = appendProtoString(b, 15, response.RankerVersion)
+	b = appendProtoBool(b, 16, response.DefaultPlaylist)
+	return b
+}
+
+// Function to encode one songrecs.v1.RuleMetadata
+func encodeProtoRuleMetadata(rule RuleMetadata) []byte {
+	var b []byte
+	b = appendProtoString(b, 1, rule.Name)
+	b = appendProtoString(b, 2, rule.Description)
+	b = appendProtoString(b, 3, rule.Curator)
+	b = appendProtoString(b, 4, rule.CreatedAt)
+	return b
+}
+
+// Function to encode one songrecs.v1.Recommendation
+func encodeProtoRecommendation(rec Recommendation) []byte {
+	var b []byte
+	b = appendProtoString(b, 1, rec.RuleID)
+	b = appendProtoString(b, 2, rec.Artist)
+	b = appendProtoString(b, 3, rec.Title)
+	b = appendProtoString(b, 4, rec.LyricQuote)
+	b = appendProtoString(b, 5, rec.VideoLink)
+	b = appendProtoInt(b, 6, int64(rec.Year))
+	b = appendProtoStringMap(b, 7, rec.Themes)
+	b = appendProtoString(b, 8, rec.SpotifyLink)
+	b = appendProtoString(b, 9, rec.AppleMusicLink)
+	b = appendProtoString(b, 10, rec.YouTubeMusicLink)
+	b = appendProtoInt(b, 11, int64(rec.Score))
+	b = appendProtoInt(b, 12, int64(rec.Rank))
+	for _, theme := range rec.MatchedThemes {
+		b = protowire.AppendTag(b, 13, protowire.BytesType)
+		b = protowire.AppendString(b, theme)
+	}
+	b = appendProtoIntMap(b, 14, rec.ThemeContributions)
+	b = appendProtoInt(b, 15, int64(rec.Popularity))
+	if rec.Rule != nil {
+		b = appendProtoMessage(b, 16, encodeProtoRuleMetadata(*rec.Rule))
+	}
+	b = appendProtoInt(b, 17, int64(rec.Tempo))
+	b = appendProtoInt(b, 18, int64(rec.Confidence))
+	if rec.Breakdown != nil {
+		b = appendProtoMessage(b, 19, encodeProtoBreakdown(*rec.Breakdown))
+	}
+	b = appendProtoInt(b, 20, int64(rec.Intensity))
+	b = appendProtoString(b, 21, rec.MatchTier)
+	return b
+}
+
+// Function to encode one songrecs.v1.ScoreBreakdown
+func encodeProtoBreakdown(breakdown scoring.ScoreBreakdown) []byte {
+	var b []byte
+	b = appendProtoInt(b, 1, int64(breakdown.ThemePoints))
+	b = appendProtoInt(b, 2, int64(breakdown.Penalty))
+	b = appendProtoInt(b, 3, int64(breakdown.Normalization))
+	b = appendProtoInt(b, 4, int64(breakdown.Rules))
+	b = appendProtoInt(b, 5, int64(breakdown.Popularity))
+	b = appendProtoInt(b, 6, int64(breakdown.Recency))
+	b = appendProtoInt(b, 7, int64(breakdown.Collaborative))
+	b = appendProtoInt(b, 8, int64(breakdown.RepeatPenalty))
+	b = appendProtoInt(b, 9, int64(breakdown.Seasonal))
+	b = appendProtoInt(b, 10, int64(breakdown.Total))
+	b = appendProtoBool(b, 11, breakdown.DiversityHeldBack)
+	b = appendProtoString(b, 12, breakdown.Variant)
+	b = appendProtoInt(b, 13, int64(breakdown.RerankShift))
+	b = appendProtoInt(b, 14, int64(breakdown.Ranker))
+	b = appendProtoInt(b, 15, int64(breakdown.Exposure))
+	b = appendProtoInt(b, 16, int64(breakdown.Intensity))
+	b = appendProtoInt(b, 17, int64(breakdown.Affinity))
+	return b
+}
@@ -0,0 +1,241 @@
+package respond
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"April32025/internal/catalog"
+	"April32025/internal/scoring"
+)
+
+// Recommendation is a recommended song with its score and 1-based rank
+type Recommendation struct {
+	catalog.CountryMusicDocument
+	Score              int                     `json:"score"`
+	Confidence         int                     `json:"confidence"`          // score as 0-100 of the request's ideal score, see scoring/scoring.go
+	Breakdown          *scoring.ScoreBreakdown `json:"breakdown,omitempty"` // how the score was built, see scoring/breakdown.go
+	Rank               int                     `json:"rank"`
+	MatchedThemes      []string                `json:"matchedThemes"`       // strongest contribution first
+	ThemeContributions map[string]int          `json:"themeContributions"`  // points each matched theme added
+	Rule               *RuleMetadata           `json:"rule,omitempty"`      // who curated the song's rule, when known
+	Explored           bool                    `json:"explored,omitempty"`  // picked by exploration, see scoring/exploration.go
+	MatchTier          string                  `json:"matchTier,omitempty"` // perfect, good or stretch, see scoring/matchtiers.go
+}
+
+// RuleMetadata describes the curation behind a song's rule, for "curated by"
+// badges. Catalog items carry it as ruleDescription, curator and createdAt.
+type RuleMetadata struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Curator     string `json:"curator,omitempty"`
+	CreatedAt   string `json:"createdAt,omitempty"` // as stored, normally an ISO 8601 date
+}
+
+// Helper function to get a document's rule metadata, nil when it has none
+func ruleMetadataFor(document catalog.CountryMusicDocument) *RuleMetadata {
+	if document.RuleDescription == "" && document.Curator == "" && document.RuleCreatedAt == "" {
+		return nil
+	}
+	return &RuleMetadata{
+		Name:        catalog.RuleNameFor(document.RuleID),
+		Description: document.RuleDescription,
+		Curator:     document.Curator,
+		CreatedAt:   document.RuleCreatedAt,
+	}
+}
+
+func FilterDocumentsByRecommendations(documents []catalog.CountryMusicDocument, userSelections *scoring.UserSelections, page PageRequest, explore scoring.Exploration) ([]Recommendation, string) {
+	fmt.Println("Starting filterDocumentsByRecommendations...")
+
+	// Print the user preferences
+	fmt.Println("Method input: User Preferences:")
+	fmt.Printf("Selected: %v\n", userSelections.Selected)
+	fmt.Printf("Method input: Recommendations: %v\n", userSelections.Recommendations)
+
+	// Get top N recommendations, N reaching to the end of the requested page
+	fmt.Println("Retrieving top recommended RuleIDs...")
+	artists := scoring.SongArtists(documents)
+	scoreRanking := rankByScore(userSelections.Recommendations)
+	reranked := scoring.RerankRanking(scoreRanking, userSelections.Recommendations, artists, scoring.SongYears(documents), userSelections.Config(), page.Offset+page.Limit+1)
+	shifts := scoring.RerankShifts(scoreRanking, reranked)
+	heldBack := scoring.HeldBackByDiversity(reranked, artists, scoring.MaxSongsPerArtist())
+	rankedRuleIDs := getTopNRecommendations(reranked, artists, page.Offset+page.Limit+1)
+	topRuleIDs, nextCursor := PageRuleIDs(rankedRuleIDs, page)
+	exploredRuleID := ""
+	if page.Offset == 0 {
+		topRuleIDs, exploredRuleID = scoring.ExploreRuleIDs(topRuleIDs, documents, userSelections, explore, scoring.ExplorationRate())
+		if exploredRuleID != "" {
+			// The next page starts at the displaced match
+			nextCursor = encodeCursor(len(topRuleIDs) - 1)
+		}
+	}
+	fmt.Printf("Top RuleIDs: %v\n", topRuleIDs)
+
+	// Filter documents based on RuleID
+	fmt.Println("Filtering documents based on top RuleIDs...")
+	filteredDocs := FilterDocuments(documents, topRuleIDs)
+	fmt.Printf("Filtered Documents Count: %d\n", len(filteredDocs))
+
+	// Generate new list with updated themes based on UserSelections
+	fmt.Println("Updating themes in filtered documents based on user selections...")
+	themeUpdatedFilteredDocs := generateThemeUpdatedDocs(filteredDocs, *userSelections)
+	fmt.Printf("Theme-Updated Documents Count: %d\n", len(themeUpdatedFilteredDocs))
+
+	// Attach scores and ranks
+	recommendations := BuildRecommendations(themeUpdatedFilteredDocs, topRuleIDs, page.Offset, userSelections.Recommendations, userSelections.Contributions)
+	ideal := userSelections.IdealScore()
+	best := scoring.BestScore(userSelections.Recommendations)
+	for i := range recommendations {
+		recommendations[i].Confidence = scoring.Confidence(recommendations[i].Score, ideal)
+		recommendations[i].Explored = recommendations[i].RuleID == exploredRuleID
+		recommendations[i].MatchTier = scoring.MatchTier(recommendations[i].Score, recommendations[i].Confidence, best)
+		if recommendations[i].Explored {
+			recommendations[i].MatchTier = scoring.MatchTierStretch
+		}
+		recommendations[i].Breakdown = userSelections.FinalBreakdown(recommendations[i].RuleID, shifts[recommendations[i].RuleID], heldBack[recommendations[i].RuleID])
+	}
+
+	fmt.Println("Final filtered and updated documents:")
+	for _, rec := range recommendations {
+		fmt.Printf("Rank: %d, Score: %d, RuleID: %s, Artist: %s, Title: %s, Themes: %v\n", rec.Rank, rec.Score, rec.RuleID, rec.Artist, rec.Title, rec.Themes)
+	}
+
+	fmt.Println("Completed filterDocumentsByRecommendations.")
+	return recommendations, nextCursor
+}
+
+// Function to get the top N recommendations from a ranking, see rankByScore
+// and scoring/rerank.go. The artist diversity pass in scoring/diversity.go
+// holds back an artist's extra songs first.
+func getTopNRecommendations(ranking []string, artists map[string]string, N int) []string {
+	rankedRuleIDs := scoring.DiversifyRanking(ranking, artists, scoring.MaxSongsPerArtist())
+	if len(rankedRuleIDs) < N {
+		N = len(rankedRuleIDs)
+	}
+	return rankedRuleIDs[:N]
+}
+
+// Helper function to order scored songs by score, highest first, and equal
+// scores by RuleID ascending, so the same catalog and selections always
+// produce the same ranking
+func rankByScore(recommendations map[string]int) []string {
+	var sortedList []struct {
+		Key   string
+		Value int
+	}
+
+	for k, v := range recommendations {
+		sortedList = append(sortedList, struct {
+			Key   string
+			Value int
+		}{k, v})
+	}
+
+	sort.Slice(sortedList, func(i, j int) bool {
+		if sortedList[i].Value != sortedList[j].Value {
+			return sortedList[i].Value > sortedList[j].Value
+		}
+		return sortedList[i].Key < sortedList[j].Key
+	})
+
+	var rankedRuleIDs []string
+	for _, item := range sortedList {
+		rankedRuleIDs = append(rankedRuleIDs, item.Key)
+	}
+	return rankedRuleIDs
+}
+
+// Function to filter documents based on matching RuleID
+func FilterDocuments(documents []catalog.CountryMusicDocument, topRuleIDs []string) []catalog.CountryMusicDocument {
+	var filteredDocuments []catalog.CountryMusicDocument
+	ruleIDMap := make(map[string]bool)
+
+	for _, id := range topRuleIDs {
+		ruleIDMap[id] = true
+	}
+
+	for _, doc := range documents {
+		if ruleIDMap[doc.RuleID] {
+			filteredDocuments = append(filteredDocuments, doc)
+		}
+	}
+
+	return filteredDocuments
+}
+
+// Function to create a new list with updated themes based on UserSelections
+func generateThemeUpdatedDocs(filteredDocs []catalog.CountryMusicDocument, userSelections scoring.UserSelections) []catalog.CountryMusicDocument {
+	var themeUpdatedFilteredDocs []catalog.CountryMusicDocument
+
+	for _, doc := range filteredDocs {
+		updatedThemes := make(map[string]string)
+		for theme, value := range doc.Themes {
+			name, _ := catalog.CanonicalTheme(theme)
+			if userSelections.Selected[name] {
+				updatedThemes[theme] = value
+			} else {
+				updatedThemes[theme] = ""
+			}
+		}
+		updatedDoc := doc
+		updatedDoc.Themes = updatedThemes
+		themeUpdatedFilteredDocs = append(themeUpdatedFilteredDocs, updatedDoc)
+	}
+
+	return themeUpdatedFilteredDocs
+}
+
+// Function to pair documents with their scores, ordered by rank. Ranks are
+// overall positions, so the first song of the second page of three is rank 4.
+func BuildRecommendations(docs []catalog.CountryMusicDocument, rankedRuleIDs []string, rankOffset int, scores map[string]int, contributions map[string]map[string]int) []Recommendation {
+	rankOf := make(map[string]int)
+	for i, id := range rankedRuleIDs {
+		rankOf[id] = rankOffset + i + 1
+	}
+
+	recommendations := make([]Recommendation, 0, len(docs))
+	for _, doc := range docs {
+		matchedThemes, themeContributions := explainMatches(doc, contributions[doc.RuleID])
+		recommendations = append(recommendations, Recommendation{
+			CountryMusicDocument: withStreamingLinks(doc),
+			Score:                scores[doc.RuleID],
+			Rank:                 rankOf[doc.RuleID],
+			MatchedThemes:        matchedThemes,
+			ThemeContributions:   themeContributions,
+			Rule:                 ruleMetadataFor(doc),
+		})
+	}
+
+	sort.Slice(recommendations, func(i, j int) bool {
+		return recommendations[i].Rank < recommendations[j].Rank
+	})
+	return recommendations
+}
+
+// Function to turn a song's rule contributions into the matched themes list,
+// keyed the same way as the document's own Themes map
+func explainMatches(doc catalog.CountryMusicDocument, contributions map[string]int) ([]string, map[string]int) {
+	matchedThemes := []string{}
+	themeContributions := make(map[string]int)
+
+	for ruleTheme, points := range contributions {
+		key := ruleTheme
+		for docTheme := range doc.Themes {
+			if strings.EqualFold(docTheme, ruleTheme) {
+				key = docTheme
+				break
+			}
+		}
+		matchedThemes = append(matchedThemes, key)
+		themeContributions[key] = points
+	}
+
+	sort.Slice(matchedThemes, func(i, j int) bool {
+		if themeContributions[matchedThemes[i]] != themeContributions[matchedThemes[j]] {
+			return themeContributions[matchedThemes[i]] > themeContributions[matchedThemes[j]]
+		}
+		return matchedThemes[i] < matchedThemes[j]
+	})
+	return matchedThemes, themeContributions
+}
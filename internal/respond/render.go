@@ -0,0 +1,121 @@
+package respond
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"April32025/internal/api"
+)
+
+// Output formats selectable with the request's "format" option
+const (
+	formatJSON    = "json"
+	formatCSV     = "csv"
+	formatM3U     = "m3u"
+	formatXSPF    = "xspf"
+	formatRSS     = "rss"
+	formatAtom    = "atom"
+	formatProto   = "proto"
+	formatJSONAPI = "jsonapi"
+)
+
+var FormatOptions = []string{formatJSON, formatCSV, formatM3U, formatXSPF, formatRSS, formatAtom, formatProto, formatJSONAPI}
+
+const protobufContentType = "application/x-protobuf"
+
+func IsValidFormat(format string) bool {
+	if format == "" {
+		return true
+	}
+	for _, option := range FormatOptions {
+		if format == option {
+			return true
+		}
+	}
+	return false
+}
+
+// Function to serialize the response envelope in the requested format
+func RenderResponse(response RecommendationResponse, incoming api.IncomingRequest, inv api.Invocation) (RenderedResponse, error) {
+	switch incoming.Format {
+	case formatCSV:
+		body, err := renderCSV(response.Recommendations)
+		return RenderedResponse{StatusCode: http.StatusOK, ContentType: "text/csv; charset=utf-8", Body: body}, err
+	case formatM3U:
+		return RenderedResponse{StatusCode: http.StatusOK, ContentType: "audio/x-mpegurl", Body: renderM3U(response.Recommendations)}, nil
+	case formatXSPF:
+		body, err := renderXSPF(response.Recommendations)
+		return RenderedResponse{StatusCode: http.StatusOK, ContentType: "application/xspf+xml", Body: body}, err
+	case formatRSS:
+		body, err := renderRSS(response.Recommendations, feedLink(inv), time.Now())
+		return RenderedResponse{StatusCode: http.StatusOK, ContentType: "application/rss+xml; charset=utf-8", Body: body}, err
+	case formatAtom:
+		body, err := renderAtom(response.Recommendations, feedLink(inv), time.Now())
+		return RenderedResponse{StatusCode: http.StatusOK, ContentType: "application/atom+xml; charset=utf-8", Body: body}, err
+	case formatJSONAPI:
+		body, err := renderJSONAPI(response, inv)
+		return RenderedResponse{StatusCode: http.StatusOK, ContentType: jsonAPIContentType, Body: body}, err
+	case formatProto:
+		return RenderedResponse{StatusCode: http.StatusOK, ContentType: protobufContentType, Body: encodeProtoResponse(response)}, nil
+	default:
+		body, err := json.Marshal(response)
+		if err == nil && len(incoming.Fields) > 0 {
+			body, err = projectJSON(body, incoming.Fields)
+		}
+		if err == nil && incoming.Compact {
+			body, err = compactJSON(body)
+		}
+		return RenderedResponse{StatusCode: http.StatusOK, ContentType: "application/json", Body: body}, err
+	}
+}
+
+// Function to write recommendations as CSV, one row per song in page order
+func renderCSV(recs []Recommendation) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	if err := writer.Write([]string{"RuleID", "Artist", "Title", "LyricQuote", "VideoLink", "Score", "Confidence"}); err != nil {
+		return nil, err
+	}
+	for _, rec := range recs {
+		row := []string{rec.RuleID, rec.Artist, rec.Title, rec.LyricQuote, rec.VideoLink, strconv.Itoa(rec.Score), strconv.Itoa(rec.Confidence)}
+		if err := writer.Write(row); err != nil {
+			return nil, err
+		}
+	}
+
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// Helper function to tell binary bodies from text ones
+func IsBinaryContent(contentType string) bool {
+	return contentType == protobufContentType
+}
+
+// Function to adapt a rendered response to a direct Lambda invocation, whose
+// result must be JSON. Text formats are returned as a JSON string and binary
+// ones as a base64 JSON string.
+func DirectInvocationBody(response RenderedResponse) (json.RawMessage, error) {
+	if strings.HasPrefix(response.ContentType, "application/json") || response.ContentType == jsonAPIContentType {
+		return json.RawMessage(response.Body), nil
+	}
+	if IsBinaryContent(response.ContentType) {
+		return json.Marshal(response.Body)
+	}
+	return json.Marshal(string(response.Body))
+}
+
+// RenderedResponse is a serialized result before it is adapted to the way the
+// function was invoked
+type RenderedResponse struct {
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	RetryAfter  int // seconds, sent as a Retry-After header when set
+}
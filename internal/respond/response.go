@@ -0,0 +1,82 @@
+// Package respond turns scored selections into the response a client gets:
+// ranking and pagination, the JSON, JSON:API, feed, playlist and protobuf
+// renderings, and the explanation when nothing matched.
+package respond
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"April32025/internal/config"
+	"April32025/internal/rules"
+	"April32025/internal/scoring"
+)
+
+const gruleModulePath = "github.com/hyperjumptech/grule-rule-engine"
+
+// RecommendationResponse is the envelope returned to clients, carrying enough
+// metadata to correlate a result with its invocation without CloudWatch
+type RecommendationResponse struct {
+	RequestID       string                        `json:"requestId"`
+	EngineVersion   string                        `json:"engineVersion"`
+	Genre           string                        `json:"genre"`
+	RulesVersion    string                        `json:"rulesVersion"`            // changes whenever the rule set does
+	RankerVersion   string                        `json:"rankerVersion,omitempty"` // learned ranker model, see scoring/ranker.go
+	RulesEvaluated  int                           `json:"rulesEvaluated"`
+	CatalogSize     int                           `json:"catalogSize"`
+	Timing          ResponseTiming                `json:"timing"`
+	TotalMatches    int                           `json:"totalMatches"`
+	PageSize        int                           `json:"pageSize"`
+	NextCursor      string                        `json:"nextCursor,omitempty"` // pass back as "cursor" to load more
+	ThemeLabels     map[string]string             `json:"themeLabels"`          // display name for each theme key
+	Recommendations []Recommendation              `json:"recommendations"`
+	Partial         bool                          `json:"partial,omitempty"`         // rule execution stopped early, see partialReason
+	PartialReason   string                        `json:"partialReason,omitempty"`   // "max_cycle_reached" or "deadline_reached"
+	NoMatches       *noMatchExplanation           `json:"noMatches,omitempty"`       // why nothing matched, see scoring/minscore.go
+	Experiment      *scoring.ExperimentAssignment `json:"experiment,omitempty"`      // scoring variant served, see scoring/experiments.go
+	DefaultPlaylist bool                          `json:"defaultPlaylist,omitempty"` // nothing was selected, see handler/defaultplaylist.go
+	Debug           *DebugInfo                    `json:"debug,omitempty"`
+}
+
+// DebugInfo exposes the engine's inner workings for troubleshooting. It is
+// only attached when the deployment opts in, since the rules reveal the catalog.
+type DebugInfo struct {
+	GeneratedRules  string           `json:"generatedRules"`
+	FiredRules      []string         `json:"firedRules"`
+	Recommendations map[string]int   `json:"recommendations"` // every scored song, not just the returned page
+	Trace           *rules.RuleTrace `json:"trace"`
+}
+
+// ResponseTiming breaks the invocation down by stage, in milliseconds
+type ResponseTiming struct {
+	CatalogLoadMs int64 `json:"catalogLoadMs"`
+	RuleBuildMs   int64 `json:"ruleBuildMs"`
+	ExecuteMs     int64 `json:"executeMs"`
+	TotalMs       int64 `json:"totalMs"`
+}
+
+// Function to build the debug section when the deployment allows it
+func BuildDebugInfo(generatedRules string, userSelections *scoring.UserSelections, trace *rules.RuleTrace) *DebugInfo {
+	if config.Env("DEBUG_RESPONSES_ENABLED", "false") != "true" {
+		fmt.Println("Debug output requested but DEBUG_RESPONSES_ENABLED is not set, ignoring")
+		return nil
+	}
+	return &DebugInfo{
+		GeneratedRules:  generatedRules,
+		FiredRules:      append([]string{}, userSelections.FiredRules...),
+		Recommendations: userSelections.Recommendations,
+		Trace:           trace,
+	}
+}
+
+// Helper function to report the Grule version compiled into the binary
+func EngineVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == gruleModulePath {
+				return "grule-rule-engine " + dep.Version
+			}
+		}
+	}
+	return "grule-rule-engine (unknown)"
+}
@@ -0,0 +1,133 @@
+package respond
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"April32025/internal/api"
+)
+
+// The response shaping options below work on the generic JSON tree of a
+// serialized response, so they apply to every field without per-type code.
+
+// Helper function to decode JSON into a generic tree, keeping numbers exact
+func decodeJSONTree(body []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var tree interface{}
+	err := decoder.Decode(&tree)
+	return tree, err
+}
+
+// Function to drop nulls, empty strings and the objects left empty by that,
+// e.g. the blanked-out entries generateThemeUpdatedDocs leaves in Themes.
+// Zeros, false and empty lists are kept since they carry meaning.
+func compactJSONTree(node interface{}) (interface{}, bool) {
+	switch value := node.(type) {
+	case nil:
+		return nil, false
+	case string:
+		return value, value != ""
+	case map[string]interface{}:
+		for key, child := range value {
+			if compacted, keep := compactJSONTree(child); keep {
+				value[key] = compacted
+			} else {
+				delete(value, key)
+			}
+		}
+		return value, len(value) > 0
+	case []interface{}:
+		kept := make([]interface{}, 0, len(value))
+		for _, child := range value {
+			if compacted, keep := compactJSONTree(child); keep {
+				kept = append(kept, compacted)
+			}
+		}
+		return kept, true
+	default:
+		return value, true
+	}
+}
+
+// Function to compact a serialized JSON response
+func compactJSON(body []byte) ([]byte, error) {
+	tree, err := decodeJSONTree(body)
+	if err != nil {
+		return nil, err
+	}
+	compacted, _ := compactJSONTree(tree)
+	return json.Marshal(compacted)
+}
+
+// Helper function to list the JSON keys a recommendation can be projected to.
+// They come from the struct's json tags rather than a marshalled zero value,
+// which would leave out every omitempty field.
+func recommendationFieldNames() map[string]bool {
+	names := make(map[string]bool)
+	addJSONFieldNames(reflect.TypeOf(Recommendation{}), names)
+	return names
+}
+
+// Helper function to add the JSON keys of a struct's fields, including those
+// promoted from embedded structs, as encoding/json names them
+func addJSONFieldNames(t reflect.Type, names map[string]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			addJSONFieldNames(field.Type, names)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names[name] = true
+	}
+}
+
+// Function to validate a sparse fieldset request
+func ValidateFields(fields []string) error {
+	known := recommendationFieldNames()
+	for _, field := range fields {
+		if !known[field] {
+			return api.BadRequest("unknown_field", "unknown field '%s' in fields", field)
+		}
+	}
+	return nil
+}
+
+// Function to keep only the requested fields on each serialized recommendation
+func projectJSON(body []byte, fields []string) ([]byte, error) {
+	tree, err := decodeJSONTree(body)
+	if err != nil {
+		return nil, err
+	}
+	wanted := make(map[string]bool)
+	for _, field := range fields {
+		wanted[field] = true
+	}
+
+	if envelope, ok := tree.(map[string]interface{}); ok {
+		if recs, ok := envelope["recommendations"].([]interface{}); ok {
+			for _, rec := range recs {
+				if fieldsOf, ok := rec.(map[string]interface{}); ok {
+					for key := range fieldsOf {
+						if !wanted[key] {
+							delete(fieldsOf, key)
+						}
+					}
+				}
+			}
+		}
+	}
+	return json.Marshal(tree)
+}
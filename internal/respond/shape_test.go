@@ -0,0 +1,17 @@
+package respond
+
+import "testing"
+
+// Every key a recommendation can carry is a valid field, including the
+// omitempty ones a zero value doesn't serialize
+func TestValidateFieldsAcceptsEveryRecommendationKey(t *testing.T) {
+	fields := []string{"RuleID", "Artist", "Title", "score", "rank", "breakdown", "matchTier", "explored", "rule"}
+	if err := ValidateFields(fields); err != nil {
+		t.Errorf("ValidateFields(%v): %v", fields, err)
+	}
+	for _, field := range []string{"nope", "ThemeWeights", "Tier"} {
+		if err := ValidateFields([]string{field}); err == nil {
+			t.Errorf("ValidateFields accepted unknown field %s", field)
+		}
+	}
+}
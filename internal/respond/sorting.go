@@ -0,0 +1,62 @@
+package respond
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Sort orders a client can ask for. They only change the order of the page
+// being returned, never which songs make the cut or their rank.
+const (
+	sortByScore  = "score"
+	sortByArtist = "artist"
+	sortByTitle  = "title"
+	sortByYear   = "year"
+	sortByRandom = "random"
+)
+
+var SortOptions = []string{sortByScore, sortByArtist, sortByTitle, sortByYear, sortByRandom}
+
+func IsValidSortBy(sortBy string) bool {
+	if sortBy == "" {
+		return true
+	}
+	for _, option := range SortOptions {
+		if sortBy == option {
+			return true
+		}
+	}
+	return false
+}
+
+// Function to reorder recommendations for display. recs arrive in rank order
+// and every sort is stable, so ties always fall back to server ranking.
+func SortRecommendations(recs []Recommendation, sortBy string, seed int64) {
+	switch sortBy {
+	case "", sortByScore:
+		// Already in rank order
+	case sortByArtist:
+		sort.SliceStable(recs, func(i, j int) bool {
+			return strings.ToLower(recs[i].Artist) < strings.ToLower(recs[j].Artist)
+		})
+	case sortByTitle:
+		sort.SliceStable(recs, func(i, j int) bool {
+			return strings.ToLower(recs[i].Title) < strings.ToLower(recs[j].Title)
+		})
+	case sortByYear:
+		// Newest first; songs without a year go last
+		sort.SliceStable(recs, func(i, j int) bool {
+			return recs[i].Year > recs[j].Year
+		})
+	case sortByRandom:
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		rng := rand.New(rand.NewSource(seed))
+		rng.Shuffle(len(recs), func(i, j int) {
+			recs[i], recs[j] = recs[j], recs[i]
+		})
+	}
+}
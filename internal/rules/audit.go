@@ -0,0 +1,76 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+
+	"April32025/internal/api"
+	"April32025/internal/config"
+)
+
+// When RULES_AUDIT_BUCKET is set, every distinct rule set an invocation runs
+// is written to s3://RULES_AUDIT_BUCKET/RULES_AUDIT_PREFIX<genre>/<sha256>.grl
+// so a recommendation can be traced back to the exact GRL that produced it.
+// Objects are content-addressed and written at most once; the first writer's
+// timestamp and request ID are kept as object metadata.
+var auditedRules = struct {
+	sync.Mutex
+	keys map[string]bool // keys this container already knows exist
+}{
+	keys: make(map[string]bool),
+}
+
+// Helper function to build the audit object key for a rule set
+func ruleAuditKey(c config.Catalog, rulesHash string) string {
+	return config.Env("RULES_AUDIT_PREFIX", "") + c.Genre + "/" + rulesHash + ".grl"
+}
+
+// Function to store the rule set for auditing. Failures are logged and never
+// fail the request.
+func AuditRules(ctx context.Context, cfg aws.Config, c config.Catalog, rules string) {
+	bucket := config.Env("RULES_AUDIT_BUCKET", "")
+	if bucket == "" {
+		return
+	}
+	key := ruleAuditKey(c, hashRules(rules))
+	location := "s3://" + bucket + "/" + key
+
+	auditedRules.Lock()
+	defer auditedRules.Unlock()
+	if auditedRules.keys[location] {
+		fmt.Printf("Rules for request %s: %s\n", api.RequestID(ctx), location)
+		return
+	}
+
+	_, err := config.NewS3Client(cfg).PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        strings.NewReader(rules),
+		ContentType: aws.String("text/plain; charset=utf-8"),
+		IfNoneMatch: aws.String("*"),
+		Metadata: map[string]string{
+			"generated-at": time.Now().UTC().Format(time.RFC3339),
+			"request-id":   api.RequestID(ctx),
+			"genre":        c.Genre,
+		},
+	})
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "PreconditionFailed" {
+		err = nil // another invocation stored the same rules first
+	}
+	if err != nil {
+		fmt.Println("Failed to store rules for auditing:", err)
+		return
+	}
+	auditedRules.keys[location] = true
+	fmt.Printf("Rules for request %s: %s\n", api.RequestID(ctx), location)
+}
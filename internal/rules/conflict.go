@@ -0,0 +1,85 @@
+package rules
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+
+	"April32025/internal/catalog"
+	"April32025/internal/config"
+)
+
+// Grule fires the highest-salience rule among those that match, but picks
+// arbitrarily between rules of equal salience. CONFLICT_RESOLUTION decides
+// how songs with the same popularity are ordered instead:
+//
+//	popularity (default) - by RuleID, so only popularity decides
+//	insertion            - in the order songs were added, by createdAt, then
+//	                       RuleID; songs without a createdAt come last
+//	random               - shuffled with CONFLICT_RESOLUTION_SEED, starting
+//	                       from RuleID order so a seed always gives the same order
+//
+// The order is folded into each rule's salience, so no two song rules tie.
+// It only matters when execution stops early or hand-authored rules depend on
+// firing order; scores of a complete run are the same either way.
+const (
+	conflictPopularity = "popularity"
+	conflictInsertion  = "insertion"
+	conflictRandom     = "random"
+)
+
+// Helper function to order document indexes by RuleID
+func sortByRuleID(documents []catalog.CountryMusicDocument, order []int) {
+	sort.SliceStable(order, func(i, j int) bool {
+		return documents[order[i]].RuleID < documents[order[j]].RuleID
+	})
+}
+
+// Helper function to order document indexes by when the songs were added.
+// Scan order changes between loads, so it can't stand in for insertion order
+// without making the GRL, and the rules hash, differ for the same catalog.
+func sortByCreatedAt(documents []catalog.CountryMusicDocument, order []int) {
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := documents[order[i]], documents[order[j]]
+		if (a.RuleCreatedAt == "") != (b.RuleCreatedAt == "") {
+			return b.RuleCreatedAt == ""
+		}
+		if a.RuleCreatedAt != b.RuleCreatedAt {
+			return a.RuleCreatedAt < b.RuleCreatedAt
+		}
+		return a.RuleID < b.RuleID
+	})
+}
+
+// Function to work out every document's salience under the configured strategy
+func ruleSaliences(documents []catalog.CountryMusicDocument) map[string]int {
+	order := make([]int, len(documents))
+	for i := range order {
+		order[i] = i
+	}
+
+	switch strategy := config.Env("CONFLICT_RESOLUTION", conflictPopularity); strategy {
+	case conflictInsertion:
+		sortByCreatedAt(documents, order)
+	case conflictRandom:
+		sortByRuleID(documents, order)
+		seed, _ := strconv.ParseInt(config.Env("CONFLICT_RESOLUTION_SEED", "0"), 10, 64)
+		rand.New(rand.NewSource(seed)).Shuffle(len(order), func(i, j int) {
+			order[i], order[j] = order[j], order[i]
+		})
+	default:
+		if strategy != conflictPopularity {
+			fmt.Println("Unknown CONFLICT_RESOLUTION, using popularity: " + strategy)
+		}
+		sortByRuleID(documents, order)
+	}
+
+	// Earlier in the order means a higher tie-break, below the next popularity step
+	saliences := make(map[string]int, len(documents))
+	for position, index := range order {
+		document := documents[index]
+		saliences[document.RuleID] = ruleSalience(document.Popularity)*len(documents) + len(documents) - 1 - position
+	}
+	return saliences
+}
@@ -0,0 +1,223 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/hyperjumptech/grule-rule-engine/ast"
+	"github.com/hyperjumptech/grule-rule-engine/builder"
+	"github.com/hyperjumptech/grule-rule-engine/pkg"
+
+	"April32025/internal/api"
+	"April32025/internal/catalog"
+	"April32025/internal/scoring"
+)
+
+// Hard constraints (decades, required themes, excluded artists, explicit
+// content) are applied
+// by an eligibility knowledge base that runs before the scoring one, rather
+// than as scoring penalties. The songs' own gates, their tier and their
+// required and excluded theme combinations, are checked there too, so every
+// scorer and stage that reads Ineligible honors them, not just the generated
+// rules. Its rules come from templates/eligibility.grl.tmpl
+// and don't depend on the catalog, so the library is built once per
+// container. Excluded songs are skipped by IsSongThemeMatch, so their scoring
+// rules never fire, and dropped from the results whatever hand-authored rules
+// did to their scores.
+const eligibilityKnowledgeBaseName = "SongEligibility"
+
+const (
+	minDecade = 1900
+	maxDecade = 2100
+)
+
+// Eligibility is the "Eligibility" fact: the listener's hard filters and a
+// cursor over the catalog
+type Eligibility struct {
+	Position int64
+	Size     int64
+
+	decades         map[int]bool
+	excludedArtists map[string]bool // lowercase
+	excludeExplicit bool
+	requiredThemes  []string                // theme names
+	selections      *scoring.UserSelections // the listener's themes and tier, for the songs' own gates
+	songs           []catalog.CountryMusicDocument
+	excluded        map[string]string // songId -> filter that excluded it
+}
+
+var eligibilityLibrary = struct {
+	sync.Once
+	library *ast.KnowledgeLibrary
+	version string
+	err     error
+}{}
+
+// Function to check the request's filters before any rules run
+func ValidateEligibilityFilters(incoming api.IncomingRequest) error {
+	for _, decade := range incoming.Decades {
+		if decade%10 != 0 || decade < minDecade || decade > maxDecade {
+			return api.BadRequest("invalid_decade", "decades must be years ending in 0 between %d and %d, e.g. 1990", minDecade, maxDecade)
+		}
+	}
+	for _, theme := range incoming.RequiredThemes {
+		if _, ok := catalog.ThemeFieldNames[theme]; !ok {
+			return api.BadRequest("unknown_theme", "requiredThemes has unknown theme '%s'", theme)
+		}
+	}
+	return nil
+}
+
+// Helper function to report whether a request sets any hard filter or the
+// catalog gates any song
+func hasEligibilityFilters(incoming api.IncomingRequest, documents []catalog.CountryMusicDocument) bool {
+	if len(incoming.Decades) > 0 || len(incoming.RequiredThemes) > 0 || len(incoming.ExcludedArtists) > 0 || incoming.ExcludeExplicit {
+		return true
+	}
+	for _, document := range documents {
+		if document.Tier != "" || len(document.RequiredThemes) > 0 || len(document.ExcludedThemes) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func newEligibility(incoming api.IncomingRequest, documents []catalog.CountryMusicDocument, userSelections *scoring.UserSelections) *Eligibility {
+	eligibility := &Eligibility{
+		Size:            int64(len(documents)),
+		decades:         make(map[int]bool),
+		excludedArtists: make(map[string]bool),
+		excludeExplicit: incoming.ExcludeExplicit,
+		selections:      userSelections,
+		songs:           documents,
+		excluded:        make(map[string]string),
+	}
+	for _, decade := range incoming.Decades {
+		eligibility.decades[decade] = true
+	}
+	for _, artist := range incoming.ExcludedArtists {
+		eligibility.excludedArtists[strings.ToLower(strings.TrimSpace(artist))] = true
+	}
+	for _, theme := range incoming.RequiredThemes {
+		eligibility.requiredThemes = append(eligibility.requiredThemes, catalog.ThemeFieldNames[theme])
+	}
+	return eligibility
+}
+
+// Function to check that the song at a cursor position is from a requested
+// decade, always true when no decades were requested
+func (e *Eligibility) InDecades(position int64) bool {
+	year := e.songs[position].Year
+	return len(e.decades) == 0 || e.decades[year-year%10]
+}
+
+// Function to check whether the song at a cursor position lacks a theme the
+// listener required
+func (e *Eligibility) MissesRequiredTheme(position int64) bool {
+	if len(e.requiredThemes) == 0 {
+		return false
+	}
+	has := make(map[string]bool)
+	for key, desc := range e.songs[position].Themes {
+		if name, known := catalog.CanonicalTheme(key); known && desc != "" {
+			has[name] = true
+		}
+	}
+	for _, name := range e.requiredThemes {
+		if !has[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// Function to check whether the song at a cursor position is by an excluded artist
+func (e *Eligibility) ByExcludedArtist(position int64) bool {
+	return e.excludedArtists[strings.ToLower(e.songs[position].Artist)]
+}
+
+// Function to check whether the song at a cursor position is explicit and
+// the listener asked not to get explicit songs
+func (e *Eligibility) ExplicitExcluded(position int64) bool {
+	return e.excludeExplicit && e.songs[position].Explicit
+}
+
+// Function to check whether the song at a cursor position is marked with a
+// tier the listener's plan doesn't include
+func (e *Eligibility) OutsideTier(position int64) bool {
+	tier := e.songs[position].Tier
+	return tier != "" && !e.selections.HasTier(tier)
+}
+
+// Function to check whether the song at a cursor position fails its own
+// theme combination: a required theme the listener didn't select or an
+// excluded one they did
+func (e *Eligibility) FailsThemeCombination(position int64) bool {
+	song := e.songs[position]
+	for _, theme := range song.RequiredThemes {
+		if !e.selections.IsSelected(theme) {
+			return true
+		}
+	}
+	for _, theme := range song.ExcludedThemes {
+		if e.selections.IsSelected(theme) {
+			return true
+		}
+	}
+	return false
+}
+
+// Function to mark the song at a cursor position as ineligible
+func (e *Eligibility) Exclude(position int64, reason string) {
+	e.excluded[e.songs[position].RuleID] = reason
+}
+
+// Helper function to build the eligibility library on first use
+func eligibilityKnowledgeBase() (*ast.KnowledgeBase, error) {
+	eligibilityLibrary.Do(func() {
+		var out strings.Builder
+		if err := grlTemplates.ExecuteTemplate(&out, "eligibility.grl.tmpl", nil); err != nil {
+			eligibilityLibrary.err = err
+			return
+		}
+		rules := strings.TrimSpace(out.String())
+		eligibilityLibrary.version = ruleSetVersion(rules)
+		eligibilityLibrary.library = ast.NewKnowledgeLibrary()
+		ruleBuilder := builder.NewRuleBuilder(eligibilityLibrary.library)
+		eligibilityLibrary.err = ruleBuilder.BuildRuleFromResource(eligibilityKnowledgeBaseName, eligibilityLibrary.version, pkg.NewBytesResource([]byte(rules)))
+	})
+	if eligibilityLibrary.err != nil {
+		return nil, fmt.Errorf("failed to build eligibility rules: %w", eligibilityLibrary.err)
+	}
+	return eligibilityLibrary.library.NewKnowledgeBaseInstance(eligibilityKnowledgeBaseName, eligibilityLibrary.version)
+}
+
+// Function to run the eligibility knowledge base and record the songs it
+// excludes on userSelections, before the scoring knowledge base runs
+func ApplyEligibility(ctx context.Context, incoming api.IncomingRequest, documents []catalog.CountryMusicDocument, userSelections *scoring.UserSelections) error {
+	if !hasEligibilityFilters(incoming, documents) {
+		return nil
+	}
+	knowledgeBase, err := eligibilityKnowledgeBase()
+	if err != nil {
+		return err
+	}
+	eligibility := newEligibility(incoming, documents, userSelections)
+	dataCtx := ast.NewDataContext()
+	if err := dataCtx.Add("Eligibility", eligibility); err != nil {
+		return err
+	}
+	// One cycle per song, plus the final check that finds the cursor at the end
+	result, err := executeRules(ctx, dataCtx, knowledgeBase, uint64(eligibility.Size)+1)
+	if err != nil {
+		return err
+	}
+	if result.PartialReason != "" {
+		return fmt.Errorf("eligibility rules stopped early: %s", result.PartialReason)
+	}
+	userSelections.Ineligible = eligibility.excluded
+	fmt.Printf("Eligibility excluded %d of %d songs\n", len(eligibility.excluded), len(documents))
+	return nil
+}
@@ -0,0 +1,95 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperjumptech/grule-rule-engine/ast"
+	"github.com/hyperjumptech/grule-rule-engine/engine"
+
+	"April32025/internal/config"
+)
+
+// Every song rule retracts itself, so a run takes roughly one cycle per
+// matching song. GRULE_MAX_CYCLE raises Grule's default of 5000 for large
+// catalogs, and a request may set its own "maxCycle" up to maxCycleLimit.
+const (
+	MaxCycleLimit = 100000
+
+	partialMaxCycle = "max_cycle_reached"
+	partialDeadline = "deadline_reached"
+)
+
+// Rule execution stops this long before the Lambda deadline, leaving time to
+// rank, render and return what was scored. ENGINE_DEADLINE_BUFFER_MS overrides it.
+const defaultEngineDeadlineBufferMs = 1000
+
+// Grule reports the cycle limit as a plain error; this is the start of its message
+const cycleLimitMessage = "the GruleEngine successfully selected rule candidate for execution after"
+
+// Function to pick the cycle limit for a request
+func EngineMaxCycle(requested int) uint64 {
+	if requested > 0 {
+		return uint64(requested)
+	}
+	maxCycle, err := strconv.ParseUint(config.Env("GRULE_MAX_CYCLE", ""), 10, 64)
+	if err != nil || maxCycle == 0 {
+		return engine.DefaultCycleCount
+	}
+	return maxCycle
+}
+
+// Helper function to recognize Grule's cycle limit error
+func isCycleLimitError(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), cycleLimitMessage)
+}
+
+// ExecutionResult describes how a rule run ended
+type ExecutionResult struct {
+	PartialReason string // "" when every rule that could fire did
+	Trace         *RuleTrace
+}
+
+// Helper function to bound rule execution by the invocation's deadline
+func engineContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+	bufferMs, err := strconv.Atoi(config.Env("ENGINE_DEADLINE_BUFFER_MS", strconv.Itoa(defaultEngineDeadlineBufferMs)))
+	if err != nil || bufferMs < 0 {
+		bufferMs = defaultEngineDeadlineBufferMs
+	}
+	return context.WithDeadline(ctx, deadline.Add(-time.Duration(bufferMs)*time.Millisecond))
+}
+
+// Function to run the rules against the data context. Hitting the cycle
+// limit or the execution deadline is not fatal: the songs scored so far are
+// still valid, so the run is reported as partial instead of failing the request.
+func executeRules(ctx context.Context, dataCtx ast.IDataContext, knowledgeBase *ast.KnowledgeBase, maxCycle uint64) (ExecutionResult, error) {
+	result := ExecutionResult{Trace: NewRuleTrace()}
+	gruleEngine := engine.NewGruleEngine()
+	gruleEngine.MaxCycle = maxCycle
+	gruleEngine.Listeners = []engine.GruleEngineListener{result.Trace}
+
+	engineCtx, cancel := engineContext(ctx)
+	defer cancel()
+	err := gruleEngine.ExecuteWithContext(engineCtx, dataCtx, knowledgeBase)
+	result.Trace.finish()
+	result.Trace.log()
+	switch {
+	case isCycleLimitError(err):
+		fmt.Printf("Rule execution stopped after %d cycles, returning partial results\n", maxCycle)
+		result.PartialReason = partialMaxCycle
+		return result, nil
+	case errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil:
+		fmt.Printf("Rule execution stopped after %d cycles at the deadline, returning partial results\n", result.Trace.Cycles)
+		result.PartialReason = partialDeadline
+		return result, nil
+	}
+	return result, err
+}
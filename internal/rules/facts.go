@@ -0,0 +1,92 @@
+package rules
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"April32025/internal/catalog"
+	"April32025/internal/scoring"
+)
+
+// factsRuleSource scores the catalog with the fixed rules in
+// templates/catalog_facts.grl.tmpl instead of one rule per song, so the GRL
+// stays the same size however large the catalog grows and only has to be
+// rebuilt when a hand-edited ruleJSON changes. Songs with a ruleJSON keep
+// their own rules; every other song is matched by the Catalog fact.
+type factsRuleSource struct{}
+
+func (factsRuleSource) Name() string {
+	return ruleSourceFacts
+}
+
+func (factsRuleSource) LoadRules(ctx context.Context, documents []catalog.CountryMusicDocument) (string, error) {
+	var out strings.Builder
+	if err := grlTemplates.ExecuteTemplate(&out, "catalog_facts.grl.tmpl", nil); err != nil {
+		return "", err
+	}
+	rules := []string{strings.TrimSpace(out.String())}
+	for _, document := range catalog.SortedByRuleID(documents) {
+		if document.RuleJSON == "" {
+			continue
+		}
+		rule, err := documentRule(document, 0)
+		if err != nil {
+			return "", err
+		}
+		rules = append(rules, rule)
+	}
+	return strings.Join(rules, "\n\n"), nil
+}
+
+// Helper function to order the songs the catalog cursor walks, highest
+// salience first like the generated rules would fire
+func cursorSongs(documents []catalog.CountryMusicDocument) []catalog.CountryMusicDocument {
+	saliences := ruleSaliences(documents)
+	var songs []catalog.CountryMusicDocument
+	for _, document := range documents {
+		if document.RuleJSON == "" {
+			songs = append(songs, document)
+		}
+	}
+	sort.SliceStable(songs, func(i, j int) bool {
+		return saliences[songs[i].RuleID] > saliences[songs[j].RuleID]
+	})
+	return songs
+}
+
+// Function to check the song at a cursor position the way its generated
+// rule's when-scope would
+func (c *Catalog) SongMatches(position int64, p *scoring.UserSelections) bool {
+	song := c.cursor[position]
+	if !p.IsSongThemeMatch(song.RuleID, documentThemeFields(song)...) {
+		return false
+	}
+	for _, theme := range song.RequiredThemes {
+		if !p.IsSelected(theme) {
+			return false
+		}
+	}
+	for _, theme := range song.ExcludedThemes {
+		if p.IsSelected(theme) {
+			return false
+		}
+	}
+	return song.Tier == "" || p.HasTier(song.Tier)
+}
+
+// Function to score the song at a cursor position, as its generated rule's
+// then-scope would
+func (c *Catalog) ScoreSong(position int64, p *scoring.UserSelections) {
+	song := c.cursor[position]
+	p.SetRecommendations(song.RuleID, documentThemeFields(song)...)
+}
+
+// Helper function to size the cycle budget: the facts rules spend one cycle
+// per song on top of what the rest of the rule set needs
+func CycleBudget(ruleSource RuleSource, catalogFact *Catalog, maxCycle uint64) uint64 {
+	if ruleSource.Name() == ruleSourceFacts {
+		return maxCycle + uint64(catalogFact.Size)
+	}
+	return maxCycle
+}
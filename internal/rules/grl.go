@@ -0,0 +1,199 @@
+// Package rules generates a catalog's GRL, builds and caches its knowledge
+// bases and runs them against a request's selections, with the hard filters,
+// rule sources, overrides, audit and validation around them.
+package rules
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/hyperjumptech/grule-rule-engine/pkg"
+
+	"April32025/internal/catalog"
+	"April32025/internal/config"
+)
+
+//go:embed templates/*.grl.tmpl
+var grlTemplateFiles embed.FS
+
+var grlTemplates = template.Must(template.New("grl").Funcs(template.FuncMap{
+	"grlString": grlString,
+	"ruleName":  catalog.RuleNameFor,
+}).ParseFS(grlTemplateFiles, "templates/*.grl.tmpl"))
+
+// generatedRulesVersion is part of the shared cache key for generated rules.
+// Bump it when a change to the generator outside the templates changes the
+// GRL, so instances running the new code don't read the old rules.
+const generatedRulesVersion = "1"
+
+// Function to hash the embedded templates, so editing one retires the
+// generated rules cached under the old ones
+func grlTemplatesDigest() []byte {
+	hash := sha256.New()
+	names, _ := fs.Glob(grlTemplateFiles, "templates/*.grl.tmpl")
+	for _, name := range names {
+		body, _ := grlTemplateFiles.ReadFile(name)
+		fmt.Fprintf(hash, "%s|%d|", name, len(body))
+		hash.Write(body)
+	}
+	return hash.Sum(nil)
+}
+
+// songRuleData is what templates/song_rule.grl.tmpl renders from
+type songRuleData struct {
+	RuleID   string
+	Title    string // rule description: the curator's, or the song title
+	Salience int
+	Themes   []string // capitalized catalog theme keys, resolved case-insensitively
+
+	RequiredThemes []string // all must be selected for the rule to fire
+	ExcludedThemes []string // none may be selected
+	Tier           string   // plan required to get the song, "" for everyone
+}
+
+// Popularity steps for song rules: popular songs are scheduled first when
+// several rules match in the same cycle. ruleSaliences in conflict.go scales
+// these to break ties between songs of equal popularity.
+const (
+	baseSalience  = 10
+	maxPopularity = 100
+)
+
+// Helper function to turn a song's popularity into its rule salience
+func ruleSalience(popularity int) int {
+	if popularity < 0 {
+		popularity = 0
+	}
+	if popularity > maxPopularity {
+		popularity = maxPopularity
+	}
+	return baseSalience + popularity
+}
+
+// Helper function to write a value as a GRL string literal. Grule unquotes
+// literals with Go's escape rules, so strconv.Quote round-trips any title,
+// including quotes, backslashes and braces.
+func grlString(value string) string {
+	return strconv.Quote(value)
+}
+
+// RULE_TEMPLATE picks how a song rule keeps itself from firing again:
+//
+//	retract (default) - the rule retracts itself once it has scored the song
+//	guarded           - the rule checks UserSelections.Scored, so it stays in
+//	                    the knowledge base for inspection after firing
+const (
+	ruleTemplateRetract = "retract"
+	ruleTemplateGuarded = "guarded"
+)
+
+func songRuleTemplate() string {
+	switch template := config.Env("RULE_TEMPLATE", ruleTemplateRetract); template {
+	case ruleTemplateGuarded:
+		return "song_rule_guarded.grl.tmpl"
+	default:
+		if template != ruleTemplateRetract {
+			fmt.Println("Unknown RULE_TEMPLATE, using retract: " + template)
+		}
+		return "song_rule.grl.tmpl"
+	}
+}
+
+// Function to render the scoring rule for one song
+func renderSongRule(data songRuleData) (string, error) {
+	var out strings.Builder
+	if err := grlTemplates.ExecuteTemplate(&out, songRuleTemplate(), data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// Function to generate the rule set for a catalog. Scan order and Go map
+// order are both unspecified, so documents are rendered in RuleID order and
+// themes in name order, keeping the GRL byte-for-byte stable and diffable
+// for an unchanged catalog.
+func extractGrules(documents []catalog.CountryMusicDocument) (string, error) {
+	var rules []string
+
+	saliences := ruleSaliences(documents)
+	documents = catalog.SortedByRuleID(documents)
+	for _, document := range documents {
+		rule, err := documentRule(document, saliences[document.RuleID])
+		if err != nil {
+			return "", err
+		}
+		rules = append(rules, rule)
+	}
+	if issues := lintDocumentRules(documents, rules); len(issues) > 0 {
+		return "", lintError(issues)
+	}
+
+	songRule := strings.Join(rules, "\n\n") // Combine all rules into one string
+	return songRule, nil
+}
+
+// Function to produce the GRL for a single document: its hand-edited
+// ruleJSON when present, the song rule template otherwise
+func documentRule(document catalog.CountryMusicDocument, salience int) (string, error) {
+	if document.RuleJSON != "" {
+		rule, err := parseJSONRules([]byte(document.RuleJSON))
+		if err != nil {
+			return "", fmt.Errorf("invalid ruleJSON on document %s: %w", document.RuleID, err)
+		}
+		return rule, nil
+	}
+
+	description := document.Title
+	if document.RuleDescription != "" {
+		description = document.RuleDescription
+	}
+	rule, err := renderSongRule(songRuleData{
+		RuleID:   document.RuleID,
+		Title:    description,
+		Salience: salience,
+		Themes:   documentThemeFields(document),
+
+		RequiredThemes: catalog.SortedStrings(document.RequiredThemes),
+		ExcludedThemes: catalog.SortedStrings(document.ExcludedThemes),
+		Tier:           document.Tier,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to render rule for document %s: %w", document.RuleID, err)
+	}
+	return rule, nil
+}
+
+// Helper function to list the theme names a document's rule should check
+func documentThemeFields(document catalog.CountryMusicDocument) []string {
+	themes := []string{}
+	for theme, desc := range document.Themes {
+		if desc != "" {
+			themes = append(themes, capitalizeFirstLetter(theme))
+		}
+	}
+	sort.Strings(themes)
+	return themes
+}
+
+// Helper function to convert Grule's JSON rule format into GRL. Accepts a
+// single rule object or an array of them.
+func parseJSONRules(data []byte) (string, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		return pkg.ParseJSONRuleset(trimmed)
+	}
+	return pkg.ParseJSONRule(data)
+}
+
+func capitalizeFirstLetter(s string) string {
+	if len(s) == 0 {
+		return s // Return empty string if input is empty
+	}
+	return strings.ToUpper(s[:1]) + s[1:] // Capitalize first letter and append the rest
+}
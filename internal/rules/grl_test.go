@@ -0,0 +1,62 @@
+package rules
+
+import (
+	"testing"
+
+	"April32025/internal/api"
+	"April32025/internal/catalog"
+	"April32025/internal/scoring"
+	"April32025/rulestest"
+)
+
+// Helper function to load the fixture catalog; tests edit the documents
+// before scoring to add curation the JSON can't carry
+func fixtureDocuments(t *testing.T) []catalog.CountryMusicDocument {
+	t.Helper()
+	var documents []catalog.CountryMusicDocument
+	rulestest.LoadFixture(t, "testdata/catalog.json", &documents)
+	return documents
+}
+
+// Helper function to score a request against the generated rules with the
+// fixed simulation settings, so the test doesn't move with SCORING_* env
+func scoreFixture(t *testing.T, documents []catalog.CountryMusicDocument, incoming api.IncomingRequest) map[string]int {
+	t.Helper()
+	grl, err := extractGrules(documents)
+	if err != nil {
+		t.Fatalf("generating rules: %v", err)
+	}
+	selections := scoring.GetUserSelections(incoming)
+	selections.Scoring = scoring.SimulationConfig()
+	rulestest.Execute(t, rulestest.Build(t, grl), rulestest.Facts{"UserSelections": selections})
+	return selections.Recommendations
+}
+
+func TestGeneratedRulesScoreSelectedThemes(t *testing.T) {
+	scores := scoreFixture(t, fixtureDocuments(t), api.IncomingRequest{
+		Themes:     map[string]bool{"love": true, "heartbreak": true, "goodtimes": true},
+		Importance: map[string]int{"heartbreak": 5},
+	})
+	// Heartbreak at importance 5 lifts the two heartbreak songs over the
+	// dance songs; songs without a selected theme never fire
+	rulestest.AssertScores(t, scores, map[string]int{"song-2": 26, "song-4": 26, "song-5": 20, "song-6": 10})
+	rulestest.AssertRanking(t, scores, "song-2", "song-4", "song-5", "song-6")
+}
+
+func TestGeneratedRulesHonorThemeCombinations(t *testing.T) {
+	documents := fixtureDocuments(t)
+	for i := range documents {
+		switch documents[i].RuleID {
+		case "song-4":
+			documents[i].ExcludedThemes = []string{"goodtimes"}
+		case "song-6":
+			documents[i].RequiredThemes = []string{"home"}
+		}
+	}
+
+	scores := scoreFixture(t, documents, api.IncomingRequest{
+		Themes: map[string]bool{"love": true, "heartbreak": true, "goodtimes": true},
+	})
+	// Jolene is out because goodtimes is selected, Chattahoochee because home isn't
+	rulestest.AssertScores(t, scores, map[string]int{"song-2": 20, "song-5": 20})
+}
@@ -0,0 +1,55 @@
+package rules
+
+import "April32025/internal/catalog"
+
+// Scoring functions for hand-authored rules (RULE_SOURCE=s3 or a document's
+// ruleJSON), beyond the SetRecommendations call generated rules use:
+//
+//	UserSelections.BoostIfAll("song-1", 5, "Love", "HeartBreak");
+//	UserSelections.PenalizeTheme("song-1", "Rebellion", 3);
+//	when Catalog.PopularityOf("song-1") > 80 && ...
+//	when Catalog.YearOf("song-1") >= 1990 && Catalog.TempoOf("song-1") > 120 && ...
+//	when UserSelections.MatchesAll("Love", "Home") && UserSelections.MatchesNone("Rebellion") ...
+//
+// Themes are named as in the generated rules, in any casing.
+// Point values are int64 because that is how Grule passes integer literals.
+// The UserSelections functions live with that fact, in scoring/selections.go.
+
+// Catalog exposes the songs being scored to rules as the "Catalog" fact.
+// Position and Size are the cursor the RULE_SOURCE=facts rules walk.
+type Catalog struct {
+	Position int64
+	Size     int64
+
+	songs  map[string]catalog.CountryMusicDocument
+	cursor []catalog.CountryMusicDocument
+}
+
+func NewCatalogFact(documents []catalog.CountryMusicDocument) *Catalog {
+	songs := make(map[string]catalog.CountryMusicDocument, len(documents))
+	for _, document := range documents {
+		songs[document.RuleID] = document
+	}
+	cursor := cursorSongs(documents)
+	return &Catalog{Size: int64(len(cursor)), songs: songs, cursor: cursor}
+}
+
+// Function to look up a song's popularity, 0 for unknown songs
+func (c *Catalog) PopularityOf(songId string) int {
+	return c.songs[songId].Popularity
+}
+
+// Function to look up a song's release year, 0 for unknown songs
+func (c *Catalog) YearOf(songId string) int {
+	return c.songs[songId].Year
+}
+
+// Function to look up a song's tempo in beats per minute, 0 when unknown
+func (c *Catalog) TempoOf(songId string) int {
+	return c.songs[songId].Tempo
+}
+
+// Function to look up a song's intensity, 1-5, 0 when not rated
+func (c *Catalog) IntensityOf(songId string) int {
+	return c.songs[songId].Intensity
+}
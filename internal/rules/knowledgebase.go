@@ -0,0 +1,111 @@
+package rules
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"github.com/hyperjumptech/grule-rule-engine/ast"
+	"github.com/hyperjumptech/grule-rule-engine/builder"
+	"github.com/hyperjumptech/grule-rule-engine/pkg"
+
+	"April32025/internal/config"
+)
+
+const knowledgeBaseName = "SongRecs"
+
+// Parsing GRL is by far the most expensive part of an invocation, so each
+// built KnowledgeLibrary is kept across warm invocations and only rebuilt
+// when the rule text (and therefore the catalog behind it) changes. Every
+// request still gets its own KnowledgeBase instance, cloned from the
+// library, so retracted rules and working memory never leak between requests.
+//
+// Libraries are registered per genre and catalog shard, each in a library of
+// its own so catalogs can't see each other's rules. A library's version is
+// derived from its rule text, so two invocations reporting the same version
+// ran exactly the same rules, and a cache serving an old rule set is visible
+// in the logs and response envelope.
+type knowledgeBaseKey struct {
+	Genre string
+	Shard int
+}
+
+type knowledgeBaseEntry struct {
+	version string
+	library *ast.KnowledgeLibrary
+}
+
+var knowledgeBaseRegistry = struct {
+	sync.Mutex
+	entries map[knowledgeBaseKey]*knowledgeBaseEntry
+}{
+	entries: make(map[knowledgeBaseKey]*knowledgeBaseEntry),
+}
+
+// Helper function to fingerprint a rule set
+func hashRules(rules string) string {
+	sum := sha256.Sum256([]byte(rules))
+	return hex.EncodeToString(sum[:])
+}
+
+// Helper function to derive the knowledge base version from the rule text
+func ruleSetVersion(rules string) string {
+	return hashRules(rules)[:16]
+}
+
+// Function to drop a catalog's cached libraries so the next request rebuilds them
+func evictKnowledgeBase(c config.Catalog) {
+	knowledgeBaseRegistry.Lock()
+	defer knowledgeBaseRegistry.Unlock()
+	for key := range knowledgeBaseRegistry.entries {
+		if key.Genre == c.Genre {
+			delete(knowledgeBaseRegistry.entries, key)
+		}
+	}
+}
+
+// Function to get a fresh knowledge base instance for one shard of a
+// catalog's rules, reporting whether the library had to be rebuilt. The
+// instance's Version identifies the rule set. Libraries are built outside the
+// registry lock so shards can be built in parallel.
+func getKnowledgeBase(c config.Catalog, shard int, rules string) (*ast.KnowledgeBase, bool, error) {
+	key := knowledgeBaseKey{Genre: c.Genre, Shard: shard}
+	version := ruleSetVersion(rules)
+
+	knowledgeBaseRegistry.Lock()
+	entry, ok := knowledgeBaseRegistry.entries[key]
+	knowledgeBaseRegistry.Unlock()
+
+	rebuilt := false
+	if !ok || entry.version != version {
+		if ok {
+			fmt.Printf("Rules changed for %s shard %d, rebuilding knowledge library: %s -> %s\n", c.Genre, shard, entry.version, version)
+		} else {
+			fmt.Printf("Building %s shard %d knowledge library: %s\n", c.Genre, shard, version)
+		}
+
+		if err := lintRuleSet(rules); err != nil {
+			return nil, false, err
+		}
+		knowledgeLibrary := ast.NewKnowledgeLibrary()
+		ruleBuilder := builder.NewRuleBuilder(knowledgeLibrary)
+
+		bs := pkg.NewBytesResource([]byte(rules))
+		if err := ruleBuilder.BuildRuleFromResource(knowledgeBaseName, version, bs); err != nil {
+			return nil, false, fmt.Errorf("failed to build %s song rules: %w", c.Genre, err)
+		}
+
+		entry = &knowledgeBaseEntry{version: version, library: knowledgeLibrary}
+		knowledgeBaseRegistry.Lock()
+		knowledgeBaseRegistry.entries[key] = entry
+		knowledgeBaseRegistry.Unlock()
+		rebuilt = true
+	}
+
+	knowledgeBase, err := entry.library.NewKnowledgeBaseInstance(knowledgeBaseName, version)
+	if err != nil {
+		return nil, rebuilt, fmt.Errorf("failed to create knowledge base instance: %w", err)
+	}
+	return knowledgeBase, rebuilt, nil
+}
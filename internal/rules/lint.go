@@ -0,0 +1,132 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"April32025/internal/catalog"
+)
+
+// The GRL parser reports problems as a bare error count, which says nothing
+// about which song caused them. A lint pass over the rule text runs first
+// and catches the usual culprits by name: two rules with the same name (two
+// RuleIDs that map to one rule name), a string literal left open by a stray
+// quote, and a rule whose when-scope is empty.
+
+// grlRuleInfo is what the linter learns about one rule
+type grlRuleInfo struct {
+	Name     string
+	Problems []string
+}
+
+// Function to scan GRL for its rules and their problems. Problems outside
+// any rule (an unterminated literal before the first rule, say) are
+// reported under an empty name.
+func lintGRL(grl string) []grlRuleInfo {
+	var rules []grlRuleInfo
+	current := &grlRuleInfo{}
+	report := func(problem string) {
+		current.Problems = append(current.Problems, problem)
+	}
+
+	// Strip string literals, remembering whether each one was closed, so
+	// keyword matching only ever sees code
+	var code strings.Builder
+	for i := 0; i < len(grl); i++ {
+		if grl[i] != '"' {
+			code.WriteByte(grl[i])
+			continue
+		}
+		closed := false
+		for i++; i < len(grl); i++ {
+			if grl[i] == '\\' {
+				i++
+				continue
+			}
+			if grl[i] == '"' {
+				closed = true
+				break
+			}
+			if grl[i] == '\n' {
+				break
+			}
+		}
+		code.WriteString(`""`)
+		if !closed {
+			code.WriteString(" \x00unterminated ")
+		}
+	}
+
+	fields := strings.FieldsFunc(code.String(), func(r rune) bool {
+		return unicode.IsSpace(r) || r == '{' || r == '}' || r == ';'
+	})
+	for i, field := range fields {
+		switch {
+		case field == "rule" && i+1 < len(fields):
+			if current.Name != "" || len(current.Problems) > 0 {
+				rules = append(rules, *current)
+			}
+			current = &grlRuleInfo{Name: fields[i+1]}
+		case field == "\x00unterminated":
+			report("unterminated string literal, likely an unescaped quote")
+		case field == "when" && i+1 < len(fields) && fields[i+1] == "then":
+			report("empty when-scope")
+		}
+	}
+	if current.Name != "" || len(current.Problems) > 0 {
+		rules = append(rules, *current)
+	}
+	return rules
+}
+
+// Function to lint a whole rule set, as loaded from any rule source
+func lintRuleSet(grl string) error {
+	var problems []string
+	seen := make(map[string]bool)
+	for _, rule := range lintGRL(grl) {
+		for _, problem := range rule.Problems {
+			problems = append(problems, fmt.Sprintf("rule %s: %s", rule.Name, problem))
+		}
+		if rule.Name != "" && seen[rule.Name] {
+			problems = append(problems, fmt.Sprintf("rule %s: defined more than once", rule.Name))
+		}
+		seen[rule.Name] = true
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("rule lint failed: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Function to lint each document's rule, naming the documents at fault
+func lintDocumentRules(documents []catalog.CountryMusicDocument, rules []string) []documentRuleError {
+	var issues []documentRuleError
+	owners := make(map[string]string) // rule name -> RuleID that defined it first
+	for i, document := range documents {
+		for _, rule := range lintGRL(rules[i]) {
+			for _, problem := range rule.Problems {
+				issues = append(issues, documentRuleError{RuleID: document.RuleID, Title: document.Title, Error: problem})
+			}
+			if owner, ok := owners[rule.Name]; ok && rule.Name != "" {
+				issues = append(issues, documentRuleError{
+					RuleID: document.RuleID,
+					Title:  document.Title,
+					Error:  fmt.Sprintf("rule name %s is already used by document %s", rule.Name, owner),
+				})
+			} else {
+				owners[rule.Name] = document.RuleID
+			}
+		}
+	}
+	return issues
+}
+
+// Helper function to turn lint issues into one error
+func lintError(issues []documentRuleError) error {
+	problems := make([]string, len(issues))
+	for i, issue := range issues {
+		problems[i] = fmt.Sprintf("document %s: %s", issue.RuleID, issue.Error)
+	}
+	return fmt.Errorf("rule lint failed: %s", strings.Join(problems, "; "))
+}
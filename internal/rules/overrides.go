@@ -0,0 +1,88 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hyperjumptech/grule-rule-engine/ast"
+	"github.com/hyperjumptech/grule-rule-engine/builder"
+	"github.com/hyperjumptech/grule-rule-engine/pkg"
+
+	"April32025/internal/api"
+	"April32025/internal/config"
+	"April32025/internal/scoring"
+)
+
+// Curators can try out rules without touching the catalog by sending GRL in
+// "ruleOverrides", e.g. a temporary boost:
+//
+//	rule BoostOutlaws "Try boosting outlaw country" {
+//	    when UserSelections.IsSelected("Rebellion")
+//	    then UserSelections.BoostIfAll("song-7", 5, "Rebellion"); Retract("BoostOutlaws");
+//	}
+//
+// The snippets are compiled into a knowledge base of their own, never
+// cached, and run after the catalog's rules against the same facts, so they
+// see and adjust the catalog's scores. Overrides are off unless
+// RULE_OVERRIDES_ENABLED=true, and over HTTP the authorizer must grant the
+// curator role.
+const (
+	maxRuleOverrides     = 20
+	maxRuleOverrideBytes = 16 * 1024
+)
+
+// Function to check that the overrides are within the request limits
+func ValidateRuleOverrides(overrides []string) error {
+	if len(overrides) > maxRuleOverrides {
+		return api.BadRequest("too_many_rule_overrides", "at most %d ruleOverrides are allowed", maxRuleOverrides)
+	}
+	size := 0
+	for _, override := range overrides {
+		size += len(override)
+	}
+	if size > maxRuleOverrideBytes {
+		return api.BadRequest("rule_overrides_too_large", "ruleOverrides may total at most %d bytes", maxRuleOverrideBytes)
+	}
+	return nil
+}
+
+// Helper function to decide whether this caller may send rule overrides
+func canOverrideRules(inv api.Invocation) bool {
+	if config.Env("RULE_OVERRIDES_ENABLED", "false") != "true" {
+		return false
+	}
+	return !inv.HTTP || inv.Role == api.RoleCurator
+}
+
+// Function to compile a request's overrides into an overlay knowledge base
+func BuildRuleOverlay(ctx context.Context, overrides []string, inv api.Invocation) (*ast.KnowledgeBase, error) {
+	if !canOverrideRules(inv) {
+		return nil, api.Forbidden("rule_overrides_not_allowed", "ruleOverrides are not enabled for this caller")
+	}
+
+	rules := strings.Join(overrides, "\n\n")
+	if err := lintRuleSet(rules); err != nil {
+		return nil, api.BadRequest("invalid_rule_override", "%v", err)
+	}
+	library := ast.NewKnowledgeLibrary()
+	if err := builder.NewRuleBuilder(library).BuildRuleFromResource("SongRecsOverlay", "request", pkg.NewBytesResource([]byte(rules))); err != nil {
+		return nil, api.BadRequest("invalid_rule_override", "ruleOverrides do not compile: %v", err)
+	}
+	fmt.Printf("Request %s runs %d rule overrides:\n%s\n", api.RequestID(ctx), len(overrides), rules)
+	return library.NewKnowledgeBaseInstance("SongRecsOverlay", "request")
+}
+
+// Function to run the overlay after the catalog's rules, folding its trace
+// and any early stop into the catalog run's result
+func ExecuteRuleOverlay(ctx context.Context, overlay *ast.KnowledgeBase, userSelections *scoring.UserSelections, catalogFact *Catalog, maxCycle uint64, execution *ExecutionResult) error {
+	result, err := executeRules(ctx, NewRuleFacts(userSelections, catalogFact), overlay, maxCycle)
+	if err != nil {
+		return err
+	}
+	execution.Trace.merge(result.Trace)
+	if execution.PartialReason == "" {
+		execution.PartialReason = result.PartialReason
+	}
+	return nil
+}
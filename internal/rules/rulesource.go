@@ -0,0 +1,217 @@
+package rules
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"April32025/internal/catalog"
+	"April32025/internal/config"
+)
+
+// RuleSource supplies the GRL text the knowledge base is built from.
+// RULE_SOURCE selects one:
+//
+//	generated (default) - one rule per catalog document via extractGrules
+//	s3                  - hand-authored rules under RULES_BUCKET/RULES_PREFIX, as
+//	                      .grl files or .json files in Grule's JSON rule format;
+//	                      "{genre}" in RULES_PREFIX is replaced by the catalog's genre
+//	facts               - a fixed handful of rules that walk the catalog as a fact
+type RuleSource interface {
+	Name() string
+	LoadRules(ctx context.Context, documents []catalog.CountryMusicDocument) (string, error)
+}
+
+const (
+	ruleSourceGenerated = "generated"
+	ruleSourceS3        = "s3"
+	ruleSourceFacts     = "facts"
+
+	defaultRulesCacheSeconds = 60
+)
+
+// Function to build the configured rule source
+func NewRuleSource(cfg aws.Config, c config.Catalog) (RuleSource, error) {
+	switch config.Env("RULE_SOURCE", ruleSourceGenerated) {
+	case ruleSourceGenerated:
+		return generatedRuleSource{}, nil
+	case ruleSourceFacts:
+		return factsRuleSource{}, nil
+	case ruleSourceS3:
+		bucket := config.Env("RULES_BUCKET", "")
+		if bucket == "" {
+			return nil, fmt.Errorf("RULES_BUCKET is required when RULE_SOURCE=s3")
+		}
+		return &s3RuleSource{client: config.NewS3Client(cfg), bucket: bucket, prefix: catalog.GenrePath(config.Env("RULES_PREFIX", ""), c.Genre)}, nil
+	default:
+		return nil, fmt.Errorf("unknown RULE_SOURCE '%s'", config.Env("RULE_SOURCE", ""))
+	}
+}
+
+// generatedRuleSource is the original per-document rule template
+type generatedRuleSource struct{}
+
+func (generatedRuleSource) Name() string {
+	return ruleSourceGenerated
+}
+
+func (generatedRuleSource) LoadRules(ctx context.Context, documents []catalog.CountryMusicDocument) (string, error) {
+	return extractGrules(documents)
+}
+
+// s3RuleSource reads every rule file under a prefix. Files are kept in a
+// package-level cache across warm invocations: within RULES_CACHE_SECONDS the
+// cache is used as is, after that the prefix is listed again and only files
+// whose ETag changed are downloaded.
+type s3RuleSource struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+type cachedRuleFile struct {
+	etag string
+	body string
+}
+
+var s3RuleCache = struct {
+	sync.Mutex
+	files     map[string]cachedRuleFile // "bucket/key" -> file
+	checkedAt map[string]time.Time      // "bucket/prefix" -> last listing
+	rules     map[string]string         // "bucket/prefix" -> combined GRL
+}{
+	files:     make(map[string]cachedRuleFile),
+	checkedAt: make(map[string]time.Time),
+	rules:     make(map[string]string),
+}
+
+func (s *s3RuleSource) Name() string {
+	return ruleSourceS3
+}
+
+func (s *s3RuleSource) LoadRules(ctx context.Context, documents []catalog.CountryMusicDocument) (string, error) {
+	s3RuleCache.Lock()
+	defer s3RuleCache.Unlock()
+
+	prefixKey := s.bucket + "/" + s.prefix
+	if checked, ok := s3RuleCache.checkedAt[prefixKey]; ok && time.Since(checked) < rulesCacheTTL() {
+		return s3RuleCache.rules[prefixKey], nil
+	}
+
+	var keys []string
+	etags := make(map[string]string)
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to list rules in s3://%s: %w", prefixKey, err)
+		}
+		for _, object := range page.Contents {
+			key := aws.ToString(object.Key)
+			if strings.HasSuffix(key, ".grl") || strings.HasSuffix(key, ".json") {
+				keys = append(keys, key)
+				etags[key] = aws.ToString(object.ETag)
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return "", fmt.Errorf("no rule files found in s3://%s", prefixKey)
+	}
+
+	// Files are combined in key order so the rule set is stable between loads
+	sort.Strings(keys)
+	var rules []string
+	for _, key := range keys {
+		cacheKey := s.bucket + "/" + key
+		cached, ok := s3RuleCache.files[cacheKey]
+		if !ok || cached.etag != etags[key] {
+			body, err := s.download(ctx, key)
+			if err != nil {
+				return "", err
+			}
+			if strings.HasSuffix(key, ".json") {
+				if body, err = parseJSONRules([]byte(body)); err != nil {
+					return "", fmt.Errorf("invalid JSON rules in s3://%s: %w", cacheKey, err)
+				}
+			}
+			fmt.Printf("Loaded rule file s3://%s (ETag %s)\n", cacheKey, etags[key])
+			cached = cachedRuleFile{etag: etags[key], body: body}
+			s3RuleCache.files[cacheKey] = cached
+		}
+		rules = append(rules, cached.body)
+	}
+
+	s3RuleCache.rules[prefixKey] = strings.Join(rules, "\n\n")
+	s3RuleCache.checkedAt[prefixKey] = time.Now()
+	return s3RuleCache.rules[prefixKey], nil
+}
+
+func (s *s3RuleSource) download(ctx context.Context, key string) (string, error) {
+	resp, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to download rule file s3://%s/%s: %w", s.bucket, key, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read rule file s3://%s/%s: %w", s.bucket, key, err)
+	}
+	return string(body), nil
+}
+
+func rulesCacheTTL() time.Duration {
+	seconds, err := strconv.Atoi(config.Env("RULES_CACHE_SECONDS", strconv.Itoa(defaultRulesCacheSeconds)))
+	if err != nil || seconds < 0 {
+		seconds = defaultRulesCacheSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// Function to load generated rules from the shared cache, keyed by the
+// documents, the settings that shape the GRL and the generator's version
+func sharedCachedRules(ctx context.Context, ruleSource RuleSource, documents []catalog.CountryMusicDocument) (string, error) {
+	if _, generated := ruleSource.(generatedRuleSource); !generated || catalog.SharedCache() == nil {
+		return ruleSource.LoadRules(ctx, documents)
+	}
+	key := "rules:" + generatedRulesKey(documents)
+
+	var rules string
+	if catalog.SharedCacheGet(ctx, key, &rules) {
+		return rules, nil
+	}
+	rules, err := ruleSource.LoadRules(ctx, documents)
+	if err == nil {
+		catalog.SharedCacheSet(ctx, key, rules)
+	}
+	return rules, err
+}
+
+// Function to hash what generated rules depend on. Documents are taken in
+// RuleID order and printed with fmt, which writes map keys sorted, so the
+// same catalog always hashes the same however it was scanned.
+func generatedRulesKey(documents []catalog.CountryMusicDocument) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s|%s|%s|%s|", generatedRulesVersion, config.Env("RULE_TEMPLATE", ""), config.Env("CONFLICT_RESOLUTION", ""), config.Env("CONFLICT_RESOLUTION_SEED", ""))
+	hash.Write(grlTemplatesDigest())
+	for _, document := range catalog.SortedByRuleID(documents) {
+		fmt.Fprintf(hash, "%+v\n", document)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,173 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperjumptech/grule-rule-engine/ast"
+
+	"April32025/internal/catalog"
+	"April32025/internal/config"
+	"April32025/internal/scoring"
+)
+
+// Large catalogs are split into shards of CATALOG_SHARD_SIZE songs. Each
+// shard's rules are built into a knowledge base of their own, concurrently,
+// and executed concurrently against copies of the request's UserSelections
+// whose scores are merged afterwards. Songs never interact across rules, so
+// this gives the same scores as one knowledge base. Only the generated rule
+// source is sharded; hand-authored rule sets aren't tied to songs.
+const defaultCatalogShardSize = 2500
+
+// KnowledgeBaseSet is every knowledge base a request runs, one per shard
+type KnowledgeBaseSet struct {
+	Version string // identifies the rules of all shards together
+	Rules   string // combined GRL, for logs, auditing and debug output
+	Shards  []*ast.KnowledgeBase
+
+	ExtractTime time.Duration // spent loading rules, summed across shards
+	BuildTime   time.Duration // spent building libraries, zero when all were cached
+	RulesBuilt  int           // rules in the libraries this request rebuilt
+}
+
+// Function to count the rule entries across all shards
+func (s *KnowledgeBaseSet) RuleCount() int {
+	count := 0
+	for _, knowledgeBase := range s.Shards {
+		count += len(knowledgeBase.RuleEntries)
+	}
+	return count
+}
+
+func catalogShardSize() int {
+	size, err := strconv.Atoi(config.Env("CATALOG_SHARD_SIZE", strconv.Itoa(defaultCatalogShardSize)))
+	if err != nil || size <= 0 {
+		return defaultCatalogShardSize
+	}
+	return size
+}
+
+// Function to split documents into shards. Documents are ordered by RuleID
+// first so a song stays in the same shard, and unchanged shards keep hitting
+// the knowledge base cache, however the table scan orders them.
+func shardDocuments(documents []catalog.CountryMusicDocument, size int) [][]catalog.CountryMusicDocument {
+	if len(documents) <= size {
+		return [][]catalog.CountryMusicDocument{documents}
+	}
+	sorted := catalog.SortedByRuleID(documents)
+
+	var shards [][]catalog.CountryMusicDocument
+	for start := 0; start < len(sorted); start += size {
+		shards = append(shards, sorted[start:min(start+size, len(sorted))])
+	}
+	return shards
+}
+
+// Function to load and build the knowledge bases for a catalog, reporting
+// whether any shard had to be rebuilt
+func BuildKnowledgeBases(ctx context.Context, c config.Catalog, ruleSource RuleSource, documents []catalog.CountryMusicDocument) (*KnowledgeBaseSet, bool, error) {
+	shards := [][]catalog.CountryMusicDocument{documents}
+	if _, generated := ruleSource.(generatedRuleSource); generated {
+		shards = shardDocuments(documents, catalogShardSize())
+	}
+
+	set := &KnowledgeBaseSet{Shards: make([]*ast.KnowledgeBase, len(shards))}
+	rules := make([]string, len(shards))
+	rebuilt := make([]bool, len(shards))
+	errs := make([]error, len(shards))
+	extractTimes := make([]time.Duration, len(shards))
+	buildTimes := make([]time.Duration, len(shards))
+
+	var wg sync.WaitGroup
+	for i, shard := range shards {
+		wg.Add(1)
+		go func(i int, shard []catalog.CountryMusicDocument) {
+			defer wg.Done()
+			start := time.Now()
+			rules[i], errs[i] = sharedCachedRules(ctx, ruleSource, shard)
+			extractTimes[i] = time.Since(start)
+			if errs[i] != nil {
+				return
+			}
+			start = time.Now()
+			set.Shards[i], rebuilt[i], errs[i] = getKnowledgeBase(c, i, rules[i])
+			buildTimes[i] = time.Since(start)
+		}(i, shard)
+	}
+	wg.Wait()
+
+	anyRebuilt := false
+	for i := range shards {
+		if errs[i] != nil {
+			return nil, false, errs[i]
+		}
+		anyRebuilt = anyRebuilt || rebuilt[i]
+		set.ExtractTime += extractTimes[i]
+		if rebuilt[i] {
+			set.BuildTime += buildTimes[i]
+			set.RulesBuilt += len(set.Shards[i].RuleEntries)
+		}
+	}
+	set.Rules = strings.Join(rules, "\n\n")
+	set.Version = ruleSetVersion(set.Rules)
+	if len(shards) > 1 {
+		fmt.Printf("Built %d shards of up to %d songs for %s\n", len(shards), catalogShardSize(), c.Genre)
+	}
+	return set, anyRebuilt, nil
+}
+
+// Function to put the request's facts into a data context
+func NewRuleFacts(userSelections *scoring.UserSelections, catalogFact *Catalog) ast.IDataContext {
+	dataCtx := ast.NewDataContext()
+	dataCtx.Add("UserSelections", userSelections)
+	dataCtx.Add("Catalog", catalogFact)
+	return dataCtx
+}
+
+// Function to execute every shard and merge their scores into userSelections
+func ExecuteKnowledgeBases(ctx context.Context, set *KnowledgeBaseSet, userSelections *scoring.UserSelections, catalogFact *Catalog, maxCycle uint64) (ExecutionResult, error) {
+	if len(set.Shards) == 1 {
+		return executeRules(ctx, NewRuleFacts(userSelections, catalogFact), set.Shards[0], maxCycle)
+	}
+
+	selections := make([]*scoring.UserSelections, len(set.Shards))
+	results := make([]ExecutionResult, len(set.Shards))
+	errs := make([]error, len(set.Shards))
+
+	var wg sync.WaitGroup
+	for i, knowledgeBase := range set.Shards {
+		selections[i] = userSelections.ForShard()
+		wg.Add(1)
+		go func(i int, knowledgeBase *ast.KnowledgeBase) {
+			defer wg.Done()
+			results[i], errs[i] = executeRules(ctx, NewRuleFacts(selections[i], catalogFact), knowledgeBase, maxCycle)
+		}(i, knowledgeBase)
+	}
+	wg.Wait()
+
+	merged := ExecutionResult{Trace: NewRuleTrace()}
+	for i := range set.Shards {
+		if errs[i] != nil {
+			return merged, errs[i]
+		}
+		for songId, score := range selections[i].Recommendations {
+			userSelections.Recommendations[songId] = score
+		}
+		for songId, contributions := range selections[i].Contributions {
+			userSelections.Contributions[songId] = contributions
+		}
+		for songId, breakdown := range selections[i].Breakdowns {
+			userSelections.Breakdowns[songId] = breakdown
+		}
+		userSelections.FiredRules = append(userSelections.FiredRules, selections[i].FiredRules...)
+		merged.Trace.merge(results[i].Trace)
+		if merged.PartialReason == "" {
+			merged.PartialReason = results[i].PartialReason
+		}
+	}
+	return merged, nil
+}
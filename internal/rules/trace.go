@@ -0,0 +1,81 @@
+package rules
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperjumptech/grule-rule-engine/ast"
+)
+
+// RuleTrace records what the engine did during one execution. It implements
+// engine.GruleEngineListener; Grule has no "rule finished" callback, so a
+// fired rule's duration runs until the next cycle begins or finish is called.
+type RuleTrace struct {
+	Cycles      uint64           `json:"cycles"`
+	Evaluations int              `json:"evaluations"` // when-scope evaluations across all cycles
+	Candidates  int              `json:"candidates"`  // evaluations whose when-scope passed
+	Fired       []firedRuleTrace `json:"fired"`
+	Evaluated   map[string]int   `json:"evaluated"` // rule name -> times its when-scope ran
+
+	running      bool // the last entry in Fired is still executing
+	runningSince time.Time
+}
+
+type firedRuleTrace struct {
+	Rule       string `json:"rule"`
+	Cycle      uint64 `json:"cycle"`
+	DurationUs int64  `json:"durationUs"`
+}
+
+func NewRuleTrace() *RuleTrace {
+	return &RuleTrace{
+		Fired:     []firedRuleTrace{},
+		Evaluated: make(map[string]int),
+	}
+}
+
+func (t *RuleTrace) EvaluateRuleEntry(cycle uint64, entry *ast.RuleEntry, candidate bool) {
+	t.Evaluations++
+	t.Evaluated[entry.RuleName]++
+	if candidate {
+		t.Candidates++
+	}
+}
+
+func (t *RuleTrace) ExecuteRuleEntry(cycle uint64, entry *ast.RuleEntry) {
+	t.Fired = append(t.Fired, firedRuleTrace{Rule: entry.RuleName, Cycle: cycle})
+	t.running = true
+	t.runningSince = time.Now()
+}
+
+func (t *RuleTrace) BeginCycle(cycle uint64) {
+	t.finish()
+	t.Cycles = cycle
+}
+
+// Function to close the timing of the rule that fired last
+func (t *RuleTrace) finish() {
+	if t.running {
+		t.Fired[len(t.Fired)-1].DurationUs = time.Since(t.runningSince).Microseconds()
+		t.running = false
+	}
+}
+
+// Function to fold another shard's trace into this one
+func (t *RuleTrace) merge(other *RuleTrace) {
+	t.Cycles += other.Cycles
+	t.Evaluations += other.Evaluations
+	t.Candidates += other.Candidates
+	t.Fired = append(t.Fired, other.Fired...)
+	for rule, count := range other.Evaluated {
+		t.Evaluated[rule] += count
+	}
+}
+
+// Function to log a one-line summary plus every fired rule
+func (t *RuleTrace) log() {
+	fmt.Printf("Rule trace: %d cycles, %d evaluations, %d candidates, %d fired\n", t.Cycles, t.Evaluations, t.Candidates, len(t.Fired))
+	for _, fired := range t.Fired {
+		fmt.Printf("Rule trace: cycle %d fired %s in %dus\n", fired.Cycle, fired.Rule, fired.DurationUs)
+	}
+}
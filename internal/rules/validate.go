@@ -0,0 +1,127 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hyperjumptech/grule-rule-engine/ast"
+	"github.com/hyperjumptech/grule-rule-engine/builder"
+	"github.com/hyperjumptech/grule-rule-engine/pkg"
+
+	"April32025/internal/api"
+	"April32025/internal/catalog"
+	"April32025/internal/config"
+	"April32025/internal/scoring"
+)
+
+// validateRules builds the catalog's rules and reports problems without
+// executing anything, so curators can check new songs before users hit them.
+
+// ruleValidationReport is the response to a validateRules request
+type ruleValidationReport struct {
+	RequestID    string              `json:"requestId"`
+	Genre        string              `json:"genre"`
+	RuleSource   string              `json:"ruleSource"`
+	RulesVersion string              `json:"rulesVersion,omitempty"` // version the rule set would be served under
+	CatalogSize  int                 `json:"catalogSize"`
+	Valid        bool                `json:"valid"`
+	Errors       []documentRuleError `json:"errors"`
+	// Set when the combined rule set fails even though the documents pass on
+	// their own, e.g. two RuleIDs that map to the same rule name
+	RuleSetError string `json:"ruleSetError,omitempty"`
+}
+
+type documentRuleError struct {
+	RuleID string `json:"ruleId"`
+	Title  string `json:"title"`
+	Error  string `json:"error"`
+}
+
+// Function to check that a document's rule compiles and only names known
+// themes, since a misspelled theme silently never matches
+func validateDocumentRule(document catalog.CountryMusicDocument, rule string) error {
+	if err := compileRules(rule); err != nil {
+		return err
+	}
+	if _, ok := scoring.TierRanks[document.Tier]; document.Tier != "" && !ok {
+		return fmt.Errorf("unknown tier '%s'", document.Tier)
+	}
+	if document.RuleJSON == "" {
+		if len(documentThemeFields(document)) == 0 {
+			return fmt.Errorf("no themes, so its rule can never match")
+		}
+		themes := append(documentThemeFields(document), document.RequiredThemes...)
+		for _, theme := range append(themes, document.ExcludedThemes...) {
+			if _, ok := catalog.CanonicalTheme(theme); !ok {
+				return fmt.Errorf("unknown theme '%s'", theme)
+			}
+		}
+	}
+	return nil
+}
+
+// Helper function to build rules into a throwaway library
+func compileRules(rules string) error {
+	ruleBuilder := builder.NewRuleBuilder(ast.NewKnowledgeLibrary())
+	return ruleBuilder.BuildRuleFromResource("Validate", "0", pkg.NewBytesResource([]byte(rules)))
+}
+
+// Function to dry-run a catalog's rules, one document at a time and then as
+// the set the rule source would build
+func ValidateRules(ctx context.Context, c config.Catalog, documents []catalog.CountryMusicDocument, ruleSource RuleSource) ruleValidationReport {
+	report := ruleValidationReport{
+		RequestID:   api.RequestID(ctx),
+		Genre:       c.Genre,
+		RuleSource:  ruleSource.Name(),
+		CatalogSize: len(documents),
+		Errors:      []documentRuleError{},
+	}
+	// Items the loader already left out, see catalog/quarantine.go
+	for _, rejection := range catalog.TakeRejectedItems() {
+		report.Errors = append(report.Errors, documentRuleError{
+			RuleID: catalog.GetStringValue(rejection.Item["RuleID"]),
+			Title:  catalog.GetStringValue(rejection.Item["title"]),
+			Error:  rejection.Reason,
+		})
+	}
+	// Lint first so documents get a specific complaint rather than the
+	// parser's error count; only documents that pass are compiled
+	var rendered []catalog.CountryMusicDocument
+	var rules []string
+	for _, document := range documents {
+		rule, err := documentRule(document, ruleSalience(document.Popularity))
+		if err != nil {
+			report.Errors = append(report.Errors, documentRuleError{RuleID: document.RuleID, Title: document.Title, Error: err.Error()})
+			continue
+		}
+		rendered = append(rendered, document)
+		rules = append(rules, rule)
+	}
+	lintIssues := lintDocumentRules(rendered, rules)
+	linted := make(map[string]bool)
+	for _, issue := range lintIssues {
+		linted[issue.RuleID] = true
+	}
+	report.Errors = append(report.Errors, lintIssues...)
+	for i, document := range rendered {
+		if linted[document.RuleID] {
+			continue
+		}
+		if err := validateDocumentRule(document, rules[i]); err != nil {
+			report.Errors = append(report.Errors, documentRuleError{RuleID: document.RuleID, Title: document.Title, Error: err.Error()})
+		}
+	}
+
+	if rules, err := ruleSource.LoadRules(ctx, documents); err != nil {
+		report.RuleSetError = err.Error()
+	} else {
+		report.RulesVersion = ruleSetVersion(rules)
+		if err := compileRules(rules); err != nil {
+			report.RuleSetError = err.Error()
+		}
+	}
+	report.Valid = len(report.Errors) == 0 && report.RuleSetError == ""
+	fmt.Printf("Validated %d %s documents: %d errors, rule set valid: %t\n", len(documents), c.Genre, len(report.Errors), report.RuleSetError == "")
+
+	return report
+}
@@ -0,0 +1,153 @@
+package scoring
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"April32025/internal/api"
+	"April32025/internal/catalog"
+	"April32025/internal/config"
+)
+
+// Requests can name the listener's "favoriteArtists". Their songs get an
+// affinity boost of affinityWeight points (SCORING_AFFINITY_WEIGHT or the
+// scoring config item's affinityWeight, default 10), and with
+// ARTIST_RELATIONS_TABLE set so do songs by related artists, scaled by how
+// similar they are. Each item there (key "artist", lowercase) lists its
+// related artists and a 0-1 similarity:
+//
+//	{ "artist": "george strait", "related": { "alan jackson": 0.8, "randy travis": 0.6 } }
+//
+// A song by an artist related to several favorites takes the closest. The
+// table is small and hand-maintained; relations aren't assumed to be
+// symmetric, so list both directions when they should be. Lookup failures
+// are logged and leave just the exact matches boosted.
+const (
+	maxFavoriteArtists    = 20
+	defaultAffinityWeight = 10
+	relatedArtistsRetries = 3
+)
+
+// Function to check the requested favorite artists
+func ValidateFavoriteArtists(artists []string) error {
+	if len(artists) > maxFavoriteArtists {
+		return api.BadRequest("too_many_favorite_artists", "at most %d favoriteArtists are allowed", maxFavoriteArtists)
+	}
+	for _, artist := range artists {
+		if strings.TrimSpace(artist) == "" {
+			return api.BadRequest("invalid_favorite_artist", "favoriteArtists must not be empty")
+		}
+	}
+	return nil
+}
+
+// Function to load the artists related to each of the given artists and
+// their similarity, in one BatchGetItem; maxFavoriteArtists is well under its
+// 100 key limit. Keys DynamoDB leaves unprocessed are retried a few times.
+func loadRelatedArtists(ctx context.Context, svc *dynamodb.Client, artists []string) (map[string]map[string]float64, error) {
+	table := config.Storage().ArtistRelationsTable
+	keys := make([]map[string]types.AttributeValue, 0, len(artists))
+	for _, artist := range artists {
+		keys = append(keys, map[string]types.AttributeValue{
+			"artist": &types.AttributeValueMemberS{Value: artist},
+		})
+	}
+
+	var items []map[string]types.AttributeValue
+	for attempt := 0; len(keys) > 0; attempt++ {
+		if attempt > relatedArtistsRetries {
+			return nil, fmt.Errorf("%d artists still unprocessed after %d retries", len(keys), relatedArtistsRetries)
+		}
+		if attempt > 0 {
+			select {
+			case <-time.After(time.Duration(50<<attempt) * time.Millisecond):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		resp, err := svc.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+			RequestItems: map[string]types.KeysAndAttributes{
+				table: {Keys: keys},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, resp.Responses[table]...)
+		keys = resp.UnprocessedKeys[table].Keys
+	}
+
+	relations := make(map[string]map[string]float64)
+	for _, item := range items {
+		artist := catalog.GetStringValue(item["artist"])
+		related := make(map[string]float64)
+		if mAttr, ok := item["related"].(*types.AttributeValueMemberM); ok {
+			for name, value := range mAttr.Value {
+				similarity, err := strconv.ParseFloat(catalog.GetNumberValue(value), 64)
+				if err != nil || similarity < 0 || similarity > 1 {
+					fmt.Printf("Skipping related artist %s of %s, similarity is not between 0 and 1\n", name, artist)
+					continue
+				}
+				related[strings.ToLower(strings.TrimSpace(name))] = similarity
+			}
+		}
+		relations[artist] = related
+	}
+	return relations, nil
+}
+
+// Function to rate 0-1 the listener's affinity for each artist: 1 for the
+// favorites, their similarity for related artists
+func artistAffinities(ctx context.Context, svc *dynamodb.Client, favorites []string) map[string]float64 {
+	affinities := make(map[string]float64)
+	for _, favorite := range favorites {
+		affinities[strings.ToLower(strings.TrimSpace(favorite))] = 1
+	}
+	if config.Storage().ArtistRelationsTable == "" {
+		return affinities
+	}
+	relations, err := loadRelatedArtists(ctx, svc, slices.Sorted(maps.Keys(affinities)))
+	if err != nil {
+		fmt.Println("Failed to load related artists:", err)
+		return affinities
+	}
+	for _, related := range relations {
+		for artist, similarity := range related {
+			affinities[artist] = max(affinities[artist], similarity)
+		}
+	}
+	return affinities
+}
+
+// Function to boost the scored songs by the listener's favorite and related
+// artists
+func ApplyArtistAffinity(ctx context.Context, svc *dynamodb.Client, p *UserSelections, documents []catalog.CountryMusicDocument, favorites []string) {
+	weight := p.Config().AffinityWeight
+	if len(favorites) == 0 || weight == 0 || len(p.Recommendations) == 0 {
+		return
+	}
+	affinities := artistAffinities(ctx, svc, favorites)
+	artists := SongArtists(documents)
+	boosted := 0
+	for songID, score := range p.Recommendations {
+		affinity, ok := affinities[artists[songID]]
+		if !ok {
+			continue
+		}
+		if boost := int(math.Round(weight * affinity)); boost != 0 {
+			p.Recommendations[songID] = score + boost
+			p.breakdown(songID).Affinity = boost
+			boosted++
+		}
+	}
+	fmt.Printf("Artist affinity for %d artists boosted %d songs\n", len(affinities), boosted)
+}
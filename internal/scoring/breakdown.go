@@ -0,0 +1,63 @@
+package scoring
+
+// Every recommendation carries a breakdown of how its score was built, so
+// product can answer "why did this song rank #1?" without debug mode. Each
+// stage of the scoring pipeline records its own points as it runs: the theme
+// rules (or the similarity scorer), the penalty, the normalization, the boosts
+// and penalties applied after the rules, then the learned ranker. Points that
+// no stage claims came from hand-authored rules or ruleOverrides setting
+// scores themselves and are reported as "rules", so the parts always add up
+// to the total.
+// Diversity never changes a score, only the order; the breakdown says how far
+// the re-ranker moved a song and when it was held back behind other artists'
+// songs.
+
+// ScoreBreakdown is the makeup of a recommendation's score
+type ScoreBreakdown struct {
+	ThemePoints   int `json:"themePoints"`             // matched themes, importance and theme weights included
+	Penalty       int `json:"penalty"`                 // unselected themes, zero or less
+	Normalization int `json:"normalization,omitempty"` // change made by percent normalization
+	Rules         int `json:"rules,omitempty"`         // points set by hand-authored rules
+	Popularity    int `json:"popularity,omitempty"`
+	Recency       int `json:"recency,omitempty"`
+	Intensity     int `json:"intensity,omitempty"` // closeness to the requested intensity, see intensity.go
+	Affinity      int `json:"affinity,omitempty"`  // favorite and related artists, see affinity.go
+	Collaborative int `json:"collaborative,omitempty"`
+	RepeatPenalty int `json:"repeatPenalty,omitempty"` // zero or less
+	Exposure      int `json:"exposure,omitempty"`      // zero or less, see exposure.go
+	Seasonal      int `json:"seasonal,omitempty"`
+	Ranker        int `json:"ranker,omitempty"` // change made by the learned ranker, see ranker.go
+	Total         int `json:"total"`
+
+	RerankShift       int    `json:"rerankShift,omitempty"`       // places moved up by re-ranking, negative for down, see rerank.go
+	DiversityHeldBack bool   `json:"diversityHeldBack,omitempty"` // ranked behind other artists' songs, see diversity.go
+	Variant           string `json:"variant,omitempty"`           // experiment variant that scored it, see experiments.go
+}
+
+// Helper function to get a song's breakdown for a stage to add to
+func (p *UserSelections) breakdown(songId string) *ScoreBreakdown {
+	if p.Breakdowns == nil {
+		p.Breakdowns = make(map[string]*ScoreBreakdown)
+	}
+	b, ok := p.Breakdowns[songId]
+	if !ok {
+		b = &ScoreBreakdown{}
+		p.Breakdowns[songId] = b
+	}
+	return b
+}
+
+// Function to finish a song's breakdown against its final score
+func (p *UserSelections) FinalBreakdown(songId string, rerankShift int, heldBack bool) *ScoreBreakdown {
+	score, scored := p.Recommendations[songId]
+	if !scored {
+		return nil
+	}
+	b := *p.breakdown(songId)
+	b.Total = score
+	b.Rules = score - (b.ThemePoints + b.Penalty + b.Normalization + b.Popularity + b.Recency + b.Intensity + b.Affinity + b.Collaborative + b.RepeatPenalty + b.Exposure + b.Seasonal + b.Ranker)
+	b.RerankShift = rerankShift
+	b.DiversityHeldBack = heldBack
+	b.Variant = p.Variant
+	return &b
+}
@@ -0,0 +1,270 @@
+package scoring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"April32025/internal/catalog"
+	"April32025/internal/config"
+)
+
+// With COUNTERS_TABLE set, the function counts how often each song is
+// served and accepted across all listeners, per segment: a genre and the
+// exact set of selected themes, e.g. "country#Heartbreak,Trucks". The table is
+// keyed by segment (partition) and songId (sort) with "recommended" and
+// "accepted" counts, and also holds the genre-wide exposure counts, see
+// exposure.go. Every page served adds to recommended; clients report
+// the songs a listener played or saved with the "accept" action, passing the
+// same themes and the songs as songIds. Accepts need a signed-in userId and
+// count once per listener, song and segment: a marker item keyed
+// "acceptedBy#<userId>#<segment>" is written with the count in one
+// transaction, and a repeat finds the marker and is skipped.
+//
+// With a collaborative weight (SCORING_COLLABORATIVE_WEIGHT or the scoring
+// config item's collaborativeWeight, default 0 for off) the counts become a
+// second-stage ranker: once the rules and boosts have run, each scored song
+// gets weight * accepted / (recommended + 10) points from its segment, so
+// "people with similar selections also liked" songs rise. The 10 serves of
+// prior keep a song accepted once out of one serve from jumping the ranking.
+//
+// Counter writes are single-item updates, which DynamoDB can't batch, so a
+// page's songs are counted a few at a time in parallel. Segment counts are
+// read through a per-container cache (SEGMENT_STATS_CACHE_SECONDS, default
+// 60), since a few seconds' stale counts rank just as well as fresh ones.
+const (
+	collaborativePriorServes = 10
+	counterWriteConcurrency  = 8
+	acceptMarkerPrefix       = "acceptedBy#"
+
+	defaultSegmentStatsCacheSeconds = 60
+)
+
+// segmentStats are a song's counts within a segment
+type segmentStats struct {
+	Recommended int
+	Accepted    int
+}
+
+// Helper function to name the segment of listeners who made the same
+// selections, "" when nothing is selected
+func SelectionSegment(c config.Catalog, p *UserSelections) string {
+	themes := slices.Sorted(maps.Keys(p.Selected))
+	if len(themes) == 0 {
+		return ""
+	}
+	return c.Genre + "#" + strings.Join(themes, ",")
+}
+
+// Helper function to run a counter write for each distinct song, a few at a
+// time, and return how many succeeded
+func writeCountersConcurrently(songIDs []string, write func(songID string) bool) int {
+	songIDs = slices.Compact(slices.Sorted(slices.Values(songIDs)))
+	var counted atomic.Int64
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, counterWriteConcurrency)
+	for _, songID := range songIDs {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(songID string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if write(songID) {
+				counted.Add(1)
+			}
+		}(songID)
+	}
+	wg.Wait()
+	return int(counted.Load())
+}
+
+// Helper function to build the update adding one to a song's counter
+func counterUpdate(table string, segment string, songID string, counter string) *types.Update {
+	return &types.Update{
+		TableName: aws.String(table),
+		Key: map[string]types.AttributeValue{
+			"segment": &types.AttributeValueMemberS{Value: segment},
+			"songId":  &types.AttributeValueMemberS{Value: songID},
+		},
+		UpdateExpression:          aws.String("ADD #counter :one"),
+		ExpressionAttributeNames:  map[string]string{"#counter": counter},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":one": &types.AttributeValueMemberN{Value: "1"}},
+	}
+}
+
+// Function to add one to a counter of each distinct song in a segment.
+// Failures are logged; counting never fails a request.
+func IncrementSegmentCounters(ctx context.Context, svc *dynamodb.Client, segment string, songIDs []string, counter string) int {
+	table := config.Storage().CountersTable
+	if table == "" || segment == "" {
+		return 0
+	}
+	return writeCountersConcurrently(songIDs, func(songID string) bool {
+		update := counterUpdate(table, segment, songID, counter)
+		_, err := svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:                 update.TableName,
+			Key:                       update.Key,
+			UpdateExpression:          update.UpdateExpression,
+			ExpressionAttributeNames:  update.ExpressionAttributeNames,
+			ExpressionAttributeValues: update.ExpressionAttributeValues,
+		})
+		if err != nil {
+			fmt.Printf("Failed to count %s for song %s: %v\n", counter, songID, err)
+			return false
+		}
+		return true
+	})
+}
+
+// Function to count each distinct song as accepted by a listener in a
+// segment, skipping songs they already accepted there, and return how many
+// were counted
+func RecordAccepts(ctx context.Context, svc *dynamodb.Client, segment string, userID string, songIDs []string) int {
+	table := config.Storage().CountersTable
+	if table == "" || segment == "" || userID == "" {
+		return 0
+	}
+	marker := acceptMarkerPrefix + userID + "#" + segment
+	return writeCountersConcurrently(songIDs, func(songID string) bool {
+		_, err := svc.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+			TransactItems: []types.TransactWriteItem{
+				{Put: &types.Put{
+					TableName: aws.String(table),
+					Item: map[string]types.AttributeValue{
+						"segment": &types.AttributeValueMemberS{Value: marker},
+						"songId":  &types.AttributeValueMemberS{Value: songID},
+					},
+					ConditionExpression: aws.String("attribute_not_exists(songId)"),
+				}},
+				{Update: counterUpdate(table, segment, songID, "accepted")},
+			},
+		})
+		var canceled *types.TransactionCanceledException
+		if errors.As(err, &canceled) && len(canceled.CancellationReasons) > 0 && aws.ToString(canceled.CancellationReasons[0].Code) == "ConditionalCheckFailed" {
+			fmt.Printf("Song %s was already accepted by %s in %s\n", songID, userID, segment)
+			return false
+		}
+		if err != nil {
+			fmt.Printf("Failed to count accepted for song %s: %v\n", songID, err)
+			return false
+		}
+		return true
+	})
+}
+
+// Function to count the songs on a served page as recommended to their segment
+func RecordServedCounts(ctx context.Context, svc *dynamodb.Client, c config.Catalog, p *UserSelections, songIDs []string) {
+	IncrementSegmentCounters(ctx, svc, SelectionSegment(c, p), songIDs, "recommended")
+}
+
+// Function to read every song's counts in a segment
+func loadSegmentStats(ctx context.Context, svc *dynamodb.Client, segment string) (map[string]segmentStats, error) {
+	paginator := dynamodb.NewQueryPaginator(svc, &dynamodb.QueryInput{
+		TableName:                 aws.String(config.Storage().CountersTable),
+		KeyConditionExpression:    aws.String("#segment = :segment"),
+		ExpressionAttributeNames:  map[string]string{"#segment": "segment"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":segment": &types.AttributeValueMemberS{Value: segment}},
+	})
+	stats := make(map[string]segmentStats)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			recommended, _ := strconv.Atoi(catalog.GetNumberValue(item["recommended"]))
+			accepted, _ := strconv.Atoi(catalog.GetNumberValue(item["accepted"]))
+			stats[catalog.GetStringValue(item["songId"])] = segmentStats{Recommended: recommended, Accepted: accepted}
+		}
+	}
+	return stats, nil
+}
+
+var segmentStatsCache = struct {
+	sync.Mutex
+	stats    map[string]map[string]segmentStats
+	loadedAt map[string]time.Time
+}{stats: map[string]map[string]segmentStats{}, loadedAt: map[string]time.Time{}}
+
+func segmentStatsCacheTTL() time.Duration {
+	seconds, err := strconv.Atoi(config.Env("SEGMENT_STATS_CACHE_SECONDS", strconv.Itoa(defaultSegmentStatsCacheSeconds)))
+	if err != nil || seconds < 0 {
+		seconds = defaultSegmentStatsCacheSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// Function to get a segment's counts from the cache, loading them when
+// missing or stale. A segment split over several partitions lists them as
+// parts; the counts are merged.
+func cachedSegmentStats(ctx context.Context, svc *dynamodb.Client, segment string, parts ...string) (map[string]segmentStats, error) {
+	segmentStatsCache.Lock()
+	stats, cached := segmentStatsCache.stats[segment]
+	fresh := cached && time.Since(segmentStatsCache.loadedAt[segment]) < segmentStatsCacheTTL()
+	segmentStatsCache.Unlock()
+	if fresh {
+		return stats, nil
+	}
+
+	if len(parts) == 0 {
+		parts = []string{segment}
+	}
+	stats = make(map[string]segmentStats)
+	for _, part := range parts {
+		partStats, err := loadSegmentStats(ctx, svc, part)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(stats, partStats)
+	}
+
+	segmentStatsCache.Lock()
+	segmentStatsCache.stats[segment] = stats
+	segmentStatsCache.loadedAt[segment] = time.Now()
+	segmentStatsCache.Unlock()
+	return stats, nil
+}
+
+// Helper function to get the points a song's segment counts are worth
+func collaborativeBoost(weight float64, stats segmentStats) int {
+	return int(math.Round(weight * float64(stats.Accepted) / float64(stats.Recommended+collaborativePriorServes)))
+}
+
+// Function to re-rank the scored songs by what their segment accepted.
+// Failures are logged and leave the scores as the rules made them.
+func ApplyCollaborativeSignals(ctx context.Context, svc *dynamodb.Client, c config.Catalog, p *UserSelections) {
+	weight := p.Config().CollaborativeWeight
+	segment := SelectionSegment(c, p)
+	if weight == 0 || config.Storage().CountersTable == "" || segment == "" || len(p.Recommendations) == 0 {
+		return
+	}
+	stats, err := cachedSegmentStats(ctx, svc, segment)
+	if err != nil {
+		fmt.Println("Failed to load collaborative signals:", err)
+		return
+	}
+
+	boosted := make([]string, 0)
+	for songID, score := range p.Recommendations {
+		if boost := collaborativeBoost(weight, stats[songID]); boost != 0 {
+			p.Recommendations[songID] = score + boost
+			p.breakdown(songID).Collaborative = boost
+			boosted = append(boosted, songID)
+		}
+	}
+	sort.Strings(boosted)
+	fmt.Printf("Collaborative signals from %s boosted %d songs: %v\n", segment, len(boosted), boosted)
+}
@@ -0,0 +1,76 @@
+package scoring
+
+import (
+	"strconv"
+	"strings"
+
+	"April32025/internal/catalog"
+	"April32025/internal/config"
+)
+
+// So a page doesn't fill up with one artist, the ranking keeps at most
+// DIVERSITY_MAX_PER_ARTIST songs per artist (default 2, 0 for no limit) ahead
+// of everyone else's. Songs over the limit aren't dropped but moved, in score
+// order, behind the songs within it, so they still fill out short result sets
+// and later pages. Artists are compared case-insensitively; songs without an
+// artist are never held back.
+const defaultMaxPerArtist = 2
+
+func MaxSongsPerArtist() int {
+	limit, err := strconv.Atoi(config.Env("DIVERSITY_MAX_PER_ARTIST", strconv.Itoa(defaultMaxPerArtist)))
+	if err != nil || limit < 0 {
+		return defaultMaxPerArtist
+	}
+	return limit
+}
+
+// Helper function to map each song to its normalized artist
+func SongArtists(documents []catalog.CountryMusicDocument) map[string]string {
+	artists := make(map[string]string, len(documents))
+	for _, document := range documents {
+		if artist := strings.ToLower(strings.TrimSpace(document.Artist)); artist != "" {
+			artists[document.RuleID] = artist
+		}
+	}
+	return artists
+}
+
+// Function to reorder a ranking so no artist has more than maxPerArtist songs
+// ahead of the songs held back
+func DiversifyRanking(rankedRuleIDs []string, artists map[string]string, maxPerArtist int) []string {
+	heldBack := HeldBackByDiversity(rankedRuleIDs, artists, maxPerArtist)
+	if len(heldBack) == 0 {
+		return rankedRuleIDs
+	}
+	diverse := make([]string, 0, len(rankedRuleIDs))
+	var behind []string
+	for _, ruleID := range rankedRuleIDs {
+		if heldBack[ruleID] {
+			behind = append(behind, ruleID)
+		} else {
+			diverse = append(diverse, ruleID)
+		}
+	}
+	return append(diverse, behind...)
+}
+
+// Function to find the songs past their artist's first maxPerArtist in a
+// ranking
+func HeldBackByDiversity(rankedRuleIDs []string, artists map[string]string, maxPerArtist int) map[string]bool {
+	heldBack := make(map[string]bool)
+	if maxPerArtist <= 0 {
+		return heldBack
+	}
+	perArtist := make(map[string]int)
+	for _, ruleID := range rankedRuleIDs {
+		artist, ok := artists[ruleID]
+		if !ok {
+			continue
+		}
+		if perArtist[artist] >= maxPerArtist {
+			heldBack[ruleID] = true
+		}
+		perArtist[artist]++
+	}
+	return heldBack
+}
@@ -0,0 +1,84 @@
+package scoring
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"April32025/internal/catalog"
+)
+
+// Catalogs pick up the same song more than once: a live or remastered
+// version, an entry imported twice, a cover. So one song can't take several
+// slots, results keep a single entry per song. Songs are the same when their
+// normalized artist and title match: lowercase, without bracketed or dashed
+// version notes ("(Live)", "[Remastered 2011]", "- Radio Edit"), "feat."
+// credits and punctuation. A cover names the artist it covers in
+// "originalArtist" and counts as that artist's song. Of the entries for one
+// song the highest-scoring is kept; on a tie the original over a cover, then
+// the lowest RuleID.
+var (
+	versionNotePattern = regexp.MustCompile(`\s*(\([^)]*\)|\[[^\]]*\]|\s-\s.*$)`)
+	featuringPattern   = regexp.MustCompile(`\s(feat\.?|ft\.?|featuring)\s.*$`)
+	punctuationPattern = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+)
+
+// Helper function to reduce a title or artist to the form songs are compared by
+func normalizeSongText(text string) string {
+	text = strings.ToLower(text)
+	text = versionNotePattern.ReplaceAllString(text, "")
+	text = featuringPattern.ReplaceAllString(text, "")
+	return strings.TrimSpace(punctuationPattern.ReplaceAllString(text, " "))
+}
+
+// Helper function to identify the song a catalog entry is a recording of,
+// "" when it has no title
+func songKey(document catalog.CountryMusicDocument) string {
+	title := normalizeSongText(document.Title)
+	if title == "" {
+		return ""
+	}
+	artist := document.Artist
+	if document.OriginalArtist != "" {
+		artist = document.OriginalArtist
+	}
+	return normalizeSongText(artist) + "|" + title
+}
+
+// Function to drop the scored entries that repeat a song, keeping the best
+// one, and return how many were dropped. The dropped entries are recorded in
+// Duplicates so later stages don't bring them back.
+func (p *UserSelections) DropDuplicateSongs(documents []catalog.CountryMusicDocument) int {
+	kept := make(map[string]catalog.CountryMusicDocument)
+	var duplicates []string
+	for _, document := range catalog.SortedByRuleID(documents) {
+		score, scored := p.Recommendations[document.RuleID]
+		key := songKey(document)
+		if !scored || key == "" {
+			continue
+		}
+		best, seen := kept[key]
+		if !seen {
+			kept[key] = document
+			continue
+		}
+		bestScore := p.Recommendations[best.RuleID]
+		if score > bestScore || (score == bestScore && best.OriginalArtist != "" && document.OriginalArtist == "") {
+			duplicates = append(duplicates, best.RuleID)
+			kept[key] = document
+		} else {
+			duplicates = append(duplicates, document.RuleID)
+		}
+	}
+	if p.Duplicates == nil {
+		p.Duplicates = make(map[string]bool)
+	}
+	for _, songId := range duplicates {
+		delete(p.Recommendations, songId)
+		p.Duplicates[songId] = true
+	}
+	if len(duplicates) > 0 {
+		fmt.Printf("Dropped %d duplicate songs: %v\n", len(duplicates), duplicates)
+	}
+	return len(duplicates)
+}
@@ -0,0 +1,187 @@
+package scoring
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	"April32025/internal/api"
+	"April32025/internal/config"
+)
+
+// Scoring experiments split known listeners between scorers (see
+// similarity.go). SCORING_EXPERIMENT names the experiment and weighs its
+// variants, each a scorer:
+//
+//	SCORING_EXPERIMENT=similarity-2025q4:rules=50,similarity=50
+//
+// A listener's variant comes from a hash of the experiment name and their
+// userId, so they stay in it across requests and a new experiment name
+// reshuffles everyone. The response's "experiment" and the listener's history
+// record the variant, and an ExperimentRequests metric is logged per variant.
+//
+// Requests that pick a scorer themselves, send ruleOverrides or
+// scoringOverrides or have no userId aren't enrolled. For QA, the
+// X-Experiment-Variant header (or "experimentVariant" on direct invocations)
+// forces a variant, userId or not. Over HTTP the authorizer must grant the
+// curator or qa role, unless EXPERIMENT_OVERRIDE_ANY_CALLER=true in a test
+// deployment; anyone else sending it is refused, so listeners can't pick
+// their own variant and skew the results.
+const ExperimentVariantHeader = "X-Experiment-Variant"
+
+// experiment is a parsed SCORING_EXPERIMENT
+type experiment struct {
+	Name     string
+	Variants []experimentVariant
+}
+
+type experimentVariant struct {
+	Name   string
+	Weight int
+}
+
+// ExperimentAssignment is the variant a request ran, as returned to clients
+type ExperimentAssignment struct {
+	Name       string `json:"name"`
+	Variant    string `json:"variant"`
+	Overridden bool   `json:"overridden,omitempty"` // forced by the QA override
+}
+
+// Function to parse an experiment definition, e.g. "exp:rules=50,similarity=50"
+func parseExperiment(value string) (experiment, error) {
+	name, variants, ok := strings.Cut(value, ":")
+	exp := experiment{Name: strings.TrimSpace(name)}
+	if !ok || exp.Name == "" {
+		return exp, fmt.Errorf("expected name:variant=weight,..., got '%s'", value)
+	}
+	for _, pair := range strings.Split(variants, ",") {
+		variant, weight, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || variant == "" || !IsValidScorer(variant) {
+			return exp, fmt.Errorf("variant '%s' must be a scorer with a weight, e.g. %s=50", pair, ScorerRules)
+		}
+		if variant == ScorerSimulation {
+			return exp, fmt.Errorf("the %s scorer is for tests and can't be a variant", ScorerSimulation)
+		}
+		w, err := strconv.Atoi(weight)
+		if err != nil || w < 0 {
+			return exp, fmt.Errorf("variant '%s' weight must be a whole number", variant)
+		}
+		exp.Variants = append(exp.Variants, experimentVariant{Name: variant, Weight: w})
+	}
+	return exp, nil
+}
+
+// Function to get the running experiment, ok false when there is none or its
+// definition is invalid
+func currentExperiment() (experiment, bool) {
+	value := config.Env("SCORING_EXPERIMENT", "")
+	if value == "" {
+		return experiment{}, false
+	}
+	exp, err := parseExperiment(value)
+	if err != nil {
+		fmt.Println("Ignoring SCORING_EXPERIMENT:", err)
+		return experiment{}, false
+	}
+	return exp, true
+}
+
+// Helper function to pick a listener's variant by hashing them into the
+// experiment's weights
+func (e experiment) variantFor(userID string) string {
+	total := 0
+	for _, variant := range e.Variants {
+		total += variant.Weight
+	}
+	if total == 0 {
+		return ""
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(e.Name + ":" + userID))
+	bucket := int(hash.Sum32() % uint32(total))
+	for _, variant := range e.Variants {
+		if bucket < variant.Weight {
+			return variant.Name
+		}
+		bucket -= variant.Weight
+	}
+	return ""
+}
+
+func (e experiment) hasVariant(name string) bool {
+	for _, variant := range e.Variants {
+		if variant.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper function to get the QA variant override. Over HTTP it only comes
+// from the header, and only callers allowed to override may send it.
+func requestVariantOverride(incoming api.IncomingRequest, inv api.Invocation) (string, error) {
+	if !inv.HTTP {
+		return incoming.ExperimentVariant, nil
+	}
+	if inv.ExperimentVariant == "" || canOverrideVariant(inv) {
+		return inv.ExperimentVariant, nil
+	}
+	return "", api.Forbidden("variant_override_not_allowed", "%s is not enabled for this caller", ExperimentVariantHeader)
+}
+
+// Helper function to decide whether this HTTP caller may force a variant
+func canOverrideVariant(inv api.Invocation) bool {
+	if config.Env("EXPERIMENT_OVERRIDE_ANY_CALLER", "false") == "true" {
+		return true
+	}
+	return inv.Role == api.RoleCurator || inv.Role == api.RoleQA
+}
+
+// Function to enroll a request in the running experiment, nil when it isn't
+func AssignExperiment(incoming api.IncomingRequest, inv api.Invocation) (*ExperimentAssignment, error) {
+	if incoming.Scorer != "" || len(incoming.RuleOverrides) > 0 || len(incoming.ScoringOverrides) > 0 {
+		return nil, nil
+	}
+	exp, ok := currentExperiment()
+	if !ok {
+		return nil, nil
+	}
+	override, err := requestVariantOverride(incoming, inv)
+	if err != nil {
+		return nil, err
+	}
+	if override != "" {
+		if !exp.hasVariant(override) {
+			return nil, api.BadRequest("unknown_variant", "experiment %s has no variant '%s'", exp.Name, override)
+		}
+		return &ExperimentAssignment{Name: exp.Name, Variant: override, Overridden: true}, nil
+	}
+	userID := api.RequestUserID(incoming, inv)
+	if userID == "" {
+		return nil, nil
+	}
+	if variant := exp.variantFor(userID); variant != "" {
+		return &ExperimentAssignment{Name: exp.Name, Variant: variant}, nil
+	}
+	return nil, nil
+}
+
+// Function to log a request's experiment metrics, dimensioned by experiment
+// and variant
+func EmitExperimentMetrics(genre string, assignment *ExperimentAssignment, matches int) {
+	if assignment == nil {
+		return
+	}
+	noMatches := 0
+	if matches == 0 {
+		noMatches = 1
+	}
+	config.EmitDimensionedMetrics(map[string]string{"Genre": genre, "Experiment": assignment.Name, "Variant": assignment.Variant}, []config.EmfMetric{
+		{Name: "ExperimentRequests", Unit: "Count"},
+		{Name: "ExperimentNoMatches", Unit: "Count"},
+	}, map[string]interface{}{
+		"ExperimentRequests":  1,
+		"ExperimentNoMatches": noMatches,
+	})
+}
@@ -0,0 +1,97 @@
+package scoring
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"time"
+
+	"April32025/internal/catalog"
+	"April32025/internal/config"
+)
+
+// Requests with "explore" set are epsilon-greedy: with probability
+// EXPLORATION_RATE (default 1, every such request) the last slot of the first
+// page goes to a random song that didn't make the page, matched or not, so
+// listeners discover songs outside their usual matches. Candidates must pass
+// every gate a match does: eligibility, which covers the listener's filters
+// and the songs' tiers and theme combinations, and duplicate removal, so the
+// pick is never an entry DropDuplicateSongs dropped or another version of a
+// song already on the page. The pick uses
+// the request's seed, like sortBy "random", so a given seed and catalog
+// always explore the same song; without one it changes every request.
+// Explored songs are flagged in the response. The first page's next cursor
+// then points at the match the explored song displaced, even when every
+// match would otherwise have fit on the page, so paging through the matches
+// still sees every one of them.
+const defaultExplorationRate = 1.0
+
+// Exploration is a request's exploration settings
+type Exploration struct {
+	Enabled bool
+	Seed    int64
+}
+
+func ExplorationRate() float64 {
+	rate, err := strconv.ParseFloat(config.Env("EXPLORATION_RATE", ""), 64)
+	if err != nil || rate < 0 || rate > 1 {
+		return defaultExplorationRate
+	}
+	return rate
+}
+
+// Helper function to list the songs exploration may pick: off the page and
+// through every gate
+func explorationCandidates(topRuleIDs []string, documents []catalog.CountryMusicDocument, p *UserSelections) []string {
+	onPage := make(map[string]bool, len(topRuleIDs))
+	for _, ruleID := range topRuleIDs {
+		onPage[ruleID] = true
+	}
+	pageSongs := make(map[string]bool, len(topRuleIDs))
+	for _, document := range documents {
+		if key := songKey(document); onPage[document.RuleID] && key != "" {
+			pageSongs[key] = true
+		}
+	}
+
+	var candidates []string
+	for _, document := range documents {
+		if _, excluded := p.Ineligible[document.RuleID]; excluded || onPage[document.RuleID] || p.Duplicates[document.RuleID] {
+			continue
+		}
+		if key := songKey(document); key != "" && pageSongs[key] {
+			continue
+		}
+		candidates = append(candidates, document.RuleID)
+	}
+	return candidates
+}
+
+// Function to swap the page's last slot for a random eligible song, returning
+// the new page and the explored song, "" when nothing was swapped
+func ExploreRuleIDs(topRuleIDs []string, documents []catalog.CountryMusicDocument, p *UserSelections, explore Exploration, rate float64) ([]string, string) {
+	if !explore.Enabled || len(topRuleIDs) == 0 {
+		return topRuleIDs, ""
+	}
+	seed := explore.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(seed))
+	if rng.Float64() >= rate {
+		return topRuleIDs, ""
+	}
+
+	candidates := explorationCandidates(topRuleIDs, documents, p)
+	if len(candidates) == 0 {
+		return topRuleIDs, ""
+	}
+	// Catalog order depends on the store, so sort for a reproducible pick
+	sort.Strings(candidates)
+	explored := candidates[rng.Intn(len(candidates))]
+	fmt.Printf("Exploring song %s in place of %s\n", explored, topRuleIDs[len(topRuleIDs)-1])
+
+	explorePage := append([]string{}, topRuleIDs[:len(topRuleIDs)-1]...)
+	return append(explorePage, explored), explored
+}
@@ -0,0 +1,128 @@
+package scoring
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	"April32025/internal/config"
+)
+
+// So the same few crowd-pleasers don't top everyone's results, COUNTERS_TABLE
+// also counts how often each song is served to anyone in its genre, in
+// windows of exposureWindowDays (SCORING_EXPOSURE_WINDOW_DAYS, default 7).
+// Each window is its own segment, e.g. "exposure#country#2025-10-13", so the
+// counts start over every window and last week's favourites get their turn
+// again. Every request in a genre writes to its window, so the segment is
+// split over exposureShards partitions by song ("...#2025-10-13#5") rather
+// than making one hot key. A song served more than exposureThreshold times
+// (SCORING_EXPOSURE_THRESHOLD, default 3) the average of the window's served
+// songs loses up to exposurePenalty points (SCORING_EXPOSURE_PENALTY,
+// default 0 for off, like collaborativeWeight):
+//
+//	penalty = exposurePenalty * (1 - threshold * average / served)
+//
+// nothing at the threshold, rising toward the full penalty the more
+// overexposed the song is. Like the repeat penalty it is mild on purpose,
+// enough to rotate songs of about the same score, not to bury a great match.
+// Nothing is counted while the penalty is off. The window's counts are read
+// through the segment stats cache, see collaborative.go.
+const (
+	defaultExposurePenalty    = 0
+	defaultExposureThreshold  = 3
+	defaultExposureWindowDays = 7
+
+	exposureSegmentPrefix = "exposure#"
+	exposureShards        = 8
+)
+
+// Helper function to name the exposure segment of a genre's current window
+func exposureSegment(c config.Catalog, windowDays int, now time.Time) string {
+	if windowDays <= 0 {
+		return ""
+	}
+	days := now.UTC().Unix() / (24 * 60 * 60)
+	start := time.Unix((days-days%int64(windowDays))*24*60*60, 0).UTC()
+	return exposureSegmentPrefix + c.Genre + "#" + start.Format("2006-01-02")
+}
+
+// Helper function to name the shard of an exposure segment a song is counted in
+func exposureShard(segment string, songID string) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(songID))
+	return segment + "#" + strconv.Itoa(int(hash.Sum32()%exposureShards))
+}
+
+// Helper function to list every shard of an exposure segment
+func exposureShardSegments(segment string) []string {
+	shards := make([]string, exposureShards)
+	for i := range shards {
+		shards[i] = segment + "#" + strconv.Itoa(i)
+	}
+	return shards
+}
+
+// Function to count the songs on a served page toward their genre's exposure
+func RecordExposure(ctx context.Context, svc *dynamodb.Client, c config.Catalog, p *UserSelections, songIDs []string, now time.Time) {
+	scoring := p.Config()
+	segment := exposureSegment(c, scoring.ExposureWindowDays, now)
+	if scoring.ExposurePenalty == 0 || segment == "" {
+		return
+	}
+	byShard := make(map[string][]string)
+	for _, songID := range songIDs {
+		shard := exposureShard(segment, songID)
+		byShard[shard] = append(byShard[shard], songID)
+	}
+	for shard, shardSongIDs := range byShard {
+		IncrementSegmentCounters(ctx, svc, shard, shardSongIDs, "recommended")
+	}
+}
+
+// Helper function to get the points a song served served times loses when
+// the window's served songs average average serves
+func exposurePenalty(scoring Config, served int, average float64) int {
+	limit := scoring.ExposureThreshold * average
+	if average <= 0 || float64(served) <= limit {
+		return 0
+	}
+	return int(math.Round(scoring.ExposurePenalty * (1 - limit/float64(served))))
+}
+
+// Function to penalize the scored songs served far more than the rest of
+// their genre this window. Failures are logged and leave the scores alone.
+func ApplyExposureDecay(ctx context.Context, svc *dynamodb.Client, c config.Catalog, p *UserSelections, now time.Time) {
+	scoring := p.Config()
+	segment := exposureSegment(c, scoring.ExposureWindowDays, now)
+	if scoring.ExposurePenalty == 0 || config.Storage().CountersTable == "" || segment == "" || len(p.Recommendations) == 0 {
+		return
+	}
+	stats, err := cachedSegmentStats(ctx, svc, segment, exposureShardSegments(segment)...)
+	if err != nil {
+		fmt.Println("Failed to load exposure counts:", err)
+		return
+	}
+	total := 0
+	for _, songStats := range stats {
+		total += songStats.Recommended
+	}
+	if total == 0 {
+		return
+	}
+	average := float64(total) / float64(len(stats))
+
+	penalized := 0
+	for songID, score := range p.Recommendations {
+		if penalty := exposurePenalty(scoring, stats[songID].Recommended, average); penalty != 0 {
+			p.Recommendations[songID] = score - penalty
+			p.breakdown(songID).Exposure = -penalty
+			penalized++
+		}
+	}
+	fmt.Printf("Exposure decay from %s (average %.1f serves) penalized %d songs\n", segment, average, penalized)
+}
@@ -0,0 +1,121 @@
+package scoring
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"April32025/internal/catalog"
+	"April32025/internal/config"
+)
+
+// The served history (see handler/served.go) also keeps repeat visits fresh:
+// songs a listener was served in the last repeatWindowDays
+// (SCORING_REPEAT_WINDOW_DAYS, default 7) lose up to repeatPenalty points
+// (SCORING_REPEAT_PENALTY, default 5, 0 for off), the full penalty when just
+// served and fading linearly to nothing at the end of the window. Songs served
+// in the last REPEAT_GRACE_MINUTES (default 30) count as the current visit and
+// aren't penalized, so paging through a result doesn't reshuffle it.
+const (
+	defaultRepeatPenalty      = 5
+	defaultRepeatWindowDays   = 7
+	defaultRepeatGraceMinutes = 30
+)
+
+func repeatGracePeriod() time.Duration {
+	minutes, err := strconv.Atoi(config.Env("REPEAT_GRACE_MINUTES", strconv.Itoa(defaultRepeatGraceMinutes)))
+	if err != nil || minutes < 0 {
+		minutes = defaultRepeatGraceMinutes
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// Function to find when each song was last served to a listener between two
+// times
+func loadLastServed(ctx context.Context, svc *dynamodb.Client, userID string, from time.Time, to time.Time) (map[string]time.Time, error) {
+	paginator := dynamodb.NewQueryPaginator(svc, &dynamodb.QueryInput{
+		TableName:              aws.String(config.Storage().HistoryTable),
+		KeyConditionExpression: aws.String("#userId = :userId AND #servedAt BETWEEN :from AND :to"),
+		ProjectionExpression:   aws.String("#servedAt, #ruleIds"),
+		ExpressionAttributeNames: map[string]string{
+			"#userId":   "userId",
+			"#servedAt": "servedAt",
+			"#ruleIds":  "ruleIds",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":userId": &types.AttributeValueMemberS{Value: userID},
+			":from":   &types.AttributeValueMemberN{Value: strconv.FormatInt(from.UnixMilli(), 10)},
+			":to":     &types.AttributeValueMemberN{Value: strconv.FormatInt(to.UnixMilli(), 10)},
+		},
+	})
+	lastServed := make(map[string]time.Time)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			servedMs, err := strconv.ParseInt(catalog.GetNumberValue(item["servedAt"]), 10, 64)
+			if err != nil {
+				continue
+			}
+			servedAt := time.UnixMilli(servedMs)
+			ruleIDs, _ := item["ruleIds"].(*types.AttributeValueMemberL)
+			if ruleIDs == nil {
+				continue
+			}
+			for _, ruleID := range ruleIDs.Value {
+				songID := catalog.GetStringValue(ruleID)
+				if last, ok := lastServed[songID]; !ok || servedAt.After(last) {
+					lastServed[songID] = servedAt
+				}
+			}
+		}
+	}
+	return lastServed, nil
+}
+
+// Helper function to get the points a song served at servedAt loses
+func repeatPenalty(scoring Config, servedAt time.Time, now time.Time) int {
+	window := time.Duration(scoring.RepeatWindowDays) * 24 * time.Hour
+	age := now.Sub(servedAt)
+	if window <= 0 || age >= window {
+		return 0
+	}
+	return int(math.Round(scoring.RepeatPenalty * (1 - float64(age)/float64(window))))
+}
+
+// Function to penalize the scored songs a listener was recently served.
+// Failures are logged and leave the scores alone.
+func ApplyRepeatPenalty(ctx context.Context, svc *dynamodb.Client, p *UserSelections, userID string, now time.Time) {
+	scoring := p.Config()
+	if userID == "" || config.Storage().HistoryTable == "" || scoring.RepeatPenalty == 0 || scoring.RepeatWindowDays <= 0 || len(p.Recommendations) == 0 {
+		return
+	}
+	from := now.Add(-time.Duration(scoring.RepeatWindowDays) * 24 * time.Hour)
+	lastServed, err := loadLastServed(ctx, svc, userID, from, now.Add(-repeatGracePeriod()))
+	if err != nil {
+		fmt.Println("Failed to load recommendation history:", err)
+		return
+	}
+
+	penalized := 0
+	for songID, score := range p.Recommendations {
+		servedAt, ok := lastServed[songID]
+		if !ok {
+			continue
+		}
+		if penalty := repeatPenalty(scoring, servedAt, now); penalty != 0 {
+			p.Recommendations[songID] = score - penalty
+			p.breakdown(songID).RepeatPenalty = -penalty
+			penalized++
+		}
+	}
+	fmt.Printf("Repeat penalty applied to %d recently served songs for user %s\n", penalized, userID)
+}
@@ -0,0 +1,70 @@
+package scoring
+
+import (
+	"fmt"
+	"math"
+
+	"April32025/internal/api"
+	"April32025/internal/catalog"
+)
+
+// Songs carry an "intensity" from 1 (sad and slow) to 5 (rowdy), 0 when not
+// rated, so requests with the same themes can still tell a slow heartbreak
+// ballad from a stomping one. A request's "intensity" range, e.g.
+// {"min": 4, "max": 5}, scores each rated song by how close it is:
+//
+//	inside the range       +intensityWeight
+//	1 step outside         +intensityWeight/2
+//	2 steps outside        0
+//	further                down to -intensityWeight at 4 steps
+//
+// intensityWeight is SCORING_INTENSITY_WEIGHT or the scoring config item's
+// intensityWeight, default 5. Unrated songs and requests without a range get
+// no intensity points, so the range steers the ranking without excluding
+// anything.
+const defaultIntensityWeight = 5
+
+// Function to check a request's intensity range
+func ValidateIntensity(intensity *api.IntensityRange) error {
+	if intensity == nil {
+		return nil
+	}
+	if intensity.Min < catalog.MinIntensity || intensity.Max > catalog.MaxIntensity || intensity.Min > intensity.Max {
+		return api.BadRequest("invalid_intensity", "intensity needs a min and max between %d and %d, min no more than max", catalog.MinIntensity, catalog.MaxIntensity)
+	}
+	return nil
+}
+
+// Helper function to get the points a song of the given intensity is worth
+// for a range
+func intensityPoints(weight float64, want api.IntensityRange, intensity int) int {
+	distance := 0
+	switch {
+	case intensity < want.Min:
+		distance = want.Min - intensity
+	case intensity > want.Max:
+		distance = intensity - want.Max
+	}
+	return int(math.Round(weight * (1 - float64(distance)/2)))
+}
+
+// Function to score every scored, rated song by its closeness to the
+// requested intensity
+func ApplyIntensityProximity(p *UserSelections, documents []catalog.CountryMusicDocument) {
+	weight := p.Config().IntensityWeight
+	if p.Intensity == nil || weight == 0 {
+		return
+	}
+	scored := 0
+	for _, document := range documents {
+		score, ok := p.Recommendations[document.RuleID]
+		if !ok || document.Intensity == 0 {
+			continue
+		}
+		points := intensityPoints(weight, *p.Intensity, document.Intensity)
+		p.Recommendations[document.RuleID] = score + points
+		p.breakdown(document.RuleID).Intensity = points
+		scored++
+	}
+	fmt.Printf("Intensity %d-%d scored %d songs\n", p.Intensity.Min, p.Intensity.Max, scored)
+}
@@ -0,0 +1,49 @@
+package scoring
+
+// Each recommendation is labeled with a match tier, so clients can show
+// "Perfect matches" and "Worth a listen" sections rather than a flat list.
+// A song's tier depends both on its confidence (see scoring.go), so a
+// request nothing fits well doesn't get perfect matches, and on its score
+// relative to the request's best match, so the tiers follow the spread of
+// that request's scores:
+//
+//	perfect - confidence at least 80 and within 85% of the best score
+//	good    - confidence at least 50 and within 60% of the best score
+//	stretch - everything else, explored songs included
+//
+// The best score is taken over every match, not just the page, so a song
+// keeps its tier whichever page it is on.
+const (
+	matchTierPerfect = "perfect"
+	matchTierGood    = "good"
+	MatchTierStretch = "stretch"
+
+	perfectMinConfidence = 80
+	perfectMinRelative   = 0.85
+	goodMinConfidence    = 50
+	goodMinRelative      = 0.6
+)
+
+// Helper function to get the highest score among the matches, 0 for none
+func BestScore(recommendations map[string]int) int {
+	best := 0
+	for _, score := range recommendations {
+		best = max(best, score)
+	}
+	return best
+}
+
+// Function to pick a recommendation's match tier
+func MatchTier(score int, confidence int, best int) string {
+	if best <= 0 || score <= 0 {
+		return MatchTierStretch
+	}
+	relative := float64(score) / float64(best)
+	switch {
+	case confidence >= perfectMinConfidence && relative >= perfectMinRelative:
+		return matchTierPerfect
+	case confidence >= goodMinConfidence && relative >= goodMinRelative:
+		return matchTierGood
+	}
+	return MatchTierStretch
+}
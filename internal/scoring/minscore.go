@@ -0,0 +1,26 @@
+package scoring
+
+import "fmt"
+
+// Songs scoring below minScore (SCORING_MIN_SCORE or the scoring config
+// item's minScore, default 1) are never recommended, so a song whose
+// unselected themes cost more than its matches earned doesn't pad out a page.
+// See respond/nomatches.go for how an empty result is explained.
+const defaultMinScore = 1
+
+// Function to drop the songs scoring below minScore, returning their scores.
+// Their contributions are kept for explainNoMatches.
+func (p *UserSelections) DropBelowMinScore() map[string]int {
+	minScore := p.Config().MinScore
+	dropped := make(map[string]int)
+	for songId, score := range p.Recommendations {
+		if score < minScore {
+			dropped[songId] = score
+			delete(p.Recommendations, songId)
+		}
+	}
+	if len(dropped) > 0 {
+		fmt.Printf("Dropped %d songs scoring below %d\n", len(dropped), minScore)
+	}
+	return dropped
+}
@@ -0,0 +1,228 @@
+package scoring
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"April32025/internal/catalog"
+	"April32025/internal/config"
+)
+
+// A learned ranker can replace the rule-engine score as the final ranking
+// stage. It is a linear model over the parts of the score breakdown (see
+// breakdown.go), trained offline on what listeners accepted: the history
+// table records each served song's features next to the model version that
+// ranked it, and the counters table (see collaborative.go) what was accepted.
+// A model looks like
+//
+//	{ "version": "2025-10-01", "bias": 0,
+//	  "weights": { "themePoints": 1.2, "penalty": 0.8, "popularity": 2, ... } }
+//
+// and scores a song bias + sum(weight * feature), rounded. Features without a
+// weight count for nothing, so a model with every weight 1 reproduces the
+// rule-engine score. RANKER_MODEL selects where it is kept:
+//
+//	"" (default) - no learned ranker
+//	s3           - a JSON object at RANKER_BUCKET/RANKER_KEY (default
+//	               "ranker/model.json")
+//	config       - the "model" attribute, the same JSON as a string, of the
+//	               "Ranker" item of CONFIG_TABLE
+//
+// The model is loaded once, at cold start, and kept for the life of the
+// container; deploy or wait out a recycle to pick up a new one. It re-scores
+// songs before minScore applies, so a song the model scores low is dropped
+// like any other. A model that fails to load is logged and the scores are
+// left as the rules made them; the load is retried after
+// RANKER_RETRY_SECONDS (default 60), not on every request.
+const (
+	rankerModelS3     = "s3"
+	rankerModelConfig = "config"
+
+	defaultRankerKey          = "ranker/model.json"
+	rankerConfigID            = "Ranker"
+	defaultRankerRetrySeconds = 60
+)
+
+// rankerFeatureNames are the features a model can weigh, in breakdown order
+var rankerFeatureNames = []string{
+	"themePoints", "penalty", "normalization", "rules", "popularity",
+	"recency", "intensity", "affinity", "collaborative", "repeatPenalty", "exposure", "seasonal",
+}
+
+// rankerModel is a trained linear ranker
+type rankerModel struct {
+	Version string             `json:"version"`
+	Bias    float64            `json:"bias"`
+	Weights map[string]float64 `json:"weights"`
+}
+
+var loadedRanker struct {
+	sync.Mutex
+	model    *rankerModel
+	loaded   bool
+	failedAt time.Time
+}
+
+// Function to parse and check a model, rejecting weights for unknown features
+func parseRankerModel(body []byte) (*rankerModel, error) {
+	var model rankerModel
+	if err := json.Unmarshal(body, &model); err != nil {
+		return nil, fmt.Errorf("ranker model is not valid JSON: %w", err)
+	}
+	known := make(map[string]bool, len(rankerFeatureNames))
+	for _, name := range rankerFeatureNames {
+		known[name] = true
+	}
+	for _, name := range slices.Sorted(maps.Keys(model.Weights)) {
+		if !known[name] {
+			return nil, fmt.Errorf("ranker model weighs unknown feature '%s'", name)
+		}
+	}
+	if model.Version == "" {
+		return nil, fmt.Errorf("ranker model has no version")
+	}
+	return &model, nil
+}
+
+// Function to read the configured model's JSON
+func readRankerModel(ctx context.Context, cfg aws.Config, svc *dynamodb.Client) ([]byte, error) {
+	switch source := config.Env("RANKER_MODEL", ""); source {
+	case rankerModelS3:
+		bucket, key := config.Env("RANKER_BUCKET", ""), config.Env("RANKER_KEY", defaultRankerKey)
+		if bucket == "" {
+			return nil, fmt.Errorf("RANKER_BUCKET is required when RANKER_MODEL=s3")
+		}
+		resp, err := config.NewS3Client(cfg).GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to download ranker model s3://%s/%s: %w", bucket, key, err)
+		}
+		defer resp.Body.Close()
+		return io.ReadAll(resp.Body)
+	case rankerModelConfig:
+		table := config.Storage().ConfigTable
+		if table == "" {
+			return nil, fmt.Errorf("CONFIG_TABLE is required when RANKER_MODEL=config")
+		}
+		resp, err := svc.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName: aws.String(table),
+			Key: map[string]types.AttributeValue{
+				"configId": &types.AttributeValueMemberS{Value: rankerConfigID},
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to load ranker model from %s: %w", table, err)
+		}
+		model := catalog.GetStringValue(resp.Item["model"])
+		if model == "" {
+			return nil, fmt.Errorf("%s has no %s item with a model", table, rankerConfigID)
+		}
+		return []byte(model), nil
+	default:
+		return nil, fmt.Errorf("unknown RANKER_MODEL '%s'", source)
+	}
+}
+
+func rankerRetryInterval() time.Duration {
+	seconds, err := strconv.Atoi(config.Env("RANKER_RETRY_SECONDS", strconv.Itoa(defaultRankerRetrySeconds)))
+	if err != nil || seconds < 0 {
+		seconds = defaultRankerRetrySeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// Function to get the learned ranker, loading it if the cold start load
+// didn't; nil when RANKER_MODEL is unset or the model failed to load
+func LoadRankerModel(ctx context.Context, cfg aws.Config, svc *dynamodb.Client) *rankerModel {
+	if config.Env("RANKER_MODEL", "") == "" {
+		return nil
+	}
+	loadedRanker.Lock()
+	defer loadedRanker.Unlock()
+	if loadedRanker.loaded {
+		return loadedRanker.model
+	}
+	if !loadedRanker.failedAt.IsZero() && time.Since(loadedRanker.failedAt) < rankerRetryInterval() {
+		return nil
+	}
+
+	model, err := fetchRankerModel(ctx, cfg, svc)
+	if err != nil {
+		fmt.Println("Failed to load ranker model, using rule-engine scores:", err)
+		loadedRanker.failedAt = time.Now()
+		return nil
+	}
+	fmt.Printf("Loaded ranker model %s with weights %v\n", model.Version, model.Weights)
+	loadedRanker.model = model
+	loadedRanker.loaded = true
+	return model
+}
+
+// Function to read and parse the configured model
+func fetchRankerModel(ctx context.Context, cfg aws.Config, svc *dynamodb.Client) (*rankerModel, error) {
+	body, err := readRankerModel(ctx, cfg, svc)
+	if err != nil {
+		return nil, err
+	}
+	return parseRankerModel(body)
+}
+
+// Function to get a song's ranker features, the parts of its score before
+// the ranker
+func RankerFeatures(b *ScoreBreakdown) map[string]float64 {
+	if b == nil {
+		return nil
+	}
+	return map[string]float64{
+		"themePoints":   float64(b.ThemePoints),
+		"penalty":       float64(b.Penalty),
+		"normalization": float64(b.Normalization),
+		"rules":         float64(b.Rules),
+		"popularity":    float64(b.Popularity),
+		"recency":       float64(b.Recency),
+		"intensity":     float64(b.Intensity),
+		"affinity":      float64(b.Affinity),
+		"collaborative": float64(b.Collaborative),
+		"repeatPenalty": float64(b.RepeatPenalty),
+		"exposure":      float64(b.Exposure),
+		"seasonal":      float64(b.Seasonal),
+	}
+}
+
+// Function to score a song's features
+func (m *rankerModel) score(features map[string]float64) int {
+	score := m.Bias
+	for name, weight := range m.Weights {
+		score += weight * features[name]
+	}
+	return int(math.Round(score))
+}
+
+// Function to replace every scored song's score with the model's
+func ApplyRanker(p *UserSelections, model *rankerModel) {
+	if model == nil || p.Scorer == ScorerSimulation || len(p.Recommendations) == 0 {
+		return
+	}
+	for songID, score := range p.Recommendations {
+		ranked := model.score(RankerFeatures(p.FinalBreakdown(songID, 0, false)))
+		p.Recommendations[songID] = ranked
+		p.breakdown(songID).Ranker = ranked - score
+	}
+	p.RankerVersion = model.Version
+	fmt.Printf("Ranker model %s re-scored %d songs\n", model.Version, len(p.Recommendations))
+}
@@ -0,0 +1,114 @@
+package scoring
+
+import (
+	"fmt"
+
+	"April32025/internal/catalog"
+)
+
+// Ranking purely by score tends to fill a page with one artist or one decade.
+// With a rerank artist or era weight (SCORING_RERANK_ARTIST_WEIGHT and
+// SCORING_RERANK_ERA_WEIGHT or the scoring config item's rerankArtistWeight
+// and rerankEraWeight, both default 0 for off) the scored songs are re-ranked
+// by greedy maximal marginal relevance: each position goes to the song with
+// the best
+//
+//	relevance - artistWeight * sameArtist - eraWeight * sameEra
+//
+// where relevance is the song's score scaled 0-1 between the lowest and
+// highest scores, sameArtist is 1 when a song by its artist is already ranked
+// above it, and sameEra is how close its release year is to the nearest one
+// ranked above it, 1 for the same year falling to 0 at rerankEraYears apart.
+// Songs without an artist or year never count as repeats. The weights are
+// relative to relevance, so 0.2 lets a song of a new artist overtake one of
+// a repeated artist scoring up to a fifth of the score range more. Each pick
+// only depends on the ones before it, so pages stay consistent whatever the
+// page size. The artist cap in diversity.go still applies afterwards.
+const rerankEraYears = 10
+
+// Helper function to map each song to its release year, for songs with one
+func SongYears(documents []catalog.CountryMusicDocument) map[string]int {
+	years := make(map[string]int, len(documents))
+	for _, document := range documents {
+		if document.Year > 0 {
+			years[document.RuleID] = document.Year
+		}
+	}
+	return years
+}
+
+// Helper function to rate 0-1 how close two release years are
+func eraSimilarity(a int, b int) float64 {
+	gap := a - b
+	if gap < 0 {
+		gap = -gap
+	}
+	return max(0, 1-float64(gap)/rerankEraYears)
+}
+
+// Function to re-rank the first n songs of a score ranking for relevance,
+// artist diversity and era spread, leaving the rest in score order
+func RerankRanking(rankedRuleIDs []string, scores map[string]int, artists map[string]string, years map[string]int, scoring Config, n int) []string {
+	if (scoring.RerankArtistWeight == 0 && scoring.RerankEraWeight == 0) || len(rankedRuleIDs) < 2 {
+		return rankedRuleIDs
+	}
+	n = min(n, len(rankedRuleIDs))
+
+	low, high := scores[rankedRuleIDs[len(rankedRuleIDs)-1]], scores[rankedRuleIDs[0]]
+	relevance := func(ruleID string) float64 {
+		if high == low {
+			return 1
+		}
+		return float64(scores[ruleID]-low) / float64(high-low)
+	}
+
+	candidates := append([]string{}, rankedRuleIDs...)
+	eraRepeat := make(map[string]float64, len(candidates))
+	artistRanked := make(map[string]bool)
+	reranked := make([]string, 0, len(rankedRuleIDs))
+	for len(reranked) < n {
+		// Candidates stay in score order, so ties go to the higher-scored song
+		best, bestValue := 0, 0.0
+		for i, ruleID := range candidates {
+			value := relevance(ruleID) - scoring.RerankEraWeight*eraRepeat[ruleID]
+			if artist, ok := artists[ruleID]; ok && artistRanked[artist] {
+				value -= scoring.RerankArtistWeight
+			}
+			if i == 0 || value > bestValue {
+				best, bestValue = i, value
+			}
+		}
+
+		picked := candidates[best]
+		candidates = append(candidates[:best], candidates[best+1:]...)
+		reranked = append(reranked, picked)
+		if artist, ok := artists[picked]; ok {
+			artistRanked[artist] = true
+		}
+		if year, ok := years[picked]; ok {
+			for _, ruleID := range candidates {
+				if other, ok := years[ruleID]; ok {
+					eraRepeat[ruleID] = max(eraRepeat[ruleID], eraSimilarity(year, other))
+				}
+			}
+		}
+	}
+	fmt.Printf("Re-ranked top %d of %d songs\n", n, len(rankedRuleIDs))
+	return append(reranked, candidates...)
+}
+
+// Helper function to get how many places the re-ranker moved each song up,
+// negative for down, leaving out songs it didn't move
+func RerankShifts(rankedRuleIDs []string, reranked []string) map[string]int {
+	positions := make(map[string]int, len(rankedRuleIDs))
+	for i, ruleID := range rankedRuleIDs {
+		positions[ruleID] = i
+	}
+	shifts := make(map[string]int)
+	for i, ruleID := range reranked {
+		if shift := positions[ruleID] - i; shift != 0 {
+			shifts[ruleID] = shift
+		}
+	}
+	return shifts
+}
@@ -0,0 +1,442 @@
+// Package scoring holds a request's selections and everything that adjusts
+// their scores after the rules ran: the scoring settings, the alternative
+// scorers, history, exposure, affinity, re-ranking and exploration.
+package scoring
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"April32025/internal/api"
+	"April32025/internal/catalog"
+	"April32025/internal/config"
+)
+
+// A song's score is the points of its matched themes less a penalty per
+// unmatched theme:
+//
+//	score = sum(matchWeight * importance/3 * themeWeight) - penaltyWeight * unmatched
+//
+// The weights and the normalization are configured by, lowest precedence
+// first: the defaults below, SCORING_MATCH_WEIGHT, SCORING_PENALTY_WEIGHT and
+// SCORING_NORMALIZATION, then the "Scoring" item of CONFIG_TABLE (key
+// "configId") with matchWeight, penaltyWeight and normalization attributes,
+// which can be changed without a deploy. The item is re-read every
+// SCORING_CACHE_SECONDS (default 60). Curators can override any of the
+// item's settings for one request, see ApplyScoringOverrides.
+//
+// Normalizations:
+//
+//	none (default) - raw points, so songs with more themes can score higher
+//	percent        - points as a percentage of what the song could score with
+//	                 every theme matched at default importance
+//
+// Once the rules have run, matched songs get a popularity boost of
+// popularityWeight * popularity/100 points (SCORING_POPULARITY_WEIGHT, default
+// 0 for none), so a widely-loved song edges out an obscure one with the same
+// theme matches.
+//
+// Requests with preferNew or preferClassics also get a recency boost of up to
+// recencyWeight points (SCORING_RECENCY_WEIGHT, default 5), decaying with a
+// song's age by a half-life of recencyHalfLife years (SCORING_RECENCY_HALF_LIFE,
+// default 10): preferNew gives this year's songs the full boost and a
+// 10-year-old song half of it, preferClassics the other way round. Songs
+// without a year get no recency boost.
+//
+// collaborativeWeight (SCORING_COLLABORATIVE_WEIGHT) turns on the
+// collaborative re-ranking in collaborative.go, and minScore
+// (SCORING_MIN_SCORE) sets the score songs need to be recommended, see
+// minscore.go. repeatPenalty and repeatWindowDays tune the penalty for
+// songs a listener was recently served, see history.go, and exposurePenalty,
+// exposureThreshold and exposureWindowDays the one for songs served to
+// everyone, see exposure.go. rerankArtistWeight and rerankEraWeight turn on
+// the diversity re-ranking in rerank.go. intensityWeight scores songs by
+// the requested intensity, see intensity.go, and affinityWeight by the
+// listener's favorite artists, see affinity.go.
+//
+// Each recommendation also carries a 0-100 confidence: its score as a
+// percentage of the ideal score for the request, what a song with exactly
+// the selected themes would get, capped at 100. Raw scores grow with the
+// number of themes selected; confidence doesn't, so it can be compared
+// across requests.
+const (
+	defaultMatchWeight   = 10
+	defaultPenaltyWeight = 1
+
+	normalizationNone    = "none"
+	normalizationPercent = "percent"
+
+	defaultRecencyWeight   = 5
+	defaultRecencyHalfLife = 10
+
+	eraNew      = "new"
+	eraClassics = "classics"
+
+	scoringConfigID            = "Scoring"
+	defaultScoringCacheSeconds = 60
+)
+
+// Config holds the scoring formula's settings
+type Config struct {
+	MatchWeight      int
+	PenaltyWeight    int
+	Normalization    string
+	PopularityWeight float64
+	RecencyWeight    float64
+	RecencyHalfLife  float64 // years
+
+	CollaborativeWeight float64
+	MinScore            int
+	RepeatPenalty       float64
+	RepeatWindowDays    int
+	ExposurePenalty     float64
+	ExposureThreshold   float64
+	ExposureWindowDays  int
+
+	RerankArtistWeight float64
+	RerankEraWeight    float64
+	IntensityWeight    float64
+	AffinityWeight     float64
+}
+
+// scoringAttributes are the settings a config item or scoringOverrides can set
+var scoringAttributes = map[string]bool{
+	"matchWeight": true, "penaltyWeight": true, "normalization": true,
+	"popularityWeight": true, "recencyWeight": true, "recencyHalfLife": true,
+	"collaborativeWeight": true, "minScore": true,
+	"repeatPenalty": true, "repeatWindowDays": true,
+	"exposurePenalty": true, "exposureThreshold": true, "exposureWindowDays": true,
+	"rerankArtistWeight": true, "rerankEraWeight": true,
+	"intensityWeight": true, "affinityWeight": true,
+}
+
+var scoringCache = struct {
+	sync.Mutex
+	config   Config
+	loadedAt time.Time
+}{}
+
+// Function to read the scoring settings from the environment
+func scoringFromEnv() Config {
+	settings := Config{
+		MatchWeight:      defaultMatchWeight,
+		PenaltyWeight:    defaultPenaltyWeight,
+		Normalization:    normalizationNone,
+		RecencyWeight:    defaultRecencyWeight,
+		RecencyHalfLife:  defaultRecencyHalfLife,
+		MinScore:         defaultMinScore,
+		RepeatPenalty:    defaultRepeatPenalty,
+		RepeatWindowDays: defaultRepeatWindowDays,
+
+		ExposurePenalty:    defaultExposurePenalty,
+		ExposureThreshold:  defaultExposureThreshold,
+		ExposureWindowDays: defaultExposureWindowDays,
+
+		IntensityWeight: defaultIntensityWeight,
+		AffinityWeight:  defaultAffinityWeight,
+	}
+	if weight, err := strconv.Atoi(config.Env("SCORING_MATCH_WEIGHT", "")); err == nil && weight > 0 {
+		settings.MatchWeight = weight
+	}
+	if weight, err := strconv.Atoi(config.Env("SCORING_PENALTY_WEIGHT", "")); err == nil && weight >= 0 {
+		settings.PenaltyWeight = weight
+	}
+	if normalization := config.Env("SCORING_NORMALIZATION", ""); validNormalization(normalization) {
+		settings.Normalization = normalization
+	}
+	if weight, err := strconv.ParseFloat(config.Env("SCORING_POPULARITY_WEIGHT", ""), 64); err == nil && weight >= 0 {
+		settings.PopularityWeight = weight
+	}
+	if weight, err := strconv.ParseFloat(config.Env("SCORING_RECENCY_WEIGHT", ""), 64); err == nil && weight >= 0 {
+		settings.RecencyWeight = weight
+	}
+	if years, err := strconv.ParseFloat(config.Env("SCORING_RECENCY_HALF_LIFE", ""), 64); err == nil && years > 0 {
+		settings.RecencyHalfLife = years
+	}
+	if weight, err := strconv.ParseFloat(config.Env("SCORING_COLLABORATIVE_WEIGHT", ""), 64); err == nil && weight >= 0 {
+		settings.CollaborativeWeight = weight
+	}
+	if score, err := strconv.Atoi(config.Env("SCORING_MIN_SCORE", "")); err == nil {
+		settings.MinScore = score
+	}
+	if penalty, err := strconv.ParseFloat(config.Env("SCORING_REPEAT_PENALTY", ""), 64); err == nil && penalty >= 0 {
+		settings.RepeatPenalty = penalty
+	}
+	if days, err := strconv.Atoi(config.Env("SCORING_REPEAT_WINDOW_DAYS", "")); err == nil && days >= 0 {
+		settings.RepeatWindowDays = days
+	}
+	if penalty, err := strconv.ParseFloat(config.Env("SCORING_EXPOSURE_PENALTY", ""), 64); err == nil && penalty >= 0 {
+		settings.ExposurePenalty = penalty
+	}
+	if threshold, err := strconv.ParseFloat(config.Env("SCORING_EXPOSURE_THRESHOLD", ""), 64); err == nil && threshold >= 1 {
+		settings.ExposureThreshold = threshold
+	}
+	if days, err := strconv.Atoi(config.Env("SCORING_EXPOSURE_WINDOW_DAYS", "")); err == nil && days > 0 {
+		settings.ExposureWindowDays = days
+	}
+	if weight, err := strconv.ParseFloat(config.Env("SCORING_RERANK_ARTIST_WEIGHT", ""), 64); err == nil && weight >= 0 {
+		settings.RerankArtistWeight = weight
+	}
+	if weight, err := strconv.ParseFloat(config.Env("SCORING_RERANK_ERA_WEIGHT", ""), 64); err == nil && weight >= 0 {
+		settings.RerankEraWeight = weight
+	}
+	if weight, err := strconv.ParseFloat(config.Env("SCORING_INTENSITY_WEIGHT", ""), 64); err == nil && weight >= 0 {
+		settings.IntensityWeight = weight
+	}
+	if weight, err := strconv.ParseFloat(config.Env("SCORING_AFFINITY_WEIGHT", ""), 64); err == nil && weight >= 0 {
+		settings.AffinityWeight = weight
+	}
+	return settings
+}
+
+func validNormalization(normalization string) bool {
+	return normalization == normalizationNone || normalization == normalizationPercent
+}
+
+func ScoringCacheTTL() time.Duration {
+	seconds, err := strconv.Atoi(config.Env("SCORING_CACHE_SECONDS", strconv.Itoa(defaultScoringCacheSeconds)))
+	if err != nil || seconds < 0 {
+		seconds = defaultScoringCacheSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// Function to get the scoring settings, applying the config item over the
+// environment when CONFIG_TABLE is set. Lookup failures fall back to the
+// environment, so scoring never fails a request.
+func LoadScoringConfig(ctx context.Context, svc *dynamodb.Client) Config {
+	settings := scoringFromEnv()
+	table := config.Storage().ConfigTable
+	if table == "" {
+		return settings
+	}
+
+	scoringCache.Lock()
+	defer scoringCache.Unlock()
+	if !scoringCache.loadedAt.IsZero() && time.Since(scoringCache.loadedAt) < ScoringCacheTTL() {
+		return scoringCache.config
+	}
+
+	resp, err := svc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(table),
+		Key: map[string]types.AttributeValue{
+			"configId": &types.AttributeValueMemberS{Value: scoringConfigID},
+		},
+	})
+	if err != nil {
+		fmt.Println("Failed to load scoring config, using environment settings:", err)
+		return settings
+	}
+	if rejected := settings.applyItem(resp.Item); len(rejected) > 0 {
+		fmt.Printf("Ignoring invalid scoring config attributes: %v\n", rejected)
+	}
+	fmt.Printf("Scoring config: %+v\n", settings)
+	scoringCache.config = settings
+	scoringCache.loadedAt = time.Now()
+	return settings
+}
+
+// Function to apply the settings in a config item or a request's
+// scoringOverrides over a config, returning the names of the ones that were
+// left out as invalid or unknown
+func (c *Config) applyItem(item map[string]types.AttributeValue) []string {
+	var rejected []string
+	number := func(name string, valid func(float64) bool, set func(float64)) {
+		attr, ok := item[name]
+		if !ok {
+			return
+		}
+		value, err := strconv.ParseFloat(catalog.GetNumberValue(attr), 64)
+		if err != nil || !valid(value) {
+			rejected = append(rejected, name)
+			return
+		}
+		set(value)
+	}
+	whole := func(name string, valid func(int) bool, set func(int)) {
+		number(name, func(v float64) bool { return v == math.Trunc(v) && valid(int(v)) }, func(v float64) { set(int(v)) })
+	}
+	positive := func(v float64) bool { return v > 0 }
+	nonNegative := func(v float64) bool { return v >= 0 }
+
+	whole("matchWeight", func(v int) bool { return v > 0 }, func(v int) { c.MatchWeight = v })
+	whole("penaltyWeight", func(v int) bool { return v >= 0 }, func(v int) { c.PenaltyWeight = v })
+	if attr, ok := item["normalization"]; ok {
+		if normalization := catalog.GetStringValue(attr); validNormalization(normalization) {
+			c.Normalization = normalization
+		} else {
+			rejected = append(rejected, "normalization")
+		}
+	}
+	number("popularityWeight", nonNegative, func(v float64) { c.PopularityWeight = v })
+	number("recencyWeight", nonNegative, func(v float64) { c.RecencyWeight = v })
+	number("recencyHalfLife", positive, func(v float64) { c.RecencyHalfLife = v })
+	number("collaborativeWeight", nonNegative, func(v float64) { c.CollaborativeWeight = v })
+	whole("minScore", func(int) bool { return true }, func(v int) { c.MinScore = v })
+	number("repeatPenalty", nonNegative, func(v float64) { c.RepeatPenalty = v })
+	whole("repeatWindowDays", func(v int) bool { return v >= 0 }, func(v int) { c.RepeatWindowDays = v })
+	number("exposurePenalty", nonNegative, func(v float64) { c.ExposurePenalty = v })
+	number("exposureThreshold", func(v float64) bool { return v >= 1 }, func(v float64) { c.ExposureThreshold = v })
+	whole("exposureWindowDays", func(v int) bool { return v > 0 }, func(v int) { c.ExposureWindowDays = v })
+	number("rerankArtistWeight", nonNegative, func(v float64) { c.RerankArtistWeight = v })
+	number("rerankEraWeight", nonNegative, func(v float64) { c.RerankEraWeight = v })
+	number("intensityWeight", nonNegative, func(v float64) { c.IntensityWeight = v })
+	number("affinityWeight", nonNegative, func(v float64) { c.AffinityWeight = v })
+
+	for _, name := range slices.Sorted(maps.Keys(item)) {
+		if name != "configId" && !scoringAttributes[name] {
+			rejected = append(rejected, name)
+		}
+	}
+	return rejected
+}
+
+// Curators can also tune the scoring settings for a single request with
+// "scoringOverrides", named like the scoring config item's attributes (see
+// above), to compare weights without a deploy:
+//
+//	"scoringOverrides": { "popularityWeight": 0, "normalization": "percent" }
+//
+// They apply over the deployment's settings for that request only. Like rule
+// overrides (see rules/overrides.go) they are off unless
+// SCORING_OVERRIDES_ENABLED=true, need the curator role over HTTP and keep
+// the request out of experiments. Unknown
+// settings and invalid values are rejected rather than ignored, so a typo
+// doesn't pass for a comparison.
+
+// Helper function to decide whether this caller may send scoring overrides
+func canOverrideScoring(inv api.Invocation) bool {
+	if config.Env("SCORING_OVERRIDES_ENABLED", "false") != "true" {
+		return false
+	}
+	return !inv.HTTP || inv.Role == api.RoleCurator
+}
+
+// Function to apply a request's scoring overrides over the scoring settings
+func ApplyScoringOverrides(settings Config, overrides map[string]interface{}, inv api.Invocation) (Config, error) {
+	if len(overrides) == 0 {
+		return settings, nil
+	}
+	if !canOverrideScoring(inv) {
+		return settings, api.Forbidden("scoring_overrides_not_allowed", "scoringOverrides are not enabled for this caller")
+	}
+
+	item := make(map[string]types.AttributeValue, len(overrides))
+	for name, value := range overrides {
+		switch v := value.(type) {
+		case float64:
+			item[name] = &types.AttributeValueMemberN{Value: strconv.FormatFloat(v, 'f', -1, 64)}
+		case string:
+			item[name] = &types.AttributeValueMemberS{Value: v}
+		default:
+			item[name] = &types.AttributeValueMemberNULL{Value: true}
+		}
+	}
+	delete(item, "configId")
+	if rejected := settings.applyItem(item); len(rejected) > 0 {
+		return settings, api.BadRequest("invalid_scoring_override", "scoringOverrides has invalid or unknown settings: %s", strings.Join(rejected, ", "))
+	}
+	fmt.Printf("Request scoring overrides %v give scoring config: %+v\n", overrides, settings)
+	return settings, nil
+}
+
+// Helper function to get the selections' scoring settings, the defaults when
+// none were set
+func (p *UserSelections) Config() Config {
+	if p.Scoring.MatchWeight == 0 {
+		return scoringFromEnv()
+	}
+	return p.Scoring
+}
+
+// Function to turn a song's matched points into its score
+func (c Config) score(matchPoints int, matched int, themes int) int {
+	score := matchPoints - c.PenaltyWeight*(themes-matched)
+	if c.Normalization == normalizationPercent && themes > 0 {
+		return int(math.Round(float64(score) * 100 / float64(themes*c.MatchWeight)))
+	}
+	return score
+}
+
+// Function to get the score of a song with exactly the selected themes,
+// the top of the confidence scale
+func (p *UserSelections) IdealScore() int {
+	if p.Scorer == ScorerSimilarity {
+		return similarityPoints
+	}
+	if p.Scorer == ScorerSimulation {
+		return p.simulationIdealScore()
+	}
+	scoring := p.Config()
+	points, selected := 0, 0
+	for name, on := range p.Selected {
+		if on {
+			points += scoring.MatchWeight * p.themeImportance(name) / api.DefaultImportance
+			selected++
+		}
+	}
+	return scoring.score(points, selected, selected)
+}
+
+// Helper function to turn a score into a 0-100 confidence
+func Confidence(score int, ideal int) int {
+	if ideal <= 0 {
+		return 0
+	}
+	return max(0, min(100, int(math.Round(float64(score)*100/float64(ideal)))))
+}
+
+// Function to add the boosts that depend on song attributes rather than
+// theme matches to every scored song
+func ApplyScoreBoosts(p *UserSelections, documents []catalog.CountryMusicDocument, now time.Time) {
+	scoring := p.Config()
+	recency := p.Era != "" && scoring.RecencyWeight > 0
+	if scoring.PopularityWeight == 0 && !recency {
+		return
+	}
+	for _, document := range documents {
+		score, ok := p.Recommendations[document.RuleID]
+		if !ok {
+			continue
+		}
+		breakdown := p.breakdown(document.RuleID)
+		breakdown.Popularity = int(math.Round(scoring.PopularityWeight * float64(document.Popularity) / 100))
+		if recency && document.Year > 0 {
+			breakdown.Recency = int(math.Round(scoring.RecencyWeight * eraAffinity(p.Era, document.Year, now.Year(), scoring.RecencyHalfLife)))
+		}
+		p.Recommendations[document.RuleID] = score + breakdown.Popularity + breakdown.Recency
+	}
+}
+
+// Helper function to rate 0-1 how well a release year suits the preferred
+// era: newness halves every halfLife years of age
+func eraAffinity(era string, year int, currentYear int, halfLife float64) float64 {
+	age := float64(max(currentYear-year, 0))
+	newness := math.Pow(0.5, age/halfLife)
+	if era == eraClassics {
+		return 1 - newness
+	}
+	return newness
+}
+
+// Helper function to pick the era a request prefers, "" for none
+func RequestEra(incoming api.IncomingRequest) string {
+	switch {
+	case incoming.PreferNew:
+		return eraNew
+	case incoming.PreferClassics:
+		return eraClassics
+	}
+	return ""
+}
@@ -0,0 +1,142 @@
+package scoring
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	"April32025/internal/catalog"
+	"April32025/internal/config"
+)
+
+// Seasonal boosts bump songs tagged for a season or holiday while it is on.
+// With SEASONS_TABLE set, each item there (key "tag") is one season:
+//
+//	{ "tag": "christmas",    "start": "12-01", "end": "12-26", "boost": 10 }
+//	{ "tag": "summer",       "start": "06-01", "end": "08-31", "boost": 4 }
+//	{ "tag": "fourthOfJuly", "start": "06-28", "end": "07-05", "boost": 8 }
+//
+// start and end are month-day, inclusive, in UTC, and repeat every year; a
+// window may wrap the new year ("12-26" to "01-02"). Songs list their seasons
+// in a "tags" attribute, e.g. ["christmas"]. Once the theme score and the
+// other boosts are in, every scored song with a season on gets its boost, the
+// largest one when several are. Songs that matched no theme stay unscored.
+// The table is small and re-read with the scoring config, every
+// SCORING_CACHE_SECONDS.
+
+// season is a date window and the boost songs tagged for it get
+type season struct {
+	Tag   string
+	Start string // MM-DD
+	End   string // MM-DD
+	Boost int
+}
+
+var seasonsCache = struct {
+	sync.Mutex
+	seasons  []season
+	loadedAt time.Time
+}{}
+
+// Helper function to check whether a date falls within a season's window
+func (s season) activeOn(now time.Time) bool {
+	today := now.UTC().Format("01-02")
+	if s.Start <= s.End {
+		return today >= s.Start && today <= s.End
+	}
+	return today >= s.Start || today <= s.End
+}
+
+// Helper function to check an MM-DD date
+func validMonthDay(value string) bool {
+	_, err := time.Parse("01-02", value)
+	return err == nil
+}
+
+// Function to load the seasons, cached. Lookup failures are logged and leave
+// the seasons last loaded, or none.
+func LoadSeasons(ctx context.Context, svc *dynamodb.Client) []season {
+	table := config.Storage().SeasonsTable
+	if table == "" {
+		return nil
+	}
+
+	seasonsCache.Lock()
+	defer seasonsCache.Unlock()
+	if !seasonsCache.loadedAt.IsZero() && time.Since(seasonsCache.loadedAt) < ScoringCacheTTL() {
+		return seasonsCache.seasons
+	}
+
+	var seasons []season
+	paginator := dynamodb.NewScanPaginator(svc, &dynamodb.ScanInput{TableName: aws.String(table)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			fmt.Println("Failed to load seasons:", err)
+			return seasonsCache.seasons
+		}
+		for _, item := range page.Items {
+			s := season{
+				Tag:   catalog.GetStringValue(item["tag"]),
+				Start: catalog.GetStringValue(item["start"]),
+				End:   catalog.GetStringValue(item["end"]),
+			}
+			boost, err := strconv.Atoi(catalog.GetNumberValue(item["boost"]))
+			if s.Tag == "" || !validMonthDay(s.Start) || !validMonthDay(s.End) || err != nil {
+				fmt.Printf("Skipping season '%s', it needs MM-DD start and end dates and a whole-number boost\n", s.Tag)
+				continue
+			}
+			s.Boost = boost
+			seasons = append(seasons, s)
+		}
+	}
+	fmt.Printf("Loaded %d seasons\n", len(seasons))
+	seasonsCache.seasons = seasons
+	seasonsCache.loadedAt = time.Now()
+	return seasons
+}
+
+// Function to get the boost for each tag whose season is on
+func activeSeasonBoosts(seasons []season, now time.Time) map[string]int {
+	boosts := make(map[string]int)
+	for _, s := range seasons {
+		tag := strings.ToLower(s.Tag)
+		if boost, ok := boosts[tag]; s.activeOn(now) && (!ok || s.Boost > boost) {
+			boosts[tag] = s.Boost
+		}
+	}
+	return boosts
+}
+
+// Function to add the active seasons' boosts to the scored songs tagged for them
+func ApplySeasonalBoosts(p *UserSelections, documents []catalog.CountryMusicDocument, seasons []season, now time.Time) {
+	boosts := activeSeasonBoosts(seasons, now)
+	if len(boosts) == 0 {
+		return
+	}
+	boosted := 0
+	for _, document := range documents {
+		score, scored := p.Recommendations[document.RuleID]
+		if !scored {
+			continue
+		}
+		best, found := 0, false
+		for _, tag := range document.Tags {
+			if boost, ok := boosts[strings.ToLower(tag)]; ok && (!found || boost > best) {
+				best, found = boost, true
+			}
+		}
+		if found {
+			p.Recommendations[document.RuleID] = score + best
+			p.breakdown(document.RuleID).Seasonal = best
+			boosted++
+		}
+	}
+	fmt.Printf("Seasonal boosts %v applied to %d songs\n", boosts, boosted)
+}
@@ -0,0 +1,234 @@
+package scoring
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"April32025/internal/api"
+	"April32025/internal/catalog"
+)
+
+type UserSelections struct {
+	Selected        map[string]bool // keyed by theme name (themeFieldNames values), missing means not selected
+	Importance      map[string]int  // 1-5 rating keyed by theme name, missing means defaultImportance
+	Recommendations map[string]int
+	Contributions   map[string]map[string]int     // songId -> matched theme -> points
+	FiredRules      []string                      // rule names in the order their then-blocks ran
+	Tier            string                        // listener's plan, see HasTier
+	Ineligible      map[string]string             // songId -> hard filter that excluded it, see rules/eligibility.go
+	Duplicates      map[string]bool               // songIds dropped as repeats of a kept entry, see duplicates.go
+	ThemeWeights    map[string]map[string]float64 // songId -> theme name -> weight, for weighted songs only
+	Scoring         Config                        // formula settings, see scoring.go
+	Era             string                        // "new", "classics" or "" for the recency boost
+	Scorer          string                        // "rules", "similarity" or "simulation", see similarity.go
+	Variant         string                        // experiment variant, "" when not enrolled
+	Breakdowns      map[string]*ScoreBreakdown    // songId -> score makeup, see breakdown.go
+	RankerVersion   string                        // learned ranker model that scored the songs, see ranker.go
+	Intensity       *api.IntensityRange           // requested intensity, nil for any
+}
+
+func GetUserSelections(incoming api.IncomingRequest) *UserSelections {
+	// Rating a theme selects it, so clients can send importance on its own
+	selected := make(map[string]bool)
+	for theme, on := range incoming.Themes {
+		selected[theme] = on
+	}
+	importance := make(map[string]int)
+	for theme, level := range incoming.Importance {
+		fieldName, ok := catalog.ThemeFieldNames[theme]
+		if !ok {
+			fmt.Println("Ignoring importance for unknown theme: " + theme)
+			continue
+		}
+		if level < api.MinImportance || level > api.MaxImportance {
+			fmt.Printf("Clamping importance %d for theme %s to %d-%d\n", level, theme, api.MinImportance, api.MaxImportance)
+			level = max(api.MinImportance, min(level, api.MaxImportance))
+		}
+		importance[fieldName] = level
+		selected[theme] = true
+	}
+
+	for _, theme := range incoming.RequiredThemes {
+		selected[theme] = true
+	}
+
+	// Map the request's theme keys to theme names
+	selectedThemes := make(map[string]bool)
+	for theme, on := range selected {
+		if fieldName, ok := catalog.ThemeFieldNames[theme]; ok && on {
+			selectedThemes[fieldName] = true
+		}
+	}
+
+	userSelections := UserSelections{
+		Selected:        selectedThemes,
+		Importance:      importance,
+		Recommendations: make(map[string]int), // Initialize Recommendations
+		Contributions:   make(map[string]map[string]int),
+		Breakdowns:      make(map[string]*ScoreBreakdown),
+	}
+	return &userSelections
+}
+
+// Function to check whether the user selected a theme. Unknown themes are
+// never selected; rules naming them just don't match.
+func (p *UserSelections) IsSelected(theme string) bool {
+	name, ok := catalog.CanonicalTheme(theme)
+	if !ok {
+		fmt.Println("Unknown theme in rule: " + theme)
+		return false
+	}
+	return p.Selected[name]
+}
+
+func (p *UserSelections) IsSongThemeMatch(songId string, songThemes ...string) bool {
+	fmt.Println("=========")
+	fmt.Println("Checking Matches: " + songId)
+
+	if reason, ok := p.Ineligible[songId]; ok {
+		fmt.Println("Not eligible: " + reason)
+		return false
+	}
+
+	for _, theme := range songThemes {
+		if p.IsSelected(theme) {
+			fmt.Println("Match found!")
+			return true
+		}
+
+		fmt.Println("No Matches")
+	}
+	return false
+}
+
+func (p *UserSelections) SetRecommendations(songId string, songThemes ...string) int {
+	fmt.Println("------")
+	fmt.Println("Counting Matches... (" + songId + ")")
+
+	scoring := p.Config()
+	matchCount := 0
+	matchPoints := 0
+	contributions := make(map[string]int)
+	for _, theme := range songThemes {
+		if p.IsSelected(theme) {
+			matchCount += 1
+			points := p.weighted(songId, theme, scoring.MatchWeight*p.themeImportance(theme)/api.DefaultImportance)
+			matchPoints += points
+			contributions[theme] = points
+			fmt.Println(theme+" --- Match found -", matchCount)
+		} else {
+			fmt.Println(theme)
+		}
+	}
+
+	// Each match is worth matchWeight at default importance, scaled by the
+	// user's rating; unselected themes cost penaltyWeight each, see scoring.go
+	score := scoring.score(matchPoints, matchCount, len(songThemes))
+	breakdown := p.breakdown(songId)
+	breakdown.ThemePoints = matchPoints
+	breakdown.Penalty = -scoring.PenaltyWeight * (len(songThemes) - matchCount)
+	breakdown.Normalization = score - matchPoints - breakdown.Penalty
+
+	fmt.Println("\nMatches for song '"+songId+"':", score)
+
+	p.Recommendations[songId] = score
+	p.Contributions[songId] = contributions
+	p.FiredRules = append(p.FiredRules, catalog.RuleNameFor(songId))
+	return score
+}
+
+// Function to check whether a song has been scored, for rules that guard
+// against firing twice instead of retracting themselves
+func (p *UserSelections) Scored(songId string) bool {
+	_, ok := p.Contributions[songId]
+	return ok
+}
+
+// Function to get the importance rating the user gave a theme
+func (p *UserSelections) themeImportance(theme string) int {
+	name, _ := catalog.CanonicalTheme(theme)
+	if importance, ok := p.Importance[name]; ok {
+		return importance
+	}
+	return api.DefaultImportance
+}
+
+// Helper function to scale a theme's points by its weight in the song
+func (p *UserSelections) weighted(songId string, theme string, points int) int {
+	name, _ := catalog.CanonicalTheme(theme)
+	weight, ok := p.ThemeWeights[songId][name]
+	if !ok || weight == 1 {
+		return points
+	}
+	return int(math.Round(float64(points) * weight))
+}
+
+// Function to check whether the user selected at least one of the themes
+func (p *UserSelections) MatchesAny(themes ...string) bool {
+	for _, theme := range themes {
+		if p.IsSelected(theme) {
+			return true
+		}
+	}
+	return false
+}
+
+// Function to check whether the user selected every one of the themes
+func (p *UserSelections) MatchesAll(themes ...string) bool {
+	for _, theme := range themes {
+		if !p.IsSelected(theme) {
+			return false
+		}
+	}
+	return true
+}
+
+// Function to check that the user selected none of the themes
+func (p *UserSelections) MatchesNone(themes ...string) bool {
+	return !p.MatchesAny(themes...)
+}
+
+// Function to add points to a song when the user selected every listed theme
+func (p *UserSelections) BoostIfAll(songId string, points int64, themes ...string) bool {
+	if !p.MatchesAll(themes...) {
+		return false
+	}
+	fmt.Printf("Boosting %s by %d for matching all of %s\n", songId, points, strings.Join(themes, ", "))
+	p.Recommendations[songId] += int(points)
+	return true
+}
+
+// Function to take points off a song when the user did not select a theme
+func (p *UserSelections) PenalizeTheme(songId string, theme string, points int64) bool {
+	if p.IsSelected(theme) {
+		return false
+	}
+	fmt.Printf("Penalizing %s by %d for unselected theme %s\n", songId, points, theme)
+	p.Recommendations[songId] -= int(points)
+	return true
+}
+
+// Helper function to copy selections for one shard, sharing the read-only
+// choices and starting with empty scores
+func (p *UserSelections) ForShard() *UserSelections {
+	return &UserSelections{
+		Selected:        p.Selected,
+		Importance:      p.Importance,
+		Tier:            p.Tier,
+		Ineligible:      p.Ineligible,
+		ThemeWeights:    p.ThemeWeights,
+		Scoring:         p.Scoring,
+		Recommendations: make(map[string]int),
+		Contributions:   make(map[string]map[string]int),
+		Breakdowns:      make(map[string]*ScoreBreakdown),
+	}
+}
+
+// Function to drop scores the rules gave to ineligible songs
+func (p *UserSelections) DropIneligible() {
+	for songId := range p.Ineligible {
+		delete(p.Recommendations, songId)
+		delete(p.Contributions, songId)
+	}
+}
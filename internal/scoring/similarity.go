@@ -0,0 +1,100 @@
+package scoring
+
+import (
+	"fmt"
+	"math"
+
+	"April32025/internal/api"
+	"April32025/internal/catalog"
+)
+
+// Scorers a request can pick with "scorer". The rules scorer runs the
+// catalog's knowledge base and counts theme matches. The similarity scorer
+// skips the rules and treats the selections and each song as vectors over the
+// themes: a selected theme weighs its importance/3, a song's theme its theme
+// weight (1 unless weighted, see catalog/themeweights.go). A song scores the
+// cosine similarity of the two as 0-100 points, so with many themes selected a
+// song covering most of them ranks smoothly above one that covers a few, and
+// songs with many unselected themes aren't penalized per theme. Each theme's
+// share of the score is reported as its contribution. Hard filters and the
+// songs' tiers and theme combinations still apply, see rules/eligibility.go;
+// hand-authored rules and ruleOverrides don't. The simulation scorer for
+// golden tests is in simulation.go.
+const (
+	ScorerRules      = "rules"
+	ScorerSimilarity = "similarity"
+
+	similarityPoints = 100
+)
+
+func IsValidScorer(scorer string) bool {
+	return scorer == "" || scorer == ScorerRules || scorer == ScorerSimilarity || scorer == ScorerSimulation
+}
+
+// Function to score every eligible song by the cosine similarity of its
+// themes to the selections, in place of running the rules
+func ScoreBySimilarity(p *UserSelections, documents []catalog.CountryMusicDocument) {
+	selections := make(map[string]float64, len(p.Selected))
+	for name, on := range p.Selected {
+		if on {
+			selections[name] = float64(p.themeImportance(name)) / api.DefaultImportance
+		}
+	}
+	selectionsNorm := vectorNorm(selections)
+	if selectionsNorm == 0 {
+		return
+	}
+
+	for _, document := range documents {
+		if _, excluded := p.Ineligible[document.RuleID]; excluded {
+			continue
+		}
+		song := songThemeVector(document)
+		songNorm := vectorNorm(song)
+		dot := 0.0
+		for name, weight := range song {
+			dot += weight * selections[name]
+		}
+		if dot == 0 {
+			continue
+		}
+
+		contributions := make(map[string]int)
+		for name, weight := range song {
+			if selections[name] > 0 {
+				contributions[name] = int(math.Round(similarityPoints * weight * selections[name] / (songNorm * selectionsNorm)))
+			}
+		}
+		p.Recommendations[document.RuleID] = int(math.Round(similarityPoints * dot / (songNorm * selectionsNorm)))
+		p.breakdown(document.RuleID).ThemePoints = p.Recommendations[document.RuleID]
+		p.Contributions[document.RuleID] = contributions
+	}
+	fmt.Printf("Similarity scorer matched %d songs\n", len(p.Recommendations))
+}
+
+// Helper function to get a song's theme vector, keyed by theme name
+func songThemeVector(document catalog.CountryMusicDocument) map[string]float64 {
+	vector := make(map[string]float64)
+	for key, desc := range document.Themes {
+		name, known := catalog.CanonicalTheme(key)
+		if !known || desc == "" {
+			continue
+		}
+		weight, weighted := document.ThemeWeights[name]
+		if !weighted {
+			weight = 1
+		}
+		if weight > 0 {
+			vector[name] = weight
+		}
+	}
+	return vector
+}
+
+func vectorNorm(vector map[string]float64) float64 {
+	sum := 0.0
+	for _, value := range vector {
+		sum += value * value
+	}
+	return math.Sqrt(sum)
+}
@@ -0,0 +1,127 @@
+package scoring
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"April32025/internal/api"
+	"April32025/internal/catalog"
+	"April32025/internal/config"
+)
+
+// The simulation scorer is for golden tests of the whole pipeline: given the
+// same catalog and request it produces identical responses, bar the requestId
+// and timing, which tests normalize. It skips
+// the rules and scores with integer arithmetic only, walking songs in RuleID
+// order and each song's themes in key order, so neither map iteration nor
+// floating point can change a result. For each described theme of a song:
+//
+//	selected   +simulationMatchPoints * importance / 3, rounded down per theme
+//	unselected -simulationPenaltyPoints
+//
+// Theme weights and normalization are ignored; the points are fixed so
+// golden files don't move when a deployment tunes them. A song scores when
+// at least one theme matched. Hard filters and the songs' tiers and theme
+// combinations still apply, see rules/eligibility.go; hand-authored rules
+// and ruleOverrides don't.
+//
+// The stages after scoring run with SimulationConfig in place of the
+// environment, CONFIG_TABLE and scoringOverrides: popularity, recency,
+// intensity, affinity, collaborative, repeat and exposure adjustments and
+// re-ranking are all off, minScore is the default, and the learned ranker
+// is skipped.
+//
+// Tests pick it per request with "scorer": "simulation", or for every request
+// that doesn't pick a scorer with DEFAULT_SCORER=simulation. Since it ignores
+// the deployment's tuning it never reaches listeners: over HTTP it is refused
+// unless SIMULATION_SCORER_ENABLED=true, a setting for test stages only, and
+// it can't be an experiment variant. What's left that a deployment can still
+// change must be left unset or fixed by the test: SEASONS_TABLE (seasonal
+// boosts read the clock), DIVERSITY_MAX_PER_ARTIST, EXPLORATION_RATE and
+// MEDIA_URL_SIGNER (signed links expire). Pass a seed with explore or sortBy
+// "random", and nothing else varies between runs.
+const (
+	ScorerSimulation = "simulation"
+
+	simulationMatchPoints   = 10
+	simulationPenaltyPoints = 1
+)
+
+// Helper function to get the scorer a request runs when it doesn't pick one
+func DefaultScorer() string {
+	scorer := config.Env("DEFAULT_SCORER", ScorerRules)
+	if scorer == "" || !IsValidScorer(scorer) {
+		fmt.Println("Ignoring unknown DEFAULT_SCORER " + scorer)
+		return ScorerRules
+	}
+	return scorer
+}
+
+// Helper function to decide whether this caller may run the simulation scorer
+func CanSimulate(inv api.Invocation) bool {
+	return !inv.HTTP || config.Env("SIMULATION_SCORER_ENABLED", "false") == "true"
+}
+
+// Function to get the fixed scoring settings the simulation scorer runs with
+func SimulationConfig() Config {
+	return Config{
+		MatchWeight:        defaultMatchWeight,
+		Normalization:      normalizationNone,
+		RecencyHalfLife:    defaultRecencyHalfLife,
+		MinScore:           defaultMinScore,
+		RepeatWindowDays:   defaultRepeatWindowDays,
+		ExposureThreshold:  defaultExposureThreshold,
+		ExposureWindowDays: defaultExposureWindowDays,
+	}
+}
+
+// Helper function to get the points a selected theme is worth
+func (p *UserSelections) simulationThemePoints(name string) int {
+	return simulationMatchPoints * p.themeImportance(name) / api.DefaultImportance
+}
+
+// Function to score every eligible song with the simulation scorer's fixed
+// arithmetic, in place of running the rules
+func ScoreBySimulation(p *UserSelections, documents []catalog.CountryMusicDocument) {
+	for _, document := range catalog.SortedByRuleID(documents) {
+		if _, excluded := p.Ineligible[document.RuleID]; excluded {
+			continue
+		}
+		points, penalty := 0, 0
+		contributions := make(map[string]int)
+		for _, key := range slices.Sorted(maps.Keys(document.Themes)) {
+			name, known := catalog.CanonicalTheme(key)
+			if !known || document.Themes[key] == "" {
+				continue
+			}
+			if !p.Selected[name] {
+				penalty -= simulationPenaltyPoints
+				continue
+			}
+			contributions[name] = p.simulationThemePoints(name)
+			points += contributions[name]
+		}
+		if len(contributions) == 0 {
+			continue
+		}
+		p.Recommendations[document.RuleID] = points + penalty
+		p.Contributions[document.RuleID] = contributions
+		breakdown := p.breakdown(document.RuleID)
+		breakdown.ThemePoints = points
+		breakdown.Penalty = penalty
+	}
+	fmt.Printf("Simulation scorer matched %d songs\n", len(p.Recommendations))
+}
+
+// Function to get the simulation score of a song with exactly the selected
+// themes, the top of the confidence scale
+func (p *UserSelections) simulationIdealScore() int {
+	ideal := 0
+	for _, name := range slices.Sorted(maps.Keys(p.Selected)) {
+		if p.Selected[name] {
+			ideal += p.simulationThemePoints(name)
+		}
+	}
+	return ideal
+}
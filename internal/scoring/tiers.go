@@ -0,0 +1,40 @@
+package scoring
+
+import "April32025/internal/api"
+
+// Plans a listener can be on. Songs marked with a tier (the "tier" catalog
+// attribute, e.g. premium-only deep cuts) only reach listeners on that plan
+// or a higher one; unmarked songs are open to everyone.
+const (
+	TierFree    = "free"
+	TierPremium = "premium"
+)
+
+var TierRanks = map[string]int{
+	TierFree:    0,
+	TierPremium: 1,
+}
+
+// Function to check whether the listener's plan includes a tier's songs.
+// Songs marked with a tier we don't know are withheld from everyone.
+func (p *UserSelections) HasTier(tier string) bool {
+	required, ok := TierRanks[tier]
+	if !ok {
+		return false
+	}
+	return TierRanks[p.Tier] >= required
+}
+
+// Helper function to pick the listener's tier. Over HTTP the plan comes from
+// the API Gateway authorizer, never the request body, so clients can't
+// upgrade themselves.
+func RequestTier(incoming api.IncomingRequest, inv api.Invocation) string {
+	tier := incoming.Tier
+	if inv.HTTP {
+		tier = inv.Tier
+	}
+	if _, ok := TierRanks[tier]; !ok {
+		return TierFree
+	}
+	return tier
+}
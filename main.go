@@ -0,0 +1,21 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-lambda-go/lambda"
+
+	"April32025/internal/config"
+	"April32025/internal/handler"
+)
+
+func main() {
+	if _, err := config.GetStorageSettings(); err != nil {
+		fmt.Println("Invalid storage configuration: " + err.Error())
+		os.Exit(1)
+	}
+	handler.Warm(context.Background())
+	lambda.Start(handler.HandleRequest)
+}
@@ -0,0 +1,153 @@
+// Package rulestest helps write regression tests for recommendation rules:
+// build a knowledge base from GRL, run it against test facts and compare the
+// scores it produced.
+//
+// Rule generation is internal, so the tests live in internal/rules (see
+// grl_test.go there). They generate the rules from the fixture catalog in
+// internal/rules/testdata, then drive them through the harness:
+//
+//	var documents []catalog.CountryMusicDocument
+//	rulestest.LoadFixture(t, "testdata/catalog.json", &documents)
+//	grl, err := extractGrules(documents)
+//	...
+//	selections := scoring.GetUserSelections(api.IncomingRequest{Themes: map[string]bool{"love": true}})
+//	kb := rulestest.Build(t, grl)
+//	rulestest.Execute(t, kb, rulestest.Facts{"UserSelections": selections})
+//	rulestest.AssertScores(t, selections.Recommendations, map[string]int{"song-2": 10})
+package rulestest
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hyperjumptech/grule-rule-engine/ast"
+	"github.com/hyperjumptech/grule-rule-engine/builder"
+	"github.com/hyperjumptech/grule-rule-engine/engine"
+	"github.com/hyperjumptech/grule-rule-engine/pkg"
+)
+
+// Facts are the named values a rule set reads, e.g. "UserSelections"
+type Facts map[string]interface{}
+
+// LoadFixture decodes a JSON fixture file into v
+func LoadFixture(t testing.TB, path string, v interface{}) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading fixture %s: %v", path, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("decoding fixture %s: %v", path, err)
+	}
+}
+
+// Build compiles GRL into a fresh knowledge base, failing the test on any
+// syntax error
+func Build(t testing.TB, rules string) *ast.KnowledgeBase {
+	t.Helper()
+	library := ast.NewKnowledgeLibrary()
+	if err := builder.NewRuleBuilder(library).BuildRuleFromResource("RulesTest", "0", pkg.NewBytesResource([]byte(rules))); err != nil {
+		t.Fatalf("building rules: %v", err)
+	}
+	knowledgeBase, err := library.NewKnowledgeBaseInstance("RulesTest", "0")
+	if err != nil {
+		t.Fatalf("creating knowledge base: %v", err)
+	}
+	return knowledgeBase
+}
+
+// Execute runs a knowledge base to completion against the facts and returns
+// the names of the rules that fired, in order
+func Execute(t testing.TB, knowledgeBase *ast.KnowledgeBase, facts Facts) []string {
+	t.Helper()
+	dataCtx := ast.NewDataContext()
+	for name, fact := range facts {
+		if err := dataCtx.Add(name, fact); err != nil {
+			t.Fatalf("adding fact %s: %v", name, err)
+		}
+	}
+
+	fired := &firedRules{}
+	gruleEngine := engine.NewGruleEngine()
+	gruleEngine.Listeners = []engine.GruleEngineListener{fired}
+	if err := gruleEngine.Execute(dataCtx, knowledgeBase); err != nil {
+		t.Fatalf("executing rules: %v", err)
+	}
+	return fired.names
+}
+
+// AssertScores fails the test unless got holds exactly the wanted scores,
+// listing every song that differs
+func AssertScores(t testing.TB, got map[string]int, want map[string]int) {
+	t.Helper()
+	var diffs []string
+	for _, song := range unionKeys(got, want) {
+		gotScore, inGot := got[song]
+		wantScore, inWant := want[song]
+		switch {
+		case !inWant:
+			diffs = append(diffs, "unexpected score for "+song+": "+strconv.Itoa(gotScore))
+		case !inGot:
+			diffs = append(diffs, "missing score for "+song+", want "+strconv.Itoa(wantScore))
+		case gotScore != wantScore:
+			diffs = append(diffs, "score for "+song+" is "+strconv.Itoa(gotScore)+", want "+strconv.Itoa(wantScore))
+		}
+	}
+	if len(diffs) > 0 {
+		t.Errorf("recommendations differ:\n  %s", strings.Join(diffs, "\n  "))
+	}
+}
+
+// AssertRanking fails the test unless the highest scoring songs come out in
+// the wanted order. Ties are broken by song ID, as the Lambda does.
+func AssertRanking(t testing.TB, got map[string]int, want ...string) {
+	t.Helper()
+	ranked := make([]string, 0, len(got))
+	for song := range got {
+		ranked = append(ranked, song)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if got[ranked[i]] != got[ranked[j]] {
+			return got[ranked[i]] > got[ranked[j]]
+		}
+		return ranked[i] < ranked[j]
+	})
+	if len(ranked) > len(want) {
+		ranked = ranked[:len(want)]
+	}
+	if strings.Join(ranked, ",") != strings.Join(want, ",") {
+		t.Errorf("ranking is %v, want %v", ranked, want)
+	}
+}
+
+type firedRules struct {
+	names []string
+}
+
+func (f *firedRules) EvaluateRuleEntry(cycle uint64, entry *ast.RuleEntry, candidate bool) {}
+
+func (f *firedRules) ExecuteRuleEntry(cycle uint64, entry *ast.RuleEntry) {
+	f.names = append(f.names, entry.RuleName)
+}
+
+func (f *firedRules) BeginCycle(cycle uint64) {}
+
+func unionKeys(a, b map[string]int) []string {
+	seen := make(map[string]bool)
+	for key := range a {
+		seen[key] = true
+	}
+	for key := range b {
+		seen[key] = true
+	}
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}